@@ -0,0 +1,234 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// maxWritesPerCall is the maximum number of operations the server will accept
+// in a single batch write call.
+const maxWritesPerCall = 200
+
+// ErrBatchTooLarge is returned if an atomic batch write has more operations than
+// the server accepts in a single call.
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// BatchError is returned if a chunked batch write fails midway. The chunks before
+// the failing one were applied, the failing one and the ones after it not.
+type BatchError struct {
+	Chunk   int          // Index of the chunk that failed (0 based)
+	Applied []*RecordRef // References to the records written before the failure
+	Err     error        // Error the failing chunk was rejected with
+}
+
+// Error implements the error interface.
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch chunk %d failed after %d writes: %v", e.Chunk, len(e.Applied), e.Err)
+}
+
+// Unwrap returns the error the failing chunk was rejected with.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batchWrite is a single operation of a com.atproto.repo.applyWrites call. It is
+// defined locally to pass the record content pre-encoded, as the generated bindings
+// reject any record type they do not know about.
+type batchWrite struct {
+	Type       string          `json:"$type"`
+	Collection string          `json:"collection"`
+	Rkey       string          `json:"rkey"`
+	Value      json.RawMessage `json:"value,omitempty"`
+}
+
+// WriteBatch accumulates record creations, updates and deletions across any of
+// the collections in the logged in user's repository, to be applied together.
+//
+// Errors in assembling the individual operations (e.g. records that cannot be
+// encoded or are not owned by the user) are reported when committing.
+type WriteBatch struct {
+	client *Client       // API client to apply the writes through
+	did    string        // DID of the logged in user's repository
+	writes []*batchWrite // Operations accumulated so far
+	err    error         // First error encountered while assembling the batch
+}
+
+// NewWriteBatch creates an empty batch of writes to the logged in user's
+// repository.
+func (c *Client) NewWriteBatch() *WriteBatch {
+	did, err := c.userDID()
+	return &WriteBatch{client: c, did: did, err: err}
+}
+
+// Len returns the number of operations accumulated in the batch.
+func (b *WriteBatch) Len() int {
+	return len(b.writes)
+}
+
+// Create adds a record creation to the batch, returning the AT-URI the record
+// will have, so that other records in the same batch can reference it. Unless
+// specified otherwise via WithRecordKey, the record key is a newly generated
+// timestamp id. Other record options are ignored.
+func (b *WriteBatch) Create(collection string, record any, opts ...RecordOption) string {
+	cfg, err := newRecordConfig(opts).withRecordKey()
+	if err != nil {
+		b.fail(err)
+		return ""
+	}
+	blob, err := encodeRecord(collection, record)
+	if err != nil {
+		b.fail(err)
+		return ""
+	}
+	b.writes = append(b.writes, &batchWrite{
+		Type:       "com.atproto.repo.applyWrites#create",
+		Collection: collection,
+		Rkey:       cfg.rkey,
+		Value:      blob,
+	})
+	return "at://" + b.did + "/" + collection + "/" + cfg.rkey
+}
+
+// Update adds a record replacement to the batch.
+func (b *WriteBatch) Update(uri string, record any) {
+	_, collection, rkey, err := b.client.ownedRecord(uri)
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	blob, err := encodeRecord(collection, record)
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	b.writes = append(b.writes, &batchWrite{
+		Type:       "com.atproto.repo.applyWrites#update",
+		Collection: collection,
+		Rkey:       rkey,
+		Value:      blob,
+	})
+}
+
+// Delete adds a record deletion to the batch.
+func (b *WriteBatch) Delete(uri string) {
+	_, collection, rkey, err := b.client.ownedRecord(uri)
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	b.writes = append(b.writes, &batchWrite{
+		Type:       "com.atproto.repo.applyWrites#delete",
+		Collection: collection,
+		Rkey:       rkey,
+	})
+}
+
+// fail records the first error encountered while assembling the batch.
+func (b *WriteBatch) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Commit applies all the operations in the batch atomically: either all of them
+// succeed, or none. The returned references are in the order of the operations,
+// deletions having an empty content hash. The batch may be conditioned on the
+// repository's latest commit via WithSwapCommit.
+//
+// Since atomicity is only guaranteed by the server within a single call, batches
+// with more operations than the server accepts at once are rejected with
+// ErrBatchTooLarge. Use CommitChunks for those.
+func (b *WriteBatch) Commit(ctx context.Context, opts ...RecordOption) ([]*RecordRef, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.writes) > maxWritesPerCall {
+		return nil, fmt.Errorf("%w: %d writes, max %d", ErrBatchTooLarge, len(b.writes), maxWritesPerCall)
+	}
+	refs, _, err := b.apply(ctx, b.writes, newRecordConfig(opts).swapCommit)
+	return refs, err
+}
+
+// CommitChunks applies all the operations in the batch on a best-effort basis,
+// split into chunks of the maximum size the server accepts in a single call. Each
+// chunk is applied atomically and in order; if one fails, the remaining ones are
+// skipped and a *BatchError is returned, detailing the failing chunk and what was
+// written before it.
+//
+// If the batch is conditioned on the repository's latest commit via WithSwapCommit,
+// each subsequent chunk is conditioned on the commit of the previous one, so any
+// concurrent write to the repository aborts the rest of the batch.
+func (b *WriteBatch) CommitChunks(ctx context.Context, opts ...RecordOption) ([]*RecordRef, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	var (
+		swap = newRecordConfig(opts).swapCommit
+		refs = make([]*RecordRef, 0, len(b.writes))
+	)
+	for chunk, writes := 0, b.writes; len(writes) > 0; chunk++ {
+		batch := writes
+		if len(batch) > maxWritesPerCall {
+			batch = batch[:maxWritesPerCall]
+		}
+		writes = writes[len(batch):]
+
+		applied, commit, err := b.apply(ctx, batch, swap)
+		if err != nil {
+			return refs, &BatchError{Chunk: chunk, Applied: refs, Err: err}
+		}
+		refs = append(refs, applied...)
+		if swap != "" {
+			swap = commit
+		}
+	}
+	return refs, nil
+}
+
+// apply executes a single batch write call, returning the references to the
+// written records and the commit the repository advanced to.
+func (b *WriteBatch) apply(ctx context.Context, writes []*batchWrite, swap string) ([]*RecordRef, string, error) {
+	input := map[string]any{
+		"repo":   b.did,
+		"writes": writes,
+	}
+	if swap != "" {
+		input["swapCommit"] = swap
+	}
+	var res struct {
+		Commit  *atproto.RepoDefs_CommitMeta `json:"commit"`
+		Results []*struct {
+			URI string `json:"uri"`
+			CID string `json:"cid"`
+		} `json:"results"`
+	}
+	if err := b.client.client.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.applyWrites", nil, input, &res); err != nil {
+		if isInvalidSwap(err) {
+			return nil, "", &ConflictError{URI: "at://" + b.did, Want: swap}
+		}
+		return nil, "", err
+	}
+	// Assemble the record references from the operations, filling in the content
+	// hashes if the server reported them (older servers did not)
+	refs := make([]*RecordRef, len(writes))
+	for i, write := range writes {
+		refs[i] = &RecordRef{URI: "at://" + b.did + "/" + write.Collection + "/" + write.Rkey}
+		if i < len(res.Results) && res.Results[i] != nil {
+			refs[i].CID = res.Results[i].CID
+		}
+	}
+	var commit string
+	if res.Commit != nil {
+		commit = res.Commit.Cid
+	}
+	return refs, commit, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Tests that an atomic batch write applies mixed operations across collections
+// in one go, and rejects batches too large for a single call.
+func TestWriteBatchCommit(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		server = newTestRepoServer()
+		client = makeTestServerClient(t, server)
+	)
+	existing, err := CreateRecord(ctx, client, "com.example.score", &testCustomRecord{Text: "old"})
+	if err != nil {
+		t.Fatalf("failed to create record: %v", err)
+	}
+	doomed, err := CreateRecord(ctx, client, "com.example.other", &testCustomRecord{Text: "doomed"})
+	if err != nil {
+		t.Fatalf("failed to create record: %v", err)
+	}
+	batch := client.NewWriteBatch()
+	created := batch.Create("com.example.score", &testCustomRecord{Text: "new"})
+	batch.Update(existing.URI, &testCustomRecord{Text: "updated"})
+	batch.Delete(doomed.URI)
+
+	refs, err := batch.Commit(ctx, WithSwapCommit("commit-0"))
+	if err != nil {
+		t.Fatalf("failed to commit batch: %v", err)
+	}
+	if len(refs) != 3 || refs[0].URI != created || refs[1].URI != existing.URI || refs[2].URI != doomed.URI {
+		t.Fatalf("batch results mismatch: have %v", refs)
+	}
+	if record, err := GetRecord[testCustomRecord](ctx, client, created); err != nil || record.Value.Text != "new" || record.CID != refs[0].CID {
+		t.Errorf("created record mismatch: have %+v/%v", record, err)
+	}
+	if record, err := GetRecord[testCustomRecord](ctx, client, existing.URI); err != nil || record.Value.Text != "updated" {
+		t.Errorf("updated record mismatch: have %+v/%v", record, err)
+	}
+	if _, err := GetRecord[testCustomRecord](ctx, client, doomed.URI); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("deleted record error mismatch: have %v, want %v", err, ErrRecordNotFound)
+	}
+	// Ensure stale commits and foreign records are rejected
+	batch = client.NewWriteBatch()
+	batch.Create("com.example.score", &testCustomRecord{})
+	var conflict *ConflictError
+	if _, err := batch.Commit(ctx, WithSwapCommit("commit-0")); !errors.As(err, &conflict) {
+		t.Errorf("stale commit error mismatch: have %v, want conflict", err)
+	}
+	batch.Delete("at://did:plc:other/com.example.score/abc")
+	if _, err := batch.Commit(ctx); !errors.Is(err, ErrRecordNotOwned) {
+		t.Errorf("foreign write error mismatch: have %v, want %v", err, ErrRecordNotOwned)
+	}
+	// Ensure unencodable records fail the batch without queueing a write
+	batch = client.NewWriteBatch()
+	batch.Create("com.example.score", 42)
+	batch.Update("at://did:plc:tester/com.example.score/abc", []int{1})
+	if batch.Len() != 0 {
+		t.Errorf("invalid writes queued: have %d, want 0", batch.Len())
+	}
+	if _, err := batch.Commit(ctx); err == nil {
+		t.Errorf("batch with invalid records committed")
+	}
+	// Ensure oversized batches are rejected as they cannot be atomic
+	batch = client.NewWriteBatch()
+	for i := 0; i <= maxWritesPerCall; i++ {
+		batch.Create("com.example.score", &testCustomRecord{Score: i})
+	}
+	if _, err := batch.Commit(ctx); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("oversized batch error mismatch: have %v, want %v", err, ErrBatchTooLarge)
+	}
+	if server.commits != 1 {
+		t.Errorf("commit count mismatch: have %d, want 1", server.commits)
+	}
+}
+
+// Tests that a chunked batch write splits the operations to the server limit and
+// reports the failing chunk, skipping the remainder.
+func TestWriteBatchCommitChunks(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		server = newTestRepoServer()
+		client = makeTestServerClient(t, server)
+	)
+	// Apply a batch spanning multiple chunks, chained via the commits
+	var (
+		total = 2*maxWritesPerCall + 1
+		keys  = 0
+	)
+	batch := client.NewWriteBatch()
+	for ; keys < total; keys++ {
+		batch.Create("com.example.score", &testCustomRecord{Score: keys}, WithRecordKey(fmt.Sprintf("key-%d", keys)))
+	}
+	refs, err := batch.CommitChunks(ctx, WithSwapCommit("commit-0"))
+	if err != nil {
+		t.Fatalf("failed to commit batch: %v", err)
+	}
+	if len(refs) != total || server.commits != 3 {
+		t.Fatalf("chunked commit mismatch: have %d refs in %d commits, want %d in 3", len(refs), server.commits, total)
+	}
+	// Apply a batch with a failure in the second chunk
+	batch = client.NewWriteBatch()
+	for i := 0; i < maxWritesPerCall; i++ {
+		batch.Create("com.example.score", &testCustomRecord{Score: keys}, WithRecordKey(fmt.Sprintf("key-%d", keys)))
+		keys++
+	}
+	batch.Create("com.example.score", &testCustomRecord{}, WithRecordKey("key-0"))
+	batch.Create("com.example.score", &testCustomRecord{}, WithRecordKey("key-new"))
+
+	refs, err = batch.CommitChunks(ctx)
+	var failure *BatchError
+	if !errors.As(err, &failure) {
+		t.Fatalf("chunk failure error mismatch: have %v, want batch error", err)
+	}
+	if failure.Chunk != 1 || len(failure.Applied) != maxWritesPerCall || len(refs) != maxWritesPerCall {
+		t.Errorf("chunk failure mismatch: have chunk %d with %d applied, want chunk 1 with %d", failure.Chunk, len(failure.Applied), maxWritesPerCall)
+	}
+	if len(server.records) != keys {
+		t.Errorf("record count mismatch: have %d, want %d", len(server.records), keys)
+	}
+}
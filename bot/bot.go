@@ -0,0 +1,242 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bot is a framework for writing Bluesky bots which respond to commands
+// addressed to them via mentions.
+package bot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karalabe/go-bluesky"
+)
+
+const (
+	// replyAttempts is the number of times to try posting a reply before giving
+	// up and reporting the failure.
+	replyAttempts = 3
+
+	// replyBackoff is the time to wait before retrying a failed reply, doubled
+	// after every subsequent failure.
+	replyBackoff = 2 * time.Second
+)
+
+// Handler is a callback to execute a command with. The returned text is posted
+// as a threaded reply to the command, or nothing if empty. Failures, including
+// failing to post the reply, are passed to the configured error hook and do not
+// stop the bot.
+type Handler func(ctx context.Context, cmd *Command) (reply string, err error)
+
+// Config is the set of options to configure a bot with.
+type Config struct {
+	Cooldown time.Duration // Minimum time between two commands of the same user (0 = unlimited)
+	Allow    []string      // Users (handle or DID) permitted to issue commands, empty for everyone
+	Deny     []string      // Users (handle or DID) forbidden from issuing commands
+
+	State       string        // File to persist the notification progress into, empty to disable
+	MinInterval time.Duration // Notification polling interval while there is activity (0 = default)
+	MaxInterval time.Duration // Notification polling interval to back off to while idle (0 = default)
+
+	OnError func(cmd *Command, err error) // Hook to report command failures to, nil to ignore
+}
+
+// Bot is a command processor on top of an authenticated Bluesky client, that
+// watches the mentions of the logged in user and executes the commands within.
+type Bot struct {
+	client  *bluesky.Client              // API client to interact with Bluesky through
+	config  *Config                      // Bot options to respect
+	watcher *bluesky.NotificationWatcher // Notification poller delivering the mentions
+
+	did    string // DID of the bot's account, to find its mentions with
+	handle string // Handle of the bot's account, to find unannotated mentions with
+
+	lock     sync.Mutex           // Lock protecting the fields below
+	commands map[string]Handler   // Registered commands to execute
+	fallback Handler              // Handler for unknown commands, nil to ignore them
+	cooldown map[string]time.Time // Time until which a user's commands are ignored
+}
+
+// New creates a bot on top of an authenticated Bluesky client.
+func New(ctx context.Context, client *bluesky.Client, config Config) (*Bot, error) {
+	self, err := client.Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := bluesky.NewNotificationWatcher(client, bluesky.WatcherConfig{
+		MinInterval: config.MinInterval,
+		MaxInterval: config.MaxInterval,
+		State:       config.State,
+	})
+	if err != nil {
+		return nil, err
+	}
+	bot := &Bot{
+		client:   client,
+		config:   &config,
+		watcher:  watcher,
+		did:      self.DID,
+		handle:   self.Handle,
+		commands: make(map[string]Handler),
+		cooldown: make(map[string]time.Time),
+	}
+	watcher.Handle(bluesky.NotificationMention, bot.process)
+	watcher.Handle(bluesky.NotificationReply, bot.process)
+
+	return bot, nil
+}
+
+// Command registers a handler to execute a command with. Command names are case
+// insensitive.
+func (b *Bot) Command(name string, handler Handler) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.commands[strings.ToLower(name)] = handler
+}
+
+// Fallback registers a handler to execute unknown commands with (e.g. to reply
+// with a help message).
+func (b *Bot) Fallback(handler Handler) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.fallback = handler
+}
+
+// Run processes the commands addressed to the bot until the context is cancelled
+// or the underlying client is closed, in which case nil is returned. Commands
+// already being processed are allowed to finish before returning.
+func (b *Bot) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-b.client.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := b.watcher.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// process handles a single notification, executing the command within and
+// replying to it if needed.
+func (b *Bot) process(ctx context.Context, notif *bluesky.Notification) error {
+	// Finish the command even if the bot is shutting down meanwhile, but stop
+	// retrying a failed reply if so
+	run := ctx
+	ctx = context.WithoutCancel(ctx)
+
+	if notif.Post == nil || notif.Author == nil || notif.Author.DID == b.did {
+		return nil
+	}
+	cmd := parseCommand(notif.Post, b.did, b.handle)
+	if cmd == nil || !b.permitted(notif.Author, time.Now()) {
+		return nil
+	}
+	b.lock.Lock()
+	handler, ok := b.commands[cmd.Name]
+	if !ok {
+		handler = b.fallback
+	}
+	b.lock.Unlock()
+
+	if handler == nil {
+		return nil
+	}
+	// Start the cooldown on dispatch, so failing commands cannot be spammed either
+	b.cool(notif.Author, time.Now())
+
+	reply, err := handler(ctx, cmd)
+	if err != nil {
+		b.report(cmd, err)
+		return nil
+	}
+	if reply != "" {
+		if err := b.reply(run, ctx, cmd, reply); err != nil {
+			b.report(cmd, err)
+			return nil
+		}
+	}
+	return nil
+}
+
+// reply posts the response to a command, retrying with an exponential backoff
+// on failure. The run context only aborts the waits between the attempts, the
+// posting itself is done with the uncancellable context.
+func (b *Bot) reply(run context.Context, ctx context.Context, cmd *Command, reply string) error {
+	var (
+		backoff = replyBackoff
+		err     error
+	)
+	for attempt := 0; attempt < replyAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-run.Done():
+				return err
+			}
+		}
+		if _, err = cmd.Post.Reply(ctx, reply); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// report passes a command failure to the configured error hook, if any.
+func (b *Bot) report(cmd *Command, err error) {
+	if b.config.OnError != nil {
+		b.config.OnError(cmd, err)
+	}
+}
+
+// permitted checks whether a user is allowed to issue a command at a given time.
+func (b *Bot) permitted(user *bluesky.User, now time.Time) bool {
+	match := func(ids []string) bool {
+		return slices.Contains(ids, user.DID) || (user.Handle != "" && slices.Contains(ids, user.Handle))
+	}
+	if match(b.config.Deny) {
+		return false
+	}
+	if len(b.config.Allow) > 0 && !match(b.config.Allow) {
+		return false
+	}
+	if b.config.Cooldown <= 0 {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return !now.Before(b.cooldown[user.DID])
+}
+
+// cool starts the cooldown of a user when one of their commands is dispatched.
+func (b *Bot) cool(user *bluesky.User, now time.Time) {
+	if b.config.Cooldown <= 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// Drop expired cooldowns every now and again to avoid leaking memory
+	if len(b.cooldown) > 1024 {
+		for did, until := range b.cooldown {
+			if !now.Before(until) {
+				delete(b.cooldown, did)
+			}
+		}
+	}
+	b.cooldown[user.DID] = now.Add(b.config.Cooldown)
+}
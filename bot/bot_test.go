@@ -0,0 +1,160 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/karalabe/go-bluesky"
+)
+
+// Tests that commands are correctly extracted from posts, both annotated and not.
+func TestParseCommand(t *testing.T) {
+	const (
+		did    = "did:plc:bot"
+		handle = "bot.example.com"
+	)
+	tests := []struct {
+		post *bluesky.Post
+		name string
+		args []string
+		text string
+	}{
+		// Annotated mention with arguments
+		{
+			post: &bluesky.Post{
+				Text:   "hey @bot.example.com Weather Budapest tomorrow",
+				Facets: []*bluesky.Facet{{Start: 4, End: 20, Mention: did}},
+			},
+			name: "weather", args: []string{"Budapest", "tomorrow"}, text: "Budapest tomorrow",
+		},
+		// Annotated mention of someone else first, then the bot
+		{
+			post: &bluesky.Post{
+				Text: "@alice.test @bot.example.com: ping",
+				Facets: []*bluesky.Facet{
+					{Start: 0, End: 11, Mention: "did:plc:alice"},
+					{Start: 12, End: 28, Mention: did},
+				},
+			},
+			name: "ping", text: "",
+		},
+		// Unannotated mention, matched by handle
+		{
+			post: &bluesky.Post{Text: "@Bot.Example.com echo  hello   world"},
+			name: "echo", args: []string{"hello", "world"}, text: "hello   world",
+		},
+		// Unannotated mention after text that changes length when lowercased
+		{
+			post: &bluesky.Post{Text: "İİİİ @bot.example.com echo hi"},
+			name: "echo", args: []string{"hi"}, text: "hi",
+		},
+		// Unannotated mention of a longer handle first, then the bot
+		{
+			post: &bluesky.Post{Text: "@bot.example.comx echo no, @bot.example.com: ping"},
+			name: "ping", text: "",
+		},
+		// Mention without a command
+		{post: &bluesky.Post{Text: "thanks @bot.example.com"}},
+
+		// Longer handles sharing the bot's as a prefix
+		{post: &bluesky.Post{Text: "@bot.example.comx echo hi"}},
+		{post: &bluesky.Post{Text: "@bot.example.com.evil echo hi"}},
+		{post: &bluesky.Post{Text: "@bot.example.com-x echo hi"}},
+
+		// No mention at all
+		{post: &bluesky.Post{Text: "echo hello"}},
+	}
+	for i, tt := range tests {
+		cmd := parseCommand(tt.post, did, handle)
+		if tt.name == "" {
+			if cmd != nil {
+				t.Errorf("test %d: unexpected command: %+v", i, cmd)
+			}
+			continue
+		}
+		if cmd == nil {
+			t.Errorf("test %d: command not found", i)
+			continue
+		}
+		if cmd.Name != tt.name || !slices.Equal(cmd.Args, tt.args) || cmd.Text != tt.text {
+			t.Errorf("test %d: command mismatch: have %q %q %q, want %q %q %q", i, cmd.Name, cmd.Args, cmd.Text, tt.name, tt.args, tt.text)
+		}
+		if cmd.Post != tt.post {
+			t.Errorf("test %d: command post mismatch", i)
+		}
+	}
+}
+
+// Tests that the allow and deny lists and the per-user cooldowns are enforced.
+func TestPermissions(t *testing.T) {
+	var (
+		alice = &bluesky.User{DID: "did:plc:alice", Handle: "alice.test"}
+		bob   = &bluesky.User{DID: "did:plc:bob", Handle: "bob.test"}
+		carol = &bluesky.User{DID: "did:plc:carol", Handle: "carol.test"}
+		now   = time.Now()
+	)
+	b := &Bot{
+		config: &Config{
+			Cooldown: time.Minute,
+			Allow:    []string{"alice.test", "did:plc:bob"},
+			Deny:     []string{"bob.test"},
+		},
+		cooldown: make(map[string]time.Time),
+	}
+	if !b.permitted(alice, now) {
+		t.Errorf("allowed user rejected")
+	}
+	if b.permitted(bob, now) {
+		t.Errorf("denied user accepted")
+	}
+	if b.permitted(carol, now) {
+		t.Errorf("unlisted user accepted")
+	}
+	// Ensure the cooldown only starts once a command was dispatched
+	if !b.permitted(alice, now.Add(time.Second)) {
+		t.Errorf("user rejected before being dispatched")
+	}
+	b.cool(alice, now)
+	if b.permitted(alice, now.Add(30*time.Second)) {
+		t.Errorf("user accepted during cooldown")
+	}
+	if !b.permitted(alice, now.Add(time.Minute)) {
+		t.Errorf("user rejected after cooldown")
+	}
+}
+
+// Tests that the cooldown starts when a command is dispatched, even if it fails.
+func TestCooldownOnFailure(t *testing.T) {
+	var (
+		alice = &bluesky.User{DID: "did:plc:alice", Handle: "alice.test"}
+		calls int
+	)
+	b := &Bot{
+		config: &Config{Cooldown: time.Minute},
+		did:    "did:plc:bot",
+		handle: "bot.example.com",
+		commands: map[string]Handler{
+			"fail": func(ctx context.Context, cmd *Command) (string, error) {
+				calls++
+				return "", errors.New("command failed")
+			},
+		},
+		cooldown: make(map[string]time.Time),
+	}
+	for i := 0; i < 3; i++ {
+		notif := &bluesky.Notification{Author: alice, Post: &bluesky.Post{Text: "@bot.example.com fail"}}
+		if err := b.process(context.Background(), notif); err != nil {
+			t.Fatalf("failed to process notification %d: %v", i, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("failing command dispatch count mismatch: have %d, want 1", calls)
+	}
+}
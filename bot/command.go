@@ -0,0 +1,97 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bot
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/karalabe/go-bluesky"
+)
+
+// Command is an instruction addressed to the bot in a post.
+type Command struct {
+	Name string   // Name of the command (first word after the mention), lowercased
+	Args []string // Whitespace separated arguments after the command name
+	Text string   // Raw text after the command name, for free-form arguments
+
+	Post *bluesky.Post // Post the command was issued in
+}
+
+// parseCommand extracts the command addressed to the bot from a post. The bot
+// is located via the mention annotations of the post, falling back to a plain
+// text match of the handle if the post is not annotated. Nil is returned if the
+// bot is not mentioned or the mention is not followed by a command.
+func parseCommand(post *bluesky.Post, did string, handle string) *Command {
+	// Locate the bot's mention and take all the text after it
+	rest, ok := "", false
+	for _, facet := range post.Facets {
+		if facet.Mention == did {
+			rest, ok = post.Text[facet.End:], true
+			break
+		}
+	}
+	if !ok {
+		idx := indexMention(post.Text, handle)
+		if idx < 0 {
+			return nil
+		}
+		rest = post.Text[idx+1+len(handle):]
+	}
+	// Split the text after the mention into a command and its arguments
+	rest = strings.TrimLeft(strings.TrimSpace(rest), ":,")
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return nil
+	}
+	return &Command{
+		Name: strings.ToLower(fields[0]),
+		Args: fields[1:],
+		Text: strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), fields[0])),
+		Post: post,
+	}
+}
+
+// indexMention returns the byte offset of the first case insensitive mention of
+// a handle within a text, or -1 if it is not mentioned. The offset points into
+// the original text, as lowercasing it might change the byte length of it.
+//
+// The handle must be followed by the end of the text, whitespace or punctuation
+// not continuing the domain, so that longer handles sharing its prefix (e.g.
+// @bot.example.comx or @bot.example.com.evil) are not taken as mentions.
+func indexMention(text string, handle string) int {
+	for i := 0; i+1+len(handle) <= len(text); i++ {
+		end := i + 1 + len(handle)
+		if text[i] == '@' && strings.EqualFold(text[i+1:end], handle) && mentionEnds(text[end:]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// mentionEnds checks whether the text following a handle terminates the mention.
+func mentionEnds(rest string) bool {
+	if rest == "" {
+		return true
+	}
+	r, size := utf8.DecodeRuneInString(rest)
+	switch {
+	case r == '.':
+		// A dot ends the mention only if it does not start another domain label
+		next, _ := utf8.DecodeRuneInString(rest[size:])
+		return len(rest) == size || !isHandleRune(next)
+	case isHandleRune(r):
+		return false
+	default:
+		return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	}
+}
+
+// isHandleRune checks whether a character may appear within a handle's domain
+// labels.
+func isHandleRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-'
+}
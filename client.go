@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -42,11 +43,16 @@ var (
 	// ErrSessionExpired is returned from any API call if the underlying session
 	// has expired and a new login from scratch is required.
 	ErrSessionExpired = errors.New("session expired")
+
+	// ErrNotLoggedIn is returned from any API call that acts on behalf of a user
+	// if the client was not authenticated yet.
+	ErrNotLoggedIn = errors.New("not logged in")
 )
 
 // Client is an API client attached to (and authenticated to) a Bluesky PDS instance.
 type Client struct {
-	client *xrpc.Client // Underlying XRPC transport connected to the API
+	client *xrpc.Client  // Underlying XRPC transport connected to the API
+	closed chan struct{} // Notification channel closed when the client is terminated
 
 	jwtLock          sync.RWMutex                // Lock protecting the following JWT auth fields
 	jwtCurrentExpire time.Time                   // Expiration time for the current JWT token
@@ -77,6 +83,7 @@ func DialWithClient(ctx context.Context, server string, client *http.Client) (*C
 	}
 	return &Client{
 		client: local,
+		closed: make(chan struct{}),
 	}, nil
 }
 
@@ -142,9 +149,21 @@ func (c *Client) Close() error {
 
 		c.jwtRefresherStop = nil
 	}
+	// Notify any long running tasks built on top of the client to stop
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
 	return nil
 }
 
+// Done returns a channel that is closed when the client is terminated, which
+// long running tasks built on top of the client can use to shut down.
+func (c *Client) Done() <-chan struct{} {
+	return c.closed
+}
+
 // refresher is an infinite loop that periodically checks the validity of the JWT
 // tokens and runs a refresh cycle if they are getting close to expiration.
 func (c *Client) refresher() {
@@ -286,6 +305,39 @@ func (c *Client) refreshJWT(async bool) error {
 	return nil
 }
 
+// userDID returns the DID of the logged in user, or an error if the client is
+// not authenticated.
+func (c *Client) userDID() (string, error) {
+	c.jwtLock.RLock()
+	defer c.jwtLock.RUnlock()
+
+	if c.client.Auth == nil {
+		return "", ErrNotLoggedIn
+	}
+	return c.client.Auth.Did, nil
+}
+
+// userHandle returns the normalized handle of the logged in user, or an empty
+// string if the client is not logged in.
+func (c *Client) userHandle() string {
+	c.jwtLock.RLock()
+	defer c.jwtLock.RUnlock()
+
+	if c.client.Auth == nil {
+		return ""
+	}
+	return strings.ToLower(c.client.Auth.Handle)
+}
+
+// Self retrieves the profile of the logged in user.
+func (c *Client) Self(ctx context.Context) (*Profile, error) {
+	did, err := c.userDID()
+	if err != nil {
+		return nil, err
+	}
+	return c.FetchProfile(ctx, did)
+}
+
 // CustomCall is a wildcard method for executing atproto API calls that are not
 // (yet?) implemented by this library. The user needs to provide a callback that
 // will receive an XRPC client to do direct atproto calls through.
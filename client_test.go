@@ -6,8 +6,13 @@ package bluesky
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
@@ -60,6 +65,51 @@ func makeTestClientWithLogin(t *testing.T) *Client {
 	return client
 }
 
+// makeTestServerClient returns a Client against a fake server, authenticated as
+// did:plc:tester (tester.test) without any real session. The server is torn down when the test
+// finishes.
+func makeTestServerClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return &Client{
+		client: &xrpc.Client{
+			Client: srv.Client(),
+			Host:   srv.URL,
+			Auth:   &xrpc.AuthInfo{Did: "did:plc:tester", Handle: "tester.test"},
+		},
+		closed: make(chan struct{}),
+	}
+}
+
+// serveTestPage responds with a page of a fake list of the given length, using
+// the item indices as cursors. The items are placed under the given field, along
+// with any extra fields of the response.
+func serveTestPage(w http.ResponseWriter, r *http.Request, total int, field string, item func(i int) any, extra map[string]any) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	items := []any{}
+	for i := start; i < min(start+limit, total); i++ {
+		items = append(items, item(i))
+	}
+	res := map[string]any{field: items}
+	for key, value := range extra {
+		res[key] = value
+	}
+	if start+limit < total {
+		res["cursor"] = strconv.Itoa(start + limit)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// testUser creates the JSON view of the i-th fake user of a paginated list.
+func testUser(i int) any {
+	return map[string]string{"did": fmt.Sprintf("did:plc:user%d", i), "handle": fmt.Sprintf("user%d.test", i)}
+}
+
 // getenvOrSkip fetches the value of env or skips the test if env is not set.
 func getenvOrSkip(t *testing.T, env string) string {
 	t.Helper()
@@ -0,0 +1,411 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCrawlWorkers is the number of concurrent user expansions to run if
+	// the crawler config does not specify it.
+	defaultCrawlWorkers = 4
+
+	// defaultCrawlCheckpointInterval is the time between two checkpoints of the
+	// crawler state if the crawler config does not specify it.
+	defaultCrawlCheckpointInterval = time.Minute
+)
+
+// errCrawlLimitReached is an internal error to signal that the node limit of
+// the crawl was reached and it should terminate gracefully.
+var errCrawlLimitReached = errors.New("crawl node limit reached")
+
+// CrawlDirection defines which edges of the social graph to follow when crawling.
+type CrawlDirection int
+
+const (
+	CrawlFollowers CrawlDirection = 1 << iota // Expand users through their followers
+	CrawlFollowees                            // Expand users through their followees
+
+	CrawlBoth = CrawlFollowers | CrawlFollowees // Expand users in both directions
+)
+
+// CrawlerConfig is the set of options to configure a social graph crawl with.
+type CrawlerConfig struct {
+	Direction CrawlDirection // Social graph edges to traverse, defaults to followers
+	MaxDepth  int            // Maximum hops from the seeds to crawl (0 = unlimited)
+	MaxNodes  int            // Maximum number of users to discover (0 = unlimited)
+	Workers   int            // Number of users to expand concurrently (0 = default)
+
+	Checkpoint         string        // File to persist the crawl state into, empty to disable
+	CheckpointInterval time.Duration // Time between two checkpoints (0 = default)
+}
+
+// CrawlNode is a user discovered during a social graph crawl.
+type CrawlNode struct {
+	User   *User  // User discovered by the crawler
+	Depth  int    // Number of hops from the seed this user was found through
+	Parent string // DID of the user this one was discovered through, empty for seeds
+}
+
+// crawlTask is a user scheduled for expansion during a social graph crawl.
+type crawlTask struct {
+	DID   string `json:"did"`
+	Depth int    `json:"depth"`
+}
+
+// crawlCheckpoint is the persisted state of a social graph crawl.
+type crawlCheckpoint struct {
+	Pending []crawlTask `json:"pending"` // Users not yet (fully) expanded
+	Seen    []string    `json:"seen"`    // Users already discovered
+}
+
+// GraphCrawler is a breadth-first traverser of the Bluesky social graph.
+type GraphCrawler struct {
+	client *Client        // API client to crawl the social graph through
+	config *CrawlerConfig // Crawl options with the defaults filled in
+
+	visiting sync.Mutex // Lock serializing the visitor callbacks
+
+	lock     sync.Mutex           // Lock protecting the crawl state below
+	cond     *sync.Cond           // Notifier for tasks becoming available or finishing
+	queue    []crawlTask          // Users waiting to be expanded, in breadth-first order
+	active   map[string]crawlTask // Users being expanded right now
+	seen     map[string]struct{}  // Users already discovered and delivered
+	inflight map[string]struct{}  // Users discovered, but still being delivered
+	resumed  bool                 // Whether the state was loaded from a checkpoint
+	failure  error                // First error that aborted the crawl
+	cancel   func()               // Context cancellation to tear down running expansions
+}
+
+// NewGraphCrawler creates a social graph crawler on top of an API client. If
+// the config specifies a checkpoint file which exists, the crawler state will be
+// loaded from it and the crawl resumed from where it left off.
+func NewGraphCrawler(client *Client, config CrawlerConfig) (*GraphCrawler, error) {
+	// Fill in any defaults the user did not specify
+	if config.Direction == 0 {
+		config.Direction = CrawlFollowers
+	}
+	if config.Workers <= 0 {
+		config.Workers = defaultCrawlWorkers
+	}
+	if config.CheckpointInterval <= 0 {
+		config.CheckpointInterval = defaultCrawlCheckpointInterval
+	}
+	crawler := &GraphCrawler{
+		client:   client,
+		config:   &config,
+		active:   make(map[string]crawlTask),
+		seen:     make(map[string]struct{}),
+		inflight: make(map[string]struct{}),
+	}
+	crawler.cond = sync.NewCond(&crawler.lock)
+
+	// If a previous crawl was checkpointed, resume it
+	if config.Checkpoint != "" {
+		blob, err := os.ReadFile(config.Checkpoint)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// No previous crawl, start from scratch
+		case err != nil:
+			return nil, err
+		default:
+			var checkpoint crawlCheckpoint
+			if err := json.Unmarshal(blob, &checkpoint); err != nil {
+				return nil, err
+			}
+			crawler.queue = checkpoint.Pending
+			for _, did := range checkpoint.Seen {
+				crawler.seen[did] = struct{}{}
+			}
+			crawler.resumed = true
+		}
+	}
+	return crawler, nil
+}
+
+// Crawl traverses the social graph breadth-first starting from the given seeds
+// (Bluesky handles or atproto DIDs), invoking the visitor callback for every
+// newly discovered user at least once. The visitor is called sequentially, so it
+// does not need to be thread safe. If the visitor returns an error, the crawl is
+// aborted and the error returned.
+//
+// If the crawler was resumed from a checkpoint, the seeds are ignored and the
+// crawl continues from the persisted state. Note, users discovered since the
+// last checkpoint before a crash might be delivered again after resumption, so
+// the visitor must be idempotent.
+//
+// The checkpoint file (if configured) is removed when the crawl finishes, and it
+// is retained if the crawl is interrupted, fails or reaches the node limit.
+func (g *GraphCrawler) Crawl(ctx context.Context, visit func(node *CrawlNode) error, seeds ...string) error {
+	// Deliver the seeds first if we're starting a fresh crawl
+	if !g.resumed {
+		for _, seed := range seeds {
+			profile, err := g.client.FetchProfile(ctx, seed)
+			if err != nil {
+				return err
+			}
+			if _, ok := g.seen[profile.DID]; ok {
+				continue
+			}
+			if g.config.MaxNodes > 0 && len(g.seen) >= g.config.MaxNodes {
+				break
+			}
+			user := &User{
+				client:    g.client,
+				Handle:    profile.Handle,
+				DID:       profile.DID,
+				Name:      profile.Name,
+				Bio:       profile.Bio,
+				AvatarURL: profile.AvatarURL,
+			}
+			if err := visit(&CrawlNode{User: user}); err != nil {
+				return err
+			}
+			g.seen[profile.DID] = struct{}{}
+			g.queue = append(g.queue, crawlTask{DID: profile.DID})
+		}
+		g.resumed = true
+	}
+	// Crawl the graph until all users are expanded, the node limit is reached
+	// or an error occurs
+	g.failure = nil
+
+	parent := ctx
+	ctx, g.cancel = context.WithCancel(parent)
+	defer g.cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-parent.Done():
+			g.abort(parent.Err())
+		case <-done:
+		}
+	}()
+	var (
+		workers sync.WaitGroup
+		ticker  = time.NewTicker(g.config.CheckpointInterval)
+		stopped = make(chan struct{})
+	)
+	defer ticker.Stop()
+
+	for i := 0; i < g.config.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			g.worker(ctx, visit)
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			if err := g.checkpoint(); err != nil {
+				g.abort(err)
+			}
+		case <-stopped:
+			running = false
+		}
+	}
+	// All workers stopped, figure out why and persist the state if needed
+	g.lock.Lock()
+	failure := g.failure
+	g.lock.Unlock()
+
+	switch {
+	case failure == nil:
+		if g.config.Checkpoint != "" {
+			if err := os.Remove(g.config.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+
+	case errors.Is(failure, errCrawlLimitReached):
+		return g.checkpoint()
+
+	default:
+		if err := g.checkpoint(); err != nil {
+			return err
+		}
+		return failure
+	}
+}
+
+// abort terminates a running crawl with the given error, unless it was already
+// aborted with an earlier one.
+func (g *GraphCrawler) abort(err error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.failure == nil {
+		g.failure = err
+	}
+	g.cancel()
+	g.cond.Broadcast()
+}
+
+// worker is a crawler thread which keeps picking users from the task queue to
+// expand, until the crawl is finished or aborted.
+func (g *GraphCrawler) worker(ctx context.Context, visit func(node *CrawlNode) error) {
+	for {
+		// Wait until a task is available or the crawl terminates
+		g.lock.Lock()
+		for len(g.queue) == 0 && len(g.active) > 0 && g.failure == nil {
+			g.cond.Wait()
+		}
+		if g.failure != nil || len(g.queue) == 0 {
+			// Crawl either aborted or finished, wake up all the other workers
+			g.cond.Broadcast()
+			g.lock.Unlock()
+			return
+		}
+		task := g.queue[0]
+		g.queue = g.queue[1:]
+		g.active[task.DID] = task
+		g.lock.Unlock()
+
+		// Expand the user's social graph edges and update the crawl state
+		err := g.expand(ctx, task, visit)
+
+		g.lock.Lock()
+		delete(g.active, task.DID)
+		if err != nil {
+			// Expansion failed, reschedule the task for a future resumption
+			g.queue = append([]crawlTask{task}, g.queue...)
+		}
+		g.cond.Broadcast()
+		g.lock.Unlock()
+
+		if err != nil {
+			g.abort(err)
+		}
+	}
+}
+
+// expand crawls the configured social graph edges of a single user, delivering
+// all newly discovered users to the visitor and scheduling them for expansion.
+func (g *GraphCrawler) expand(ctx context.Context, task crawlTask, visit func(node *CrawlNode) error) error {
+	profile := &Profile{client: g.client, DID: task.DID}
+
+	for _, dir := range []CrawlDirection{CrawlFollowers, CrawlFollowees} {
+		if g.config.Direction&dir == 0 {
+			continue
+		}
+		var cursor string
+		for {
+			// Stream the users in the requested direction, resuming from the
+			// last fully delivered page on throttling
+			var stream *Stream[*User]
+			if dir == CrawlFollowers {
+				stream = profile.StreamFollowersFrom(ctx, cursor)
+			} else {
+				stream = profile.StreamFolloweesFrom(ctx, cursor)
+			}
+			if err := g.deliver(task, stream.Items(), visit); err != nil {
+				return err // stream is torn down by the crawl abort
+			}
+			err := <-stream.Err()
+			if err == nil {
+				break
+			}
+			if !waitThrottled(ctx, err) {
+				return err
+			}
+			cursor = stream.Cursor()
+		}
+	}
+	return nil
+}
+
+// deliver consumes a stream of users discovered through an expanded one, passing
+// the new ones to the visitor and scheduling them for expansion.
+//
+// Users are only marked as seen after they were successfully visited. Until then
+// they are tracked as in flight, which are not checkpointed, but their parent is
+// still pending, so a resumed crawl rediscovers them.
+func (g *GraphCrawler) deliver(task crawlTask, userc <-chan *User, visit func(node *CrawlNode) error) error {
+	for user := range userc {
+		g.lock.Lock()
+		if g.failure != nil {
+			g.lock.Unlock()
+			return g.failure
+		}
+		_, seen := g.seen[user.DID]
+		_, inflight := g.inflight[user.DID]
+		if seen || inflight {
+			g.lock.Unlock()
+			continue
+		}
+		if g.config.MaxNodes > 0 && len(g.seen)+len(g.inflight) >= g.config.MaxNodes {
+			g.lock.Unlock()
+			return errCrawlLimitReached
+		}
+		g.inflight[user.DID] = struct{}{}
+		g.lock.Unlock()
+
+		// Deliver the user outside of the crawl lock, so other workers are not
+		// blocked by a slow visitor, but still one at a time
+		g.visiting.Lock()
+		err := visit(&CrawlNode{User: user, Depth: task.Depth + 1, Parent: task.DID})
+		g.visiting.Unlock()
+
+		g.lock.Lock()
+		delete(g.inflight, user.DID)
+		if err == nil {
+			g.seen[user.DID] = struct{}{}
+			if g.config.MaxDepth == 0 || task.Depth+1 < g.config.MaxDepth {
+				g.queue = append(g.queue, crawlTask{DID: user.DID, Depth: task.Depth + 1})
+				g.cond.Broadcast()
+			}
+		}
+		g.lock.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkpoint persists the current state of the crawl into the configured file,
+// if any. Users being actively expanded are persisted as pending.
+func (g *GraphCrawler) checkpoint() error {
+	if g.config.Checkpoint == "" {
+		return nil
+	}
+	// Snapshot the crawl state under the lock
+	g.lock.Lock()
+	checkpoint := &crawlCheckpoint{
+		Pending: make([]crawlTask, 0, len(g.active)+len(g.queue)),
+		Seen:    make([]string, 0, len(g.seen)),
+	}
+	for _, task := range g.active {
+		checkpoint.Pending = append(checkpoint.Pending, task)
+	}
+	checkpoint.Pending = append(checkpoint.Pending, g.queue...)
+	for did := range g.seen {
+		checkpoint.Seen = append(checkpoint.Seen, did)
+	}
+	g.lock.Unlock()
+
+	// Write the state out atomically to avoid corrupting it on a crash
+	blob, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(g.config.Checkpoint, blob)
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests that a depth limited crawl only reaches the expected users.
+func TestCrawlDepthLimit(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+	)
+	crawler, err := NewGraphCrawler(client, CrawlerConfig{
+		Direction: CrawlFollowees,
+		MaxDepth:  1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create crawler: %v", err)
+	}
+	var nodes []*CrawlNode
+	if err := crawler.Crawl(ctx, func(node *CrawlNode) error {
+		nodes = append(nodes, node)
+		return nil
+	}, testHandleTester); err != nil {
+		t.Fatalf("failed to crawl social graph: %v", err)
+	}
+	// The tester only follows the lib's author, so that's all we should find
+	if len(nodes) != 2 {
+		t.Fatalf("crawled node count mismatch: have %d, want %d", len(nodes), 2)
+	}
+	if nodes[0].User.DID != testDIDTester || nodes[0].Depth != 0 || nodes[0].Parent != "" {
+		t.Errorf("seed node mismatch: have %v at depth %d via %q", nodes[0].User, nodes[0].Depth, nodes[0].Parent)
+	}
+	if nodes[1].User.DID != testDIDPeter || nodes[1].Depth != 1 || nodes[1].Parent != testDIDTester {
+		t.Errorf("followee node mismatch: have %v at depth %d via %q", nodes[1].User, nodes[1].Depth, nodes[1].Parent)
+	}
+}
+
+// Tests that a crawl stopped by the node limit can be resumed from its checkpoint
+// without delivering users again.
+func TestCrawlCheckpointResume(t *testing.T) {
+	var (
+		client     = makeTestClientWithLogin(t)
+		ctx        = context.Background()
+		checkpoint = filepath.Join(t.TempDir(), "crawl.json")
+	)
+	// Crawl a few users from the tester and ensure the checkpoint is retained
+	crawler, err := NewGraphCrawler(client, CrawlerConfig{
+		MaxDepth:   2,
+		MaxNodes:   10,
+		Checkpoint: checkpoint,
+	})
+	if err != nil {
+		t.Fatalf("failed to create crawler: %v", err)
+	}
+	seen := make(map[string]bool)
+	if err := crawler.Crawl(ctx, func(node *CrawlNode) error {
+		seen[node.User.DID] = true
+		return nil
+	}, testDIDTester); err != nil {
+		t.Fatalf("failed to crawl social graph: %v", err)
+	}
+	if len(seen) != 10 {
+		t.Fatalf("crawled node count mismatch: have %d, want %d", len(seen), 10)
+	}
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Fatalf("checkpoint not retained: %v", err)
+	}
+	// Resume the crawl with a higher limit and ensure no duplicates arrive
+	crawler, err = NewGraphCrawler(client, CrawlerConfig{
+		MaxDepth:   2,
+		MaxNodes:   20,
+		Checkpoint: checkpoint,
+	})
+	if err != nil {
+		t.Fatalf("failed to resume crawler: %v", err)
+	}
+	if err := crawler.Crawl(ctx, func(node *CrawlNode) error {
+		if seen[node.User.DID] {
+			t.Errorf("user %v delivered twice", node.User)
+		}
+		seen[node.User.DID] = true
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to resume social graph crawl: %v", err)
+	}
+}
+
+// Tests that a throttled expansion resumes from the last delivered page instead
+// of restarting the user's edge list from scratch.
+func TestCrawlThrottleResume(t *testing.T) {
+	const followers = 250
+
+	var (
+		lock      sync.Mutex
+		requests  = make(map[string]int)
+		throttled bool
+	)
+	client := makeTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		query := r.URL.Query()
+		if query.Get("actor") != "did:plc:seed" {
+			serveTestPage(w, r, 0, "followers", testUser, map[string]any{"subject": map[string]string{"did": query.Get("actor"), "handle": "user.test"}})
+			return
+		}
+		cursor := query.Get("cursor")
+		requests[cursor]++
+
+		// Throttle the second page once, resetting the limit right away
+		if cursor == "100" && !throttled {
+			throttled = true
+			w.Header().Set("ratelimit-limit", "1")
+			w.Header().Set("ratelimit-reset", strconv.FormatInt(time.Now().Unix(), 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "RateLimitExceeded"})
+			return
+		}
+		serveTestPage(w, r, followers, "followers", testUser, map[string]any{"subject": map[string]string{"did": "did:plc:seed", "handle": "seed.test"}})
+	}))
+	crawler, err := NewGraphCrawler(client, CrawlerConfig{MaxDepth: 2})
+	if err != nil {
+		t.Fatalf("failed to create crawler: %v", err)
+	}
+	// Start the crawl as if resumed with only the seed pending
+	crawler.queue = []crawlTask{{DID: "did:plc:seed"}}
+	crawler.seen["did:plc:seed"] = struct{}{}
+	crawler.resumed = true
+
+	seen := make(map[string]bool)
+	if err := crawler.Crawl(context.Background(), func(node *CrawlNode) error {
+		if seen[node.User.DID] {
+			t.Errorf("user %v delivered twice", node.User)
+		}
+		seen[node.User.DID] = true
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to crawl social graph: %v", err)
+	}
+	if len(seen) != followers {
+		t.Errorf("crawled node count mismatch: have %d, want %d", len(seen), followers)
+	}
+	if !throttled {
+		t.Fatalf("crawl was not throttled")
+	}
+	if requests[""] != 1 || requests["100"] != 2 || requests["200"] != 1 {
+		t.Errorf("page requests mismatch: have %v", requests)
+	}
+}
+
+// Tests that a user whose visit failed is not marked as seen, so it is delivered
+// again when the crawl is resumed from its checkpoint.
+func TestCrawlVisitFailureResume(t *testing.T) {
+	var (
+		client = makeTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveTestPage(w, r, 5, "followers", testUser, map[string]any{"subject": map[string]string{"did": "did:plc:seed", "handle": "seed.test"}})
+		}))
+		checkpoint = filepath.Join(t.TempDir(), "crawl.json")
+		failure    = errors.New("visit failed")
+	)
+	crawler, err := NewGraphCrawler(client, CrawlerConfig{MaxDepth: 1, Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("failed to create crawler: %v", err)
+	}
+	// Start the crawl as if resumed with only the seed pending
+	crawler.queue = []crawlTask{{DID: "did:plc:seed"}}
+	crawler.seen["did:plc:seed"] = struct{}{}
+	crawler.resumed = true
+
+	var visited []string
+	if err := crawler.Crawl(context.Background(), func(node *CrawlNode) error {
+		if node.User.DID == "did:plc:user2" {
+			return failure
+		}
+		visited = append(visited, node.User.DID)
+		return nil
+	}); !errors.Is(err, failure) {
+		t.Fatalf("crawl error mismatch: have %v, want %v", err, failure)
+	}
+	// Resume the crawl and ensure the failed user is delivered, the others not
+	crawler, err = NewGraphCrawler(client, CrawlerConfig{MaxDepth: 1, Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("failed to resume crawler: %v", err)
+	}
+	if err := crawler.Crawl(context.Background(), func(node *CrawlNode) error {
+		visited = append(visited, node.User.DID)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to resume social graph crawl: %v", err)
+	}
+	want := []string{"did:plc:user0", "did:plc:user1", "did:plc:user2", "did:plc:user3", "did:plc:user4"}
+	if !slices.Equal(visited, want) {
+		t.Errorf("visited users mismatch: have %v, want %v", visited, want)
+	}
+}
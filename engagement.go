@@ -0,0 +1,293 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// engagement defines the record type and post fields involved in a specific
+// kind of interaction with a post (e.g. like, repost).
+type engagement struct {
+	collection string                                            // Collection to store the records in
+	record     func(subject *atproto.RepoStrongRef) lexutil.CBOR // Record constructor for a subject
+	viewer     func(post *Post) *string                          // Viewer field tracking the record
+	counter    func(post *Post) *uint                            // Counter field tracking the engagements
+}
+
+var (
+	// engagementLike is the interaction of liking a post.
+	engagementLike = &engagement{
+		collection: "app.bsky.feed.like",
+		record: func(subject *atproto.RepoStrongRef) lexutil.CBOR {
+			return &bsky.FeedLike{Subject: subject, CreatedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+		},
+		viewer:  func(post *Post) *string { return &post.Viewer.Like },
+		counter: func(post *Post) *uint { return &post.LikeCount },
+	}
+	// engagementRepost is the interaction of reposting a post.
+	engagementRepost = &engagement{
+		collection: "app.bsky.feed.repost",
+		record: func(subject *atproto.RepoStrongRef) lexutil.CBOR {
+			return &bsky.FeedRepost{Subject: subject, CreatedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+		},
+		viewer:  func(post *Post) *string { return &post.Viewer.Repost },
+		counter: func(post *Post) *uint { return &post.RepostCount },
+	}
+)
+
+// Like marks a post as liked by the logged in user, returning a reference to the
+// like record. If the post is already liked, the existing record is returned.
+func (c *Client) Like(ctx context.Context, uri string) (*RecordRef, error) {
+	return (&Post{client: c, URI: uri}).engage(ctx, engagementLike)
+}
+
+// Unlike removes the logged in user's like from a post. If the post is not liked,
+// the method is a noop.
+func (c *Client) Unlike(ctx context.Context, uri string) error {
+	return (&Post{client: c, URI: uri}).disengage(ctx, engagementLike)
+}
+
+// Repost reposts a post on behalf of the logged in user, returning a reference to
+// the repost record. If the post is already reposted, the existing record is
+// returned.
+func (c *Client) Repost(ctx context.Context, uri string) (*RecordRef, error) {
+	return (&Post{client: c, URI: uri}).engage(ctx, engagementRepost)
+}
+
+// Unrepost removes the logged in user's repost of a post. If the post is not
+// reposted, the method is a noop.
+func (c *Client) Unrepost(ctx context.Context, uri string) error {
+	return (&Post{client: c, URI: uri}).disengage(ctx, engagementRepost)
+}
+
+// Like marks the post as liked by the logged in user, returning a reference to
+// the like record. If the post is already liked, the existing record is returned.
+func (p *Post) Like(ctx context.Context) (*RecordRef, error) {
+	return p.engage(ctx, engagementLike)
+}
+
+// Unlike removes the logged in user's like from the post. If the post is not
+// liked, the method is a noop.
+func (p *Post) Unlike(ctx context.Context) error {
+	return p.disengage(ctx, engagementLike)
+}
+
+// Repost reposts the post on behalf of the logged in user, returning a reference
+// to the repost record. If the post is already reposted, the existing record is
+// returned.
+func (p *Post) Repost(ctx context.Context) (*RecordRef, error) {
+	return p.engage(ctx, engagementRepost)
+}
+
+// Unrepost removes the logged in user's repost of the post. If the post is not
+// reposted, the method is a noop.
+func (p *Post) Unrepost(ctx context.Context) error {
+	return p.disengage(ctx, engagementRepost)
+}
+
+// engage creates an engagement record targeting the post, unless the viewer state
+// already tracks one. The post's viewer state and counters are updated.
+func (p *Post) engage(ctx context.Context, kind *engagement) (*RecordRef, error) {
+	// If the post is lacking its content hash, resolve it from the server
+	if p.CID == "" {
+		post, err := p.client.FetchPost(ctx, p.URI)
+		if err != nil {
+			return nil, err
+		}
+		*p = *post
+	}
+	// If the interaction was already done, return the existing record
+	if uri := *kind.viewer(p); uri != "" {
+		return p.client.fetchRecordRef(ctx, uri)
+	}
+	ref, err := p.client.createRecord(ctx, kind.collection, "", kind.record(&atproto.RepoStrongRef{Uri: p.URI, Cid: p.CID}))
+	if err != nil {
+		return nil, err
+	}
+	*kind.viewer(p) = ref.URI
+	*kind.counter(p)++
+
+	return ref, nil
+}
+
+// disengage deletes the engagement record targeting the post, as tracked by the
+// viewer state. The post's viewer state and counters are updated.
+func (p *Post) disengage(ctx context.Context, kind *engagement) error {
+	// If the viewer state is clean, double check with the server in case the post
+	// metadata is stale
+	if *kind.viewer(p) == "" {
+		post, err := p.client.FetchPost(ctx, p.URI)
+		if err != nil {
+			return err
+		}
+		*p = *post
+	}
+	uri := *kind.viewer(p)
+	if uri == "" {
+		return nil
+	}
+	if err := p.client.DeleteRecord(ctx, uri); err != nil {
+		return err
+	}
+	*kind.viewer(p) = ""
+	if *kind.counter(p) > 0 {
+		*kind.counter(p)--
+	}
+	return nil
+}
+
+// Engager is a user who interacted with a post (liked, reposted or quoted it),
+// along with the details of the interaction.
+type Engager struct {
+	*User // User who interacted with the post
+
+	CreatedAt time.Time // Time of the interaction, zero if the server does not report it
+	Quote     *Post     // Post quoting the original one, nil for likes and reposts
+}
+
+// StreamLikers gradually resolves the list of users who liked the post, feeding
+// the results into a channel. The interaction time is the creation time of the
+// like record.
+func (p *Post) StreamLikers(ctx context.Context, opts ...PageOption) (<-chan *Engager, <-chan error) {
+	stream := p.StreamLikersFrom(ctx, "", opts...)
+	return stream.Items(), stream.Err()
+}
+
+// StreamLikersFrom gradually resolves the list of users who liked the post,
+// starting from a pagination cursor (empty to start from the beginning, or from
+// the cursor set via WithCursor, if any).
+func (p *Post) StreamLikersFrom(ctx context.Context, cursor string, opts ...PageOption) *Stream[*Engager] {
+	return newStream(ctx, p.fetchLikers, withStartCursor(cursor, opts))
+}
+
+// IterLikers returns an iterator over the full list of users who liked the post,
+// retrieving them page by page as the iteration progresses.
+func (p *Post) IterLikers(ctx context.Context, opts ...PageOption) iter.Seq2[*Engager, error] {
+	return iterate(ctx, p.fetchLikers, opts)
+}
+
+// engagementParams assembles the query parameters of a page of engagers of the
+// post, omitting the unset ones, since the server rejects an empty CID.
+func (p *Post) engagementParams(cursor string, limit int) map[string]interface{} {
+	params := map[string]interface{}{
+		"uri":   p.URI,
+		"limit": min(limit, 100),
+	}
+	if p.CID != "" {
+		params["cid"] = p.CID
+	}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+	return params
+}
+
+// fetchLikers retrieves a single page of users who liked the post.
+func (p *Post) fetchLikers(ctx context.Context, cursor string, limit int) ([]*Engager, string, error) {
+	var res bsky.FeedGetLikes_Output
+	if err := p.client.client.Do(ctx, xrpc.Query, "", "app.bsky.feed.getLikes", p.engagementParams(cursor, limit), nil, &res); err != nil {
+		return nil, "", err
+	}
+	likers := make([]*Engager, 0, len(res.Likes))
+	for _, like := range res.Likes {
+		likers = append(likers, &Engager{
+			User:      newUserFromView(p.client, like.Actor),
+			CreatedAt: parseTime(&like.CreatedAt),
+		})
+	}
+	if res.Cursor == nil {
+		return likers, "", nil
+	}
+	return likers, *res.Cursor, nil
+}
+
+// StreamReposters gradually resolves the list of users who reposted the post,
+// feeding the results into a channel.
+//
+// Note, the server does not report when the reposts were made, so the interaction
+// time of the engagers is left zero.
+func (p *Post) StreamReposters(ctx context.Context, opts ...PageOption) (<-chan *Engager, <-chan error) {
+	stream := p.StreamRepostersFrom(ctx, "", opts...)
+	return stream.Items(), stream.Err()
+}
+
+// StreamRepostersFrom gradually resolves the list of users who reposted the post,
+// starting from a pagination cursor (empty to start from the beginning, or from
+// the cursor set via WithCursor, if any).
+func (p *Post) StreamRepostersFrom(ctx context.Context, cursor string, opts ...PageOption) *Stream[*Engager] {
+	return newStream(ctx, p.fetchReposters, withStartCursor(cursor, opts))
+}
+
+// IterReposters returns an iterator over the full list of users who reposted the
+// post, retrieving them page by page as the iteration progresses.
+func (p *Post) IterReposters(ctx context.Context, opts ...PageOption) iter.Seq2[*Engager, error] {
+	return iterate(ctx, p.fetchReposters, opts)
+}
+
+// fetchReposters retrieves a single page of users who reposted the post.
+func (p *Post) fetchReposters(ctx context.Context, cursor string, limit int) ([]*Engager, string, error) {
+	var res bsky.FeedGetRepostedBy_Output
+	if err := p.client.client.Do(ctx, xrpc.Query, "", "app.bsky.feed.getRepostedBy", p.engagementParams(cursor, limit), nil, &res); err != nil {
+		return nil, "", err
+	}
+	reposters := make([]*Engager, 0, len(res.RepostedBy))
+	for _, user := range res.RepostedBy {
+		reposters = append(reposters, &Engager{User: newUserFromView(p.client, user)})
+	}
+	if res.Cursor == nil {
+		return reposters, "", nil
+	}
+	return reposters, *res.Cursor, nil
+}
+
+// StreamQuotes gradually resolves the list of users who quoted the post, feeding
+// the results into a channel. The interaction time is the creation time of the
+// quoting post, which is also attached to the engager.
+func (p *Post) StreamQuotes(ctx context.Context, opts ...PageOption) (<-chan *Engager, <-chan error) {
+	stream := p.StreamQuotesFrom(ctx, "", opts...)
+	return stream.Items(), stream.Err()
+}
+
+// StreamQuotesFrom gradually resolves the list of users who quoted the post,
+// starting from a pagination cursor (empty to start from the beginning, or from
+// the cursor set via WithCursor, if any).
+func (p *Post) StreamQuotesFrom(ctx context.Context, cursor string, opts ...PageOption) *Stream[*Engager] {
+	return newStream(ctx, p.fetchQuotes, withStartCursor(cursor, opts))
+}
+
+// IterQuotes returns an iterator over the full list of users who quoted the post,
+// retrieving them page by page as the iteration progresses.
+func (p *Post) IterQuotes(ctx context.Context, opts ...PageOption) iter.Seq2[*Engager, error] {
+	return iterate(ctx, p.fetchQuotes, opts)
+}
+
+// fetchQuotes retrieves a single page of users who quoted the post.
+func (p *Post) fetchQuotes(ctx context.Context, cursor string, limit int) ([]*Engager, string, error) {
+	var res bsky.FeedGetQuotes_Output
+	if err := p.client.client.Do(ctx, xrpc.Query, "", "app.bsky.feed.getQuotes", p.engagementParams(cursor, limit), nil, &res); err != nil {
+		return nil, "", err
+	}
+	quoters := make([]*Engager, 0, len(res.Posts))
+	for _, view := range res.Posts {
+		quote := newPostFromView(p.client, view)
+		quoters = append(quoters, &Engager{
+			User:      quote.Author,
+			CreatedAt: quote.CreatedAt,
+			Quote:     quote,
+		})
+	}
+	if res.Cursor == nil {
+		return quoters, "", nil
+	}
+	return quoters, *res.Cursor, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// fetchTestPostURI retrieves the URI of one of the stable posts of the tester.
+func fetchTestPostURI(t *testing.T, client *Client) string {
+	t.Helper()
+
+	var uri string
+	err := client.CustomCall(func(api *xrpc.Client) error {
+		feed, err := bsky.FeedGetAuthorFeed(context.Background(), api, testDIDTester, "", "posts_no_replies", false, 100)
+		if err != nil {
+			return err
+		}
+		// Pick the oldest post, that's the most likely to remain stable
+		for _, item := range feed.Feed {
+			if item.Post.Author.Did == testDIDTester {
+				uri = item.Post.Uri
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to retrieve tester feed: %v", err)
+	}
+	if uri == "" {
+		t.Fatalf("no stable posts found for tester")
+	}
+	return uri
+}
+
+// Tests that posts can be liked and unliked idempotently.
+func TestLikeUnlike(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+		uri    = fetchTestPostURI(t, client)
+	)
+	// Clean up any leftover state from previous runs
+	if err := client.Unlike(ctx, uri); err != nil {
+		t.Fatalf("failed to clean up like: %v", err)
+	}
+	// Like the post twice and ensure only one record gets created
+	first, err := client.Like(ctx, uri)
+	if err != nil {
+		t.Fatalf("failed to like post: %v", err)
+	}
+	second, err := client.Like(ctx, uri)
+	if err != nil {
+		t.Fatalf("failed to re-like post: %v", err)
+	}
+	if *first != *second {
+		t.Errorf("like record mismatch: have %v, want %v", second, first)
+	}
+	post, err := client.FetchPost(ctx, uri)
+	if err != nil {
+		t.Fatalf("failed to fetch post: %v", err)
+	}
+	if post.Viewer.Like != first.URI {
+		t.Errorf("viewer like mismatch: have %v, want %v", post.Viewer.Like, first.URI)
+	}
+	// Unlike the post twice and ensure the second is a noop
+	if err := post.Unlike(ctx); err != nil {
+		t.Fatalf("failed to unlike post: %v", err)
+	}
+	if post.Viewer.Like != "" {
+		t.Errorf("viewer like not cleared: %v", post.Viewer.Like)
+	}
+	if err := client.Unlike(ctx, uri); err != nil {
+		t.Fatalf("failed to re-unlike post: %v", err)
+	}
+}
+
+// Tests that posts can be reposted and unreposted idempotently.
+func TestRepostUnrepost(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+		uri    = fetchTestPostURI(t, client)
+	)
+	post, err := client.FetchPost(ctx, uri)
+	if err != nil {
+		t.Fatalf("failed to fetch post: %v", err)
+	}
+	if err := post.Unrepost(ctx); err != nil {
+		t.Fatalf("failed to clean up repost: %v", err)
+	}
+	ref, err := post.Repost(ctx)
+	if err != nil {
+		t.Fatalf("failed to repost post: %v", err)
+	}
+	if post.Viewer.Repost != ref.URI {
+		t.Errorf("viewer repost mismatch: have %v, want %v", post.Viewer.Repost, ref.URI)
+	}
+	if err := client.Unrepost(ctx, uri); err != nil {
+		t.Fatalf("failed to unrepost post: %v", err)
+	}
+	if post, err = client.FetchPost(ctx, uri); err != nil {
+		t.Fatalf("failed to fetch post: %v", err)
+	}
+	if post.Viewer.Repost != "" {
+		t.Errorf("viewer repost not cleared: %v", post.Viewer.Repost)
+	}
+}
+
+// Tests that the likers and reposters of a post can be streamed.
+func TestStreamEngagers(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+		uri    = fetchTestPostURI(t, client)
+	)
+	post, err := client.FetchPost(ctx, uri)
+	if err != nil {
+		t.Fatalf("failed to fetch post: %v", err)
+	}
+	if _, err := post.Like(ctx); err != nil {
+		t.Fatalf("failed to like post: %v", err)
+	}
+	defer post.Unlike(ctx)
+
+	if _, err := post.Repost(ctx); err != nil {
+		t.Fatalf("failed to repost post: %v", err)
+	}
+	defer post.Unrepost(ctx)
+
+	// Ensure the logged in user shows up amongst the engagers
+	self, err := client.userDID()
+	if err != nil {
+		t.Fatalf("failed to retrieve own DID: %v", err)
+	}
+	var liked bool
+	for liker, err := range post.IterLikers(ctx) {
+		if err != nil {
+			t.Fatalf("failed to iterate likers: %v", err)
+		}
+		if liker.DID == self {
+			if liker.CreatedAt.IsZero() {
+				t.Errorf("like creation time missing")
+			}
+			liked = true
+		}
+	}
+	if !liked {
+		t.Errorf("own like not found amongst likers")
+	}
+	var reposted bool
+	reposters, errc := post.StreamReposters(ctx)
+	for reposter := range reposters {
+		if reposter.DID == self {
+			reposted = true
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to stream reposters: %v", err)
+	}
+	if !reposted {
+		t.Errorf("own repost not found amongst reposters")
+	}
+}
+
+// Tests that engager streams can be resumed from a cursor passed as a page option,
+// and that unset query parameters are omitted instead of sent empty.
+func TestStreamEngagersResume(t *testing.T) {
+	client := makeTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Has("cid") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "InvalidRequest", "message": "cid must be a valid CID"})
+			return
+		}
+		extra := map[string]any{"uri": query.Get("uri")}
+		switch r.URL.Path {
+		case "/xrpc/app.bsky.feed.getLikes":
+			serveTestPage(w, r, 25, "likes", func(i int) any {
+				return map[string]any{"actor": testUser(i), "createdAt": "2023-05-01T10:00:00Z", "indexedAt": "2023-05-01T10:00:00Z"}
+			}, extra)
+		case "/xrpc/app.bsky.feed.getRepostedBy":
+			serveTestPage(w, r, 25, "repostedBy", testUser, extra)
+		case "/xrpc/app.bsky.feed.getQuotes":
+			serveTestPage(w, r, 25, "posts", func(i int) any {
+				return map[string]any{
+					"uri":       fmt.Sprintf("at://did:plc:user%d/app.bsky.feed.post/q", i),
+					"cid":       fmt.Sprintf("c%d", i),
+					"author":    testUser(i),
+					"record":    map[string]any{"$type": "app.bsky.feed.post", "text": "quote", "createdAt": "2023-05-01T10:00:00Z"},
+					"indexedAt": "2023-05-01T10:00:00Z",
+				}
+			}, extra)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	post := &Post{
+		client: client,
+		URI:    "at://did:plc:tester/app.bsky.feed.post/1",
+	}
+	streams := map[string]func() (<-chan *Engager, <-chan error){
+		"likers": func() (<-chan *Engager, <-chan error) {
+			return post.StreamLikers(context.Background(), WithPageSize(10), WithCursor("20"))
+		},
+		"reposters": func() (<-chan *Engager, <-chan error) {
+			return post.StreamReposters(context.Background(), WithPageSize(10), WithCursor("20"))
+		},
+		"quotes": func() (<-chan *Engager, <-chan error) {
+			return post.StreamQuotes(context.Background(), WithPageSize(10), WithCursor("20"))
+		},
+	}
+	for name, stream := range streams {
+		engagerc, errc := stream()
+
+		var engagers []*Engager
+		for engager := range engagerc {
+			engagers = append(engagers, engager)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("%s: failed to stream: %v", name, err)
+		}
+		if len(engagers) == 0 {
+			t.Fatalf("%s: resumed stream empty", name)
+		}
+		if len(engagers) != 5 || engagers[0].DID != "did:plc:user20" {
+			t.Errorf("%s: resumed stream mismatch: have %d engagers starting at %v", name, len(engagers), engagers[0])
+		}
+	}
+}
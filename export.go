@@ -0,0 +1,240 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+// maxBlobsPerCall is the maximum number of blob hashes the server will return in
+// a single listing query.
+const maxBlobsPerCall = 1000
+
+// ExportRepo downloads the entire repository of a user (all records, without the
+// blobs) as a CAR file, streaming it into the given writer.
+func (c *Client) ExportRepo(ctx context.Context, did string, w io.Writer) error {
+	if _, err := syntax.ParseDID(did); err != nil {
+		return err
+	}
+	return c.exportRepo(ctx, did, "", w)
+}
+
+// exportRepo downloads the repository of a user as a CAR file, containing only
+// the changes since the given revision if not empty.
+func (c *Client) exportRepo(ctx context.Context, did string, since string, w io.Writer) error {
+	params := map[string]interface{}{"did": did}
+	if since != "" {
+		params["since"] = since
+	}
+	return c.download(ctx, "com.atproto.sync.getRepo", params, w)
+}
+
+// exportBlob downloads a single blob of a user, streaming it into the given writer.
+func (c *Client) exportBlob(ctx context.Context, did string, cid string, w io.Writer) error {
+	return c.download(ctx, "com.atproto.sync.getBlob", map[string]interface{}{"did": did, "cid": cid}, w)
+}
+
+// fetchBlobs creates a page fetcher over the hashes of all the blobs of a user,
+// or only the ones added since the given revision if not empty.
+func (c *Client) fetchBlobs(did string, since string) pageFetcher[string] {
+	return func(ctx context.Context, cursor string, limit int) ([]string, string, error) {
+		// Call the endpoint directly, the generated binding sends an empty revision
+		// filter which the server rejects as malformed
+		var res atproto.SyncListBlobs_Output
+		params := map[string]interface{}{
+			"did":   did,
+			"limit": min(limit, maxBlobsPerCall),
+		}
+		if since != "" {
+			params["since"] = since
+		}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		if err := c.client.Do(ctx, xrpc.Query, "", "com.atproto.sync.listBlobs", params, nil, &res); err != nil {
+			return nil, "", err
+		}
+		if res.Cursor == nil {
+			return res.Cids, "", nil
+		}
+		return res.Cids, *res.Cursor, nil
+	}
+}
+
+// download executes an XRPC query with a binary response, streaming it into the
+// given writer instead of buffering it in memory as the XRPC client would.
+func (c *Client) download(ctx context.Context, method string, params map[string]interface{}, w io.Writer) error {
+	query := make(url.Values)
+	for key, val := range params {
+		query.Set(key, fmt.Sprint(val))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.client.Host+"/xrpc/"+method+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	c.jwtLock.RLock()
+	if c.client.Auth != nil {
+		req.Header.Set("Authorization", "Bearer "+c.client.Auth.AccessJwt)
+	}
+	c.jwtLock.RUnlock()
+
+	client := c.client.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	// If the request failed, convert it into the same error the XRPC client would
+	if res.StatusCode != http.StatusOK {
+		xerr := &xrpc.Error{StatusCode: res.StatusCode}
+		if reset, err := strconv.ParseInt(res.Header.Get("ratelimit-reset"), 10, 64); err == nil {
+			xerr.Ratelimit = &xrpc.RatelimitInfo{Reset: time.Unix(reset, 0)}
+		}
+		var cause xrpc.XRPCError
+		if err := json.NewDecoder(res.Body).Decode(&cause); err != nil {
+			xerr.Wrapped = fmt.Errorf("failed to decode xrpc error message: %w", err)
+		} else {
+			xerr.Wrapped = &cause
+		}
+		return xerr
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// BackupState is the state of an incremental local backup of a user's repository.
+type BackupState struct {
+	DID     string    `json:"did"`     // DID of the user whose repository is backed up
+	Rev     string    `json:"rev"`     // Repository revision the backup is up to date with
+	Time    time.Time `json:"time"`    // Time when the last backup run finished
+	Exports []string  `json:"exports"` // CAR files in the backup, a full one followed by diffs
+	Blobs   int       `json:"blobs"`   // Number of blobs in the backup
+}
+
+// ErrBackupMismatch is returned if a backup is attempted into a directory holding
+// the backup of a different user.
+var ErrBackupMismatch = errors.New("backup of different user")
+
+// Backup creates or updates a local backup of a user's repository in the given
+// directory, containing the records as CAR files and every blob as a file named
+// after its content hash:
+//
+//	dir/backup.json           - Backup state, tracking the revision and exports
+//	dir/repo/<rev>.car        - Repository exports, the first full, then diffs
+//	dir/blobs/<cid>           - Blobs referenced from the repository
+//
+// On the first run the entire repository is downloaded, while subsequent runs
+// only download the records and blobs added since the previous one. Note, to
+// restore the full repository, all the exports need to be applied in order.
+//
+// An interrupted backup can be simply rerun, as the state is only updated after
+// everything has been downloaded and blobs already on disk are not fetched again.
+func (c *Client) Backup(ctx context.Context, did string, dir string) (*BackupState, error) {
+	if _, err := syntax.ParseDID(did); err != nil {
+		return nil, err
+	}
+	// Load any previous backup state to continue from
+	var (
+		statePath = filepath.Join(dir, "backup.json")
+		state     = &BackupState{DID: did}
+	)
+	if blob, err := os.ReadFile(statePath); err == nil {
+		if err := json.Unmarshal(blob, state); err != nil {
+			return nil, fmt.Errorf("failed to parse backup state: %w", err)
+		}
+		if state.DID != did {
+			return nil, fmt.Errorf("%w: %s in %s, want %s", ErrBackupMismatch, state.DID, dir, did)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, sub := range []string{"repo", "blobs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	// Pin the revision to back up to before exporting. Any commits made during the
+	// export will be included in this run and downloaded again on the next one,
+	// which is harmless.
+	head, err := atproto.SyncGetLatestCommit(ctx, c.client, did)
+	if err != nil {
+		return nil, err
+	}
+	if head.Rev == state.Rev {
+		return state, nil
+	}
+	export := filepath.Join("repo", head.Rev+".car")
+	if err := writeStreamAtomic(filepath.Join(dir, export), func(w io.Writer) error {
+		return c.exportRepo(ctx, did, state.Rev, w)
+	}); err != nil {
+		return nil, err
+	}
+	// Download all the new blobs that are not yet on disk
+	for cid, err := range iterate(ctx, c.fetchBlobs(did, state.Rev), nil) {
+		if err != nil {
+			return nil, err
+		}
+		if cid == "" || strings.ContainsAny(cid, `/\.`) {
+			return nil, fmt.Errorf("invalid blob hash %q", cid)
+		}
+		path := filepath.Join(dir, "blobs", cid)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		for {
+			err = writeStreamAtomic(path, func(w io.Writer) error {
+				return c.exportBlob(ctx, did, cid, w)
+			})
+			if err == nil || !waitThrottled(ctx, err) {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	blobs, err := os.ReadDir(filepath.Join(dir, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	// Everything downloaded, update the backup state
+	state.Rev = head.Rev
+	state.Time = time.Now()
+	state.Exports = append(state.Exports, export)
+	state.Blobs = 0
+	for _, blob := range blobs {
+		if !strings.HasSuffix(blob.Name(), ".tmp") {
+			state.Blobs++
+		}
+	}
+
+	blob, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(statePath, blob); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
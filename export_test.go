@@ -0,0 +1,139 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// testSyncServer is a minimal fake of the sync APIs of a PDS, used to test the
+// repository export and backup flows offline.
+type testSyncServer struct {
+	lock   sync.Mutex
+	revs   []string          // Revisions of the repository, the last being the head
+	blobs  map[string]string // Blob contents, indexed by hash
+	added  map[string]string // Revision at which each blob was added
+	blobDL int               // Number of blob downloads served
+}
+
+func (s *testSyncServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	query := r.URL.Query()
+	if query.Get("did") != "did:plc:tester" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "RepoNotFound"})
+		return
+	}
+	switch r.URL.Path {
+	case "/xrpc/com.atproto.sync.getLatestCommit":
+		json.NewEncoder(w).Encode(map[string]string{"cid": "commit", "rev": s.revs[len(s.revs)-1]})
+
+	case "/xrpc/com.atproto.sync.getRepo":
+		w.Write([]byte("car since " + query.Get("since") + " until " + s.revs[len(s.revs)-1]))
+
+	case "/xrpc/com.atproto.sync.listBlobs":
+		cids := []string{}
+		for cid, rev := range s.added {
+			if rev > query.Get("since") {
+				cids = append(cids, cid)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"cids": cids})
+
+	case "/xrpc/com.atproto.sync.getBlob":
+		s.blobDL++
+		w.Write([]byte(s.blobs[query.Get("cid")]))
+	}
+}
+
+// Tests that repositories can be streamed out and that errors are converted the
+// same way as by the XRPC client.
+func TestExportRepo(t *testing.T) {
+	srv := httptest.NewServer(&testSyncServer{revs: []string{"rev1"}})
+	defer srv.Close()
+
+	client := &Client{client: &xrpc.Client{Client: new(http.Client), Host: srv.URL}}
+
+	var buf bytes.Buffer
+	if err := client.ExportRepo(context.Background(), "did:plc:tester", &buf); err != nil {
+		t.Fatalf("failed to export repo: %v", err)
+	}
+	if have, want := buf.String(), "car since  until rev1"; have != want {
+		t.Errorf("export mismatch: have %q, want %q", have, want)
+	}
+	var xerr *xrpc.XRPCError
+	if err := client.ExportRepo(context.Background(), "did:plc:other", &buf); !errors.As(err, &xerr) || xerr.ErrStr != "RepoNotFound" {
+		t.Errorf("export error mismatch: have %v, want RepoNotFound", err)
+	}
+}
+
+// Tests that backups download everything on the first run and only the changes
+// on subsequent ones.
+func TestBackup(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		dir    = t.TempDir()
+		server = &testSyncServer{
+			revs:  []string{"rev1"},
+			blobs: map[string]string{"blob1": "one", "blob2": "two"},
+			added: map[string]string{"blob1": "rev1", "blob2": "rev1"},
+		}
+	)
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	client := &Client{client: &xrpc.Client{Client: new(http.Client), Host: srv.URL}}
+
+	// Run a full backup and ensure everything is on disk
+	state, err := client.Backup(ctx, "did:plc:tester", dir)
+	if err != nil {
+		t.Fatalf("failed to run full backup: %v", err)
+	}
+	if state.Rev != "rev1" || len(state.Exports) != 1 || state.Blobs != 2 || server.blobDL != 2 {
+		t.Fatalf("full backup mismatch: have %+v with %d downloads", state, server.blobDL)
+	}
+	if blob, _ := os.ReadFile(filepath.Join(dir, "blobs", "blob2")); string(blob) != "two" {
+		t.Errorf("blob content mismatch: have %q, want %q", blob, "two")
+	}
+	// Rerun without changes and ensure nothing is downloaded
+	if _, err := client.Backup(ctx, "did:plc:tester", dir); err != nil {
+		t.Fatalf("failed to rerun backup: %v", err)
+	}
+	if server.blobDL != 2 {
+		t.Errorf("download count mismatch: have %d, want 2", server.blobDL)
+	}
+	// Advance the repo and ensure only the diff is downloaded
+	server.revs = append(server.revs, "rev2")
+	server.blobs["blob3"] = "three"
+	server.added["blob3"] = "rev2"
+
+	state, err = client.Backup(ctx, "did:plc:tester", dir)
+	if err != nil {
+		t.Fatalf("failed to run incremental backup: %v", err)
+	}
+	if state.Rev != "rev2" || len(state.Exports) != 2 || state.Blobs != 3 || server.blobDL != 3 {
+		t.Fatalf("incremental backup mismatch: have %+v with %d downloads", state, server.blobDL)
+	}
+	if car, _ := os.ReadFile(filepath.Join(dir, state.Exports[1])); string(car) != "car since rev1 until rev2" {
+		t.Errorf("incremental export mismatch: have %q", car)
+	}
+	// Ensure a backup of a different user is rejected
+	if _, err := client.Backup(ctx, "did:plc:other", dir); !errors.Is(err, ErrBackupMismatch) {
+		t.Errorf("foreign backup error mismatch: have %v, want %v", err, ErrBackupMismatch)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+var (
+	// facetMentionRegexp matches user mentions (@handle) in post texts.
+	facetMentionRegexp = regexp.MustCompile(`(?:^|[\s(])(@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)+)`)
+
+	// facetLinkRegexp matches web links in post texts.
+	facetLinkRegexp = regexp.MustCompile(`(?:^|[\s(])(https?://[^\s]+)`)
+
+	// facetTagRegexp matches hashtags in post texts. Pure numeric tags are not
+	// considered hashtags.
+	facetTagRegexp = regexp.MustCompile(`(?:^|\s)(#[^\s#]*[^\d\s\p{P}][^\s#]*)`)
+)
+
+// Facet is an annotation of a section of a post's text, marking it as a mention
+// of a user, a link or a hashtag. Exactly one of the annotation fields is set.
+type Facet struct {
+	Start int    // Start byte offset of the annotated text (UTF-8)
+	End   int    // End byte offset of the annotated text (UTF-8, exclusive)
+	Text  string // Annotated section of the post's text
+
+	Mention string // DID of the mentioned user
+	Link    string // URL of the linked web page
+	Tag     string // Hashtag without the leading #
+}
+
+// parseFacets converts the API facets of a post into the library's facet type,
+// flattening multi-feature annotations and dropping invalid ranges.
+func parseFacets(text string, facets []*bsky.RichtextFacet) []*Facet {
+	var parsed []*Facet
+	for _, facet := range facets {
+		if facet == nil || facet.Index == nil {
+			continue
+		}
+		start, end := int(facet.Index.ByteStart), int(facet.Index.ByteEnd)
+		if start < 0 || end > len(text) || start >= end {
+			continue
+		}
+		for _, feature := range facet.Features {
+			if feature == nil {
+				continue
+			}
+			f := &Facet{Start: start, End: end, Text: text[start:end]}
+			switch {
+			case feature.RichtextFacet_Mention != nil:
+				f.Mention = feature.RichtextFacet_Mention.Did
+			case feature.RichtextFacet_Link != nil:
+				f.Link = feature.RichtextFacet_Link.Uri
+			case feature.RichtextFacet_Tag != nil:
+				f.Tag = feature.RichtextFacet_Tag.Tag
+			default:
+				continue // unknown feature, skip
+			}
+			parsed = append(parsed, f)
+		}
+	}
+	return parsed
+}
+
+// detectFacets scans a post's text for mentions, links and hashtags, and creates
+// the annotations for them. Mentioned handles are resolved to DIDs; the ones
+// that fail to resolve are left as plain text.
+func (c *Client) detectFacets(ctx context.Context, text string) []*bsky.RichtextFacet {
+	var facets []*bsky.RichtextFacet
+
+	for _, match := range facetMentionRegexp.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+		res, err := atproto.IdentityResolveHandle(ctx, c.client, text[start+1:end])
+		if err != nil {
+			continue
+		}
+		facets = append(facets, &bsky.RichtextFacet{
+			Index:    &bsky.RichtextFacet_ByteSlice{ByteStart: int64(start), ByteEnd: int64(end)},
+			Features: []*bsky.RichtextFacet_Features_Elem{{RichtextFacet_Mention: &bsky.RichtextFacet_Mention{Did: res.Did}}},
+		})
+	}
+	for _, match := range facetLinkRegexp.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+
+		// Strip any trailing punctuation that's most probably not part of the link
+		end = start + len(strings.TrimRight(text[start:end], ".,;:!?)"))
+		facets = append(facets, &bsky.RichtextFacet{
+			Index:    &bsky.RichtextFacet_ByteSlice{ByteStart: int64(start), ByteEnd: int64(end)},
+			Features: []*bsky.RichtextFacet_Features_Elem{{RichtextFacet_Link: &bsky.RichtextFacet_Link{Uri: text[start:end]}}},
+		})
+	}
+	for _, match := range facetTagRegexp.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+
+		// Strip any trailing punctuation that's most probably not part of the tag
+		end = start + len(strings.TrimRight(text[start:end], ".,;:!?)"))
+		if end-start < 2 {
+			continue
+		}
+		facets = append(facets, &bsky.RichtextFacet{
+			Index:    &bsky.RichtextFacet_ByteSlice{ByteStart: int64(start), ByteEnd: int64(end)},
+			Features: []*bsky.RichtextFacet_Features_Elem{{RichtextFacet_Tag: &bsky.RichtextFacet_Tag{Tag: text[start+1 : end]}}},
+		})
+	}
+	return facets
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// Tests that links and hashtags are detected and annotated in post texts and
+// that the annotations can be parsed back.
+func TestDetectFacets(t *testing.T) {
+	// Create a client that cannot resolve anything, mentions will be skipped
+	client := &Client{client: &xrpc.Client{Client: new(http.Client), Host: "http://127.0.0.1:1"}}
+
+	text := "Check out https://github.com/karalabe/go-bluesky, by @karalabe.bsky.social #golang #2023 (#bluesky)"
+	facets := parseFacets(text, client.detectFacets(context.Background(), text))
+
+	want := []*Facet{
+		{Text: "https://github.com/karalabe/go-bluesky", Link: "https://github.com/karalabe/go-bluesky"},
+		{Text: "#golang", Tag: "golang"},
+	}
+	if len(facets) != len(want) {
+		t.Fatalf("facet count mismatch: have %d, want %d", len(facets), len(want))
+	}
+	for i, facet := range facets {
+		if facet.Text != want[i].Text || facet.Link != want[i].Link || facet.Tag != want[i].Tag || facet.Mention != "" {
+			t.Errorf("facet %d mismatch: have %+v, want %+v", i, facet, want[i])
+		}
+		if text[facet.Start:facet.End] != facet.Text {
+			t.Errorf("facet %d range mismatch: have %q, want %q", i, text[facet.Start:facet.End], facet.Text)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+// ErrUnsupportedFeed is returned if a feed operation is attempted with a record
+// that is neither a feed generator nor a list.
+var ErrUnsupportedFeed = errors.New("not a feed generator or list")
+
+// maxFeedItemsPerCall is the maximum number of posts the server will return in
+// a single feed query.
+const maxFeedItemsPerCall = 100
+
+// FeedItem is a post surfaced by a feed, along with the reason it was included.
+type FeedItem struct {
+	Post       *Post     // Post included in the feed
+	RepostedBy *User     // User who reposted the post into the feed, nil if not a repost
+	RepostedAt time.Time // Time when the repost was indexed, zero if not a repost
+	Pinned     bool      // Whether the post is included as the author's pinned post
+	Context    string    // Opaque context attached by the feed generator, empty if none
+}
+
+// StreamFeed gradually resolves the posts of a custom feed (identified by the
+// AT-URI of its generator record) as served to the logged in user, feeding the
+// results into a channel.
+func (c *Client) StreamFeed(ctx context.Context, feed string, opts ...PageOption) (<-chan *FeedItem, <-chan error) {
+	stream := c.StreamFeedFrom(ctx, feed, "", opts...)
+	return stream.Items(), stream.Err()
+}
+
+// StreamFeedFrom gradually resolves the posts of a custom feed as served to the
+// logged in user, starting from a pagination cursor (empty to start from the
+// beginning, or from the cursor set via WithCursor, if any).
+func (c *Client) StreamFeedFrom(ctx context.Context, feed string, cursor string, opts ...PageOption) *Stream[*FeedItem] {
+	if err := checkFeed(feed); err != nil {
+		return newStream(ctx, failedFetcher[*FeedItem](err), opts)
+	}
+	return newStream(ctx, c.feedFetcher(feed), withStartCursor(cursor, opts))
+}
+
+// IterFeed returns an iterator over the posts of a custom feed (identified by the
+// AT-URI of its generator record) as served to the logged in user, retrieving
+// them page by page as the iteration progresses.
+func (c *Client) IterFeed(ctx context.Context, feed string, opts ...PageOption) iter.Seq2[*FeedItem, error] {
+	if err := checkFeed(feed); err != nil {
+		return iterate(ctx, failedFetcher[*FeedItem](err), opts)
+	}
+	return iterate(ctx, c.feedFetcher(feed), opts)
+}
+
+// checkFeed validates that an AT-URI references a feed generator record.
+func checkFeed(feed string) error {
+	_, collection, _, err := parseATURI(feed)
+	if err != nil {
+		return err
+	}
+	if collection != "app.bsky.feed.generator" {
+		return fmt.Errorf("%w: %s", ErrUnsupportedFeed, feed)
+	}
+	return nil
+}
+
+// feedFetcher creates a page fetcher for the posts of a custom feed.
+func (c *Client) feedFetcher(feed string) pageFetcher[*FeedItem] {
+	return func(ctx context.Context, cursor string, limit int) ([]*FeedItem, string, error) {
+		// Assemble only the parameters actually set, the server rejects empty ones
+		params := map[string]interface{}{
+			"feed":  feed,
+			"limit": min(limit, maxFeedItemsPerCall),
+		}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var res bsky.FeedGetFeed_Output
+		if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.feed.getFeed", params, nil, &res); err != nil {
+			return nil, "", err
+		}
+		items := make([]*FeedItem, 0, len(res.Feed))
+		for _, view := range res.Feed {
+			if view.Post == nil {
+				continue
+			}
+			items = append(items, newFeedItem(c, view))
+		}
+		if res.Cursor == nil {
+			return items, "", nil
+		}
+		return items, *res.Cursor, nil
+	}
+}
+
+// newFeedItem converts an API feed view into the library's feed item type.
+func newFeedItem(client *Client, view *bsky.FeedDefs_FeedViewPost) *FeedItem {
+	item := &FeedItem{
+		Post: newPostFromView(client, view.Post),
+	}
+	if view.Reason != nil {
+		if repost := view.Reason.FeedDefs_ReasonRepost; repost != nil {
+			item.RepostedBy = newUserFromBasicView(client, repost.By)
+			item.RepostedAt = parseTime(&repost.IndexedAt)
+		}
+		item.Pinned = view.Reason.FeedDefs_ReasonPin != nil
+	}
+	if view.FeedContext != nil {
+		item.Context = *view.FeedContext
+	}
+	return item
+}
+
+// FeedGenerator is the metadata of a custom feed, as published by its creator.
+type FeedGenerator struct {
+	URI string // AT-URI of the feed generator record
+	CID string // Content hash of the feed generator record
+	DID string // DID of the service generating the feed
+
+	Creator     *User  // User who published the feed
+	Name        string // Display name of the feed
+	Description string // Description of the feed, empty if unset
+	AvatarURL   string // CDN URL to the feed's picture, empty if unset
+	LikeCount   uint   // Number of likes of the feed
+
+	Online bool // Whether the feed generator service is reachable
+	Valid  bool // Whether the feed generator service is correctly configured
+
+	IndexedAt time.Time // Time when the feed was indexed by the server
+	Labels    []*Label  // Moderation labels attached to the feed
+	Like      string    // URI of the viewer's like record, empty if not liked
+}
+
+// FetchFeedGenerator retrieves the metadata about a custom feed, along with the
+// server's view on whether the feed generator is online and valid.
+func (c *Client) FetchFeedGenerator(ctx context.Context, feed string) (*FeedGenerator, error) {
+	if err := checkFeed(feed); err != nil {
+		return nil, err
+	}
+	res, err := bsky.FeedGetFeedGenerator(ctx, c.client, feed)
+	if err != nil {
+		return nil, err
+	}
+	if res.View == nil {
+		return nil, fmt.Errorf("missing feed generator view: %s", feed)
+	}
+	// Dig out the relevant fields and drop pointless pointers
+	view := res.View
+	gen := &FeedGenerator{
+		URI:       view.Uri,
+		CID:       view.Cid,
+		DID:       view.Did,
+		Name:      view.DisplayName,
+		Online:    res.IsOnline,
+		Valid:     res.IsValid,
+		IndexedAt: parseTime(&view.IndexedAt),
+		Labels:    parseLabels(view.Labels),
+	}
+	if view.Creator != nil {
+		gen.Creator = newUserFromView(c, view.Creator)
+	}
+	if view.Description != nil {
+		gen.Description = *view.Description
+	}
+	if view.Avatar != nil {
+		gen.AvatarURL = *view.Avatar
+	}
+	if view.LikeCount != nil {
+		gen.LikeCount = uint(*view.LikeCount)
+	}
+	if view.Viewer != nil && view.Viewer.Like != nil {
+		gen.Like = *view.Viewer.Like
+	}
+	return gen, nil
+}
+
+// SavedFeedType defines the kind of a feed saved in the user's preferences.
+type SavedFeedType string
+
+const (
+	SavedFeedGenerator SavedFeedType = "feed"     // Custom feed served by a feed generator
+	SavedFeedList      SavedFeedType = "list"     // Feed of the posts of a list's members
+	SavedFeedTimeline  SavedFeedType = "timeline" // Built-in home timeline
+)
+
+// SavedFeed is a feed saved in the logged in user's preferences, in the order
+// shown by the apps.
+type SavedFeed struct {
+	ID     string        `json:"id"`     // Identifier of the entry within the preferences
+	Type   SavedFeedType `json:"type"`   // Kind of the saved feed
+	Value  string        `json:"value"`  // AT-URI of the feed generator or list (or "following" for the timeline)
+	Pinned bool          `json:"pinned"` // Whether the feed is pinned to the app's home screen
+}
+
+// SavedFeeds retrieves the feeds saved by the logged in user, in the order shown
+// by the apps.
+func (c *Client) SavedFeeds(ctx context.Context) ([]*SavedFeed, error) {
+	prefs, err := c.fetchPreferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return prefs.savedFeeds()
+}
+
+// SaveFeed adds a feed generator or list to the logged in user's saved feeds,
+// unpinned. If the feed is already saved, the method is a noop.
+//
+// Feeds referenced by handle are resolved and stored by DID, like the official
+// apps do, and the same applies when matching them in the other methods.
+func (c *Client) SaveFeed(ctx context.Context, uri string) error {
+	return c.updateSavedFeeds(ctx, uri, func(feeds []*SavedFeed, idx int, feed *SavedFeed) []*SavedFeed {
+		if idx < 0 {
+			feeds = append(feeds, feed)
+		}
+		return feeds
+	})
+}
+
+// UnsaveFeed removes a feed generator or list from the logged in user's saved
+// feeds, unpinning it too. If the feed is not saved, the method is a noop.
+func (c *Client) UnsaveFeed(ctx context.Context, uri string) error {
+	return c.updateSavedFeeds(ctx, uri, func(feeds []*SavedFeed, idx int, feed *SavedFeed) []*SavedFeed {
+		if idx >= 0 {
+			feeds = slices.Delete(feeds, idx, idx+1)
+		}
+		return feeds
+	})
+}
+
+// PinFeed pins a feed generator or list to the logged in user's home screen,
+// saving it first if needed.
+func (c *Client) PinFeed(ctx context.Context, uri string) error {
+	return c.updateSavedFeeds(ctx, uri, func(feeds []*SavedFeed, idx int, feed *SavedFeed) []*SavedFeed {
+		if idx < 0 {
+			feed.Pinned = true
+			return append(feeds, feed)
+		}
+		feeds[idx].Pinned = true
+		return feeds
+	})
+}
+
+// UnpinFeed unpins a feed generator or list from the logged in user's home
+// screen, leaving it saved. If the feed is not pinned, the method is a noop.
+func (c *Client) UnpinFeed(ctx context.Context, uri string) error {
+	return c.updateSavedFeeds(ctx, uri, func(feeds []*SavedFeed, idx int, feed *SavedFeed) []*SavedFeed {
+		if idx >= 0 {
+			feeds[idx].Pinned = false
+		}
+		return feeds
+	})
+}
+
+// ReorderFeeds moves the given saved feeds (identified by their values) to the
+// front of the logged in user's saved feeds, in the given order. Any feeds not
+// listed retain their relative order after them.
+func (c *Client) ReorderFeeds(ctx context.Context, values ...string) error {
+	// Normalize the feed URIs to match the stored form, leave the timeline as is
+	values = slices.Clone(values)
+	for i, value := range values {
+		if _, _, _, err := parseATURI(value); err != nil {
+			continue
+		}
+		uri, _, err := c.normalizeFeed(ctx, value)
+		if err != nil {
+			return err
+		}
+		values[i] = uri
+	}
+	prefs, err := c.fetchPreferences(ctx)
+	if err != nil {
+		return err
+	}
+	feeds, err := prefs.savedFeeds()
+	if err != nil {
+		return err
+	}
+	ordered := make([]*SavedFeed, 0, len(feeds))
+	for _, value := range values {
+		idx := slices.IndexFunc(feeds, func(feed *SavedFeed) bool { return feed.Value == value })
+		if idx < 0 {
+			return fmt.Errorf("feed not saved: %s", value)
+		}
+		ordered = append(ordered, feeds[idx])
+		feeds = slices.Delete(feeds, idx, idx+1)
+	}
+	prefs.setSavedFeeds(append(ordered, feeds...))
+	return c.storePreferences(ctx, prefs)
+}
+
+// updateSavedFeeds validates a feed URI and runs a modification on the logged
+// in user's saved feeds, passing in the index of the feed (or -1 if not saved)
+// and a fresh unpinned entry for it, to add if needed.
+//
+// Note, the preferences API has no compare-and-swap, so concurrent updates from
+// other apps between the read and the write are lost.
+func (c *Client) updateSavedFeeds(ctx context.Context, uri string, update func(feeds []*SavedFeed, idx int, feed *SavedFeed) []*SavedFeed) error {
+	uri, kind, err := c.normalizeFeed(ctx, uri)
+	if err != nil {
+		return err
+	}
+	prefs, err := c.fetchPreferences(ctx)
+	if err != nil {
+		return err
+	}
+	feeds, err := prefs.savedFeeds()
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(feeds, func(feed *SavedFeed) bool { return feed.Value == uri })
+	prefs.setSavedFeeds(update(feeds, idx, &SavedFeed{ID: syntax.NextTID().String(), Type: kind, Value: uri}))
+
+	return c.storePreferences(ctx, prefs)
+}
+
+// normalizeFeed validates the AT-URI of a feed generator or list and converts it
+// into the canonical form stored in the preferences, with the repository being
+// referenced by DID instead of handle. The kind of the feed is also returned.
+func (c *Client) normalizeFeed(ctx context.Context, uri string) (string, SavedFeedType, error) {
+	repo, collection, rkey, err := parseATURI(uri)
+	if err != nil {
+		return "", "", err
+	}
+	var kind SavedFeedType
+	switch collection {
+	case "app.bsky.feed.generator":
+		kind = SavedFeedGenerator
+	case "app.bsky.graph.list":
+		kind = SavedFeedList
+	default:
+		return "", "", fmt.Errorf("%w: %s", ErrUnsupportedFeed, uri)
+	}
+	if !strings.HasPrefix(repo, "did:") {
+		res, err := atproto.IdentityResolveHandle(ctx, c.client, repo)
+		if err != nil {
+			return "", "", err
+		}
+		repo = res.Did
+	}
+	return "at://" + repo + "/" + collection + "/" + rkey, kind, nil
+}
+
+// preferences is the raw list of the logged in user's private preferences. They
+// are kept undecoded, to retain any the library does not know about.
+type preferences []map[string]json.RawMessage
+
+const (
+	savedFeedsPrefType       = "app.bsky.actor.defs#savedFeedsPrefV2" // Current saved feeds preference
+	savedFeedsLegacyPrefType = "app.bsky.actor.defs#savedFeedsPref"   // Deprecated saved feeds preference
+)
+
+// fetchPreferences retrieves the private preferences of the logged in user.
+func (c *Client) fetchPreferences(ctx context.Context) (preferences, error) {
+	var res struct {
+		Preferences preferences `json:"preferences"`
+	}
+	if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.actor.getPreferences", nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Preferences, nil
+}
+
+// storePreferences replaces the private preferences of the logged in user.
+func (c *Client) storePreferences(ctx context.Context, prefs preferences) error {
+	input := struct {
+		Preferences preferences `json:"preferences"`
+	}{prefs}
+	return c.client.Do(ctx, xrpc.Procedure, "application/json", "app.bsky.actor.putPreferences", nil, &input, nil)
+}
+
+// find returns the first preference of a given type, or nil if none.
+func (prefs preferences) find(kind string) map[string]json.RawMessage {
+	for _, pref := range prefs {
+		if string(pref["$type"]) == `"`+kind+`"` {
+			return pref
+		}
+	}
+	return nil
+}
+
+// savedFeeds extracts the saved feeds from the preferences, falling back to the
+// deprecated format if the current one is missing. As the official apps do when
+// migrating, the deprecated feeds are prefixed with the pinned home timeline,
+// which the old format could not represent.
+func (prefs preferences) savedFeeds() ([]*SavedFeed, error) {
+	if pref := prefs.find(savedFeedsPrefType); pref != nil {
+		var feeds []*SavedFeed
+		if err := json.Unmarshal(pref["items"], &feeds); err != nil {
+			return nil, fmt.Errorf("invalid saved feeds preference: %w", err)
+		}
+		return feeds, nil
+	}
+	pref := prefs.find(savedFeedsLegacyPrefType)
+	if pref == nil {
+		return nil, nil
+	}
+	// Missing lists are treated as empty, older apps omitted them if unset
+	var saved, pinned []string
+	if raw, ok := pref["saved"]; ok {
+		if err := json.Unmarshal(raw, &saved); err != nil {
+			return nil, fmt.Errorf("invalid legacy saved feeds preference: %w", err)
+		}
+	}
+	if raw, ok := pref["pinned"]; ok {
+		if err := json.Unmarshal(raw, &pinned); err != nil {
+			return nil, fmt.Errorf("invalid legacy saved feeds preference: %w", err)
+		}
+	}
+	feeds := make([]*SavedFeed, 0, len(saved)+1)
+	feeds = append(feeds, &SavedFeed{
+		ID:     syntax.NextTID().String(),
+		Type:   SavedFeedTimeline,
+		Value:  "following",
+		Pinned: true,
+	})
+	for _, uri := range saved {
+		kind := SavedFeedGenerator
+		if _, collection, _, err := parseATURI(uri); err == nil && collection == "app.bsky.graph.list" {
+			kind = SavedFeedList
+		}
+		feeds = append(feeds, &SavedFeed{
+			ID:     syntax.NextTID().String(),
+			Type:   kind,
+			Value:  uri,
+			Pinned: slices.Contains(pinned, uri),
+		})
+	}
+	return feeds, nil
+}
+
+// setSavedFeeds replaces the saved feeds in the preferences. If the deprecated
+// format is also present, it is kept in sync for older apps.
+func (prefs *preferences) setSavedFeeds(feeds []*SavedFeed) {
+	if feeds == nil {
+		feeds = []*SavedFeed{}
+	}
+	items, _ := json.Marshal(feeds)
+	if pref := prefs.find(savedFeedsPrefType); pref != nil {
+		pref["items"] = items
+	} else {
+		kind, _ := json.Marshal(savedFeedsPrefType)
+		*prefs = append(*prefs, map[string]json.RawMessage{"$type": kind, "items": items})
+	}
+	if pref := prefs.find(savedFeedsLegacyPrefType); pref != nil {
+		saved, pinned := []string{}, []string{}
+		for _, feed := range feeds {
+			if feed.Type == SavedFeedTimeline {
+				continue
+			}
+			saved = append(saved, feed.Value)
+			if feed.Pinned {
+				pinned = append(pinned, feed.Value)
+			}
+		}
+		pref["saved"], _ = json.Marshal(saved)
+		pref["pinned"], _ = json.Marshal(pinned)
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+// testFeed is the feed generator served by the fake feed server.
+const testFeed = "at://did:plc:curator/app.bsky.feed.generator/picks"
+
+// testFeedServer is a minimal fake of the feed and preference APIs of an AppView,
+// used to test the custom feed flows offline.
+type testFeedServer struct {
+	lock  sync.Mutex
+	posts int             // Number of posts in the test feed
+	prefs json.RawMessage // Raw preferences of the user
+}
+
+func (s *testFeedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	query := r.URL.Query()
+	switch r.URL.Path {
+	case "/xrpc/app.bsky.feed.getFeed":
+		if query.Get("feed") != testFeed {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "UnknownFeed"})
+			return
+		}
+		start, _ := strconv.Atoi(query.Get("cursor"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		feed := []map[string]any{}
+		for i := start; i < min(start+limit, s.posts); i++ {
+			item := map[string]any{
+				"post": map[string]any{
+					"uri":       fmt.Sprintf("at://did:plc:bob/app.bsky.feed.post/%d", i),
+					"cid":       fmt.Sprintf("c%d", i),
+					"author":    map[string]any{"did": "did:plc:bob", "handle": "bob.test"},
+					"record":    map[string]any{"$type": "app.bsky.feed.post", "text": fmt.Sprintf("post %d", i), "createdAt": "2023-05-01T10:00:00Z"},
+					"indexedAt": "2023-05-01T10:00:00Z",
+				},
+				"feedContext": fmt.Sprintf("ctx-%d", i),
+			}
+			if i%2 == 1 {
+				item["reason"] = map[string]any{
+					"$type":     "app.bsky.feed.defs#reasonRepost",
+					"by":        map[string]any{"did": "did:plc:carol", "handle": "carol.test"},
+					"indexedAt": "2023-05-01T11:00:00Z",
+				}
+			}
+			feed = append(feed, item)
+		}
+		res := map[string]any{"feed": feed}
+		if start+limit < s.posts {
+			res["cursor"] = strconv.Itoa(start + limit)
+		}
+		json.NewEncoder(w).Encode(res)
+
+	case "/xrpc/app.bsky.feed.getFeedGenerator":
+		json.NewEncoder(w).Encode(map[string]any{
+			"view": map[string]any{
+				"uri":         testFeed,
+				"cid":         "cfeed",
+				"did":         "did:web:feeds.test",
+				"creator":     map[string]any{"did": "did:plc:curator", "handle": "curator.test"},
+				"displayName": "Picks",
+				"description": "Hand picked posts",
+				"avatar":      "https://cdn.test/avatar.jpg",
+				"likeCount":   42,
+				"indexedAt":   "2023-05-01T10:00:00Z",
+			},
+			"isOnline": true,
+			"isValid":  false,
+		})
+
+	case "/xrpc/com.atproto.identity.resolveHandle":
+		if query.Get("handle") != "curator.test" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "InvalidRequest", "message": "Unable to resolve handle"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"did": "did:plc:curator"})
+
+	case "/xrpc/app.bsky.actor.getPreferences":
+		fmt.Fprintf(w, `{"preferences": %s}`, s.prefs)
+
+	case "/xrpc/app.bsky.actor.putPreferences":
+		var input struct {
+			Preferences json.RawMessage `json:"preferences"`
+		}
+		blob, _ := io.ReadAll(r.Body)
+		json.Unmarshal(blob, &input)
+		s.prefs = input.Preferences
+	}
+}
+
+// Tests that custom feeds can be streamed page by page and their generators'
+// metadata retrieved.
+func TestStreamFeed(t *testing.T) {
+	var (
+		server = &testFeedServer{posts: 25}
+		client = makeTestServerClient(t, server)
+		ctx    = context.Background()
+	)
+	itemc, errc := client.StreamFeed(ctx, testFeed, WithPageSize(10))
+
+	var items []*FeedItem
+	for item := range itemc {
+		items = append(items, item)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to stream feed: %v", err)
+	}
+	if len(items) != 25 {
+		t.Fatalf("feed length mismatch: have %d, want %d", len(items), 25)
+	}
+	for i, item := range items {
+		if item.Post.Text != fmt.Sprintf("post %d", i) || item.Context != fmt.Sprintf("ctx-%d", i) {
+			t.Errorf("item %d: content mismatch: have %q/%q", i, item.Post.Text, item.Context)
+		}
+		if reposted := item.RepostedBy != nil; reposted != (i%2 == 1) {
+			t.Errorf("item %d: repost mismatch: have %v, want %v", i, reposted, i%2 == 1)
+		} else if reposted && (item.RepostedBy.Handle != "carol.test" || item.RepostedAt.IsZero()) {
+			t.Errorf("item %d: reposter mismatch: have %+v at %v", i, item.RepostedBy, item.RepostedAt)
+		}
+	}
+	// Resume the feed from a cursor and ensure only the remainder is delivered
+	stream := client.StreamFeedFrom(ctx, testFeed, "20", WithPageSize(10))
+	var resumed []*FeedItem
+	for item := range stream.Items() {
+		resumed = append(resumed, item)
+	}
+	if err := <-stream.Err(); err != nil {
+		t.Fatalf("failed to stream resumed feed: %v", err)
+	}
+	if len(resumed) == 0 {
+		t.Fatalf("resumed feed empty")
+	}
+	if len(resumed) != 5 || resumed[0].Post.Text != "post 20" {
+		t.Errorf("resumed feed mismatch: have %d items starting at %q", len(resumed), resumed[0].Post.Text)
+	}
+	// Ensure non-feed URIs are rejected before hitting the server
+	for _, err := range client.IterFeed(ctx, "at://did:plc:curator/app.bsky.graph.list/picks") {
+		if !errors.Is(err, ErrUnsupportedFeed) {
+			t.Errorf("list feed error mismatch: have %v, want %v", err, ErrUnsupportedFeed)
+		}
+	}
+	for _, err := range client.IterFeed(ctx, "at://did:plc:curator/picks") {
+		if !errors.Is(err, syntax.ErrInvalidSyntax) {
+			t.Errorf("malformed feed error mismatch: have %v, want %v", err, syntax.ErrInvalidSyntax)
+		}
+	}
+	itemc, errc = client.StreamFeed(ctx, "at://did:plc:curator/app.bsky.graph.list/picks")
+	for range itemc {
+		t.Errorf("list feed delivered items")
+	}
+	if err := <-errc; !errors.Is(err, ErrUnsupportedFeed) {
+		t.Errorf("list feed stream error mismatch: have %v, want %v", err, ErrUnsupportedFeed)
+	}
+	// Retrieve the feed generator's metadata
+	gen, err := client.FetchFeedGenerator(ctx, testFeed)
+	if err != nil {
+		t.Fatalf("failed to fetch feed generator: %v", err)
+	}
+	if gen.Name != "Picks" || gen.Description != "Hand picked posts" || gen.AvatarURL == "" || gen.LikeCount != 42 {
+		t.Errorf("feed generator metadata mismatch: have %+v", gen)
+	}
+	if gen.DID != "did:web:feeds.test" || gen.Creator.Handle != "curator.test" || !gen.Online || gen.Valid {
+		t.Errorf("feed generator status mismatch: have %+v", gen)
+	}
+}
+
+// Tests that feeds can be saved, pinned, reordered and removed, retaining the
+// unrelated preferences and keeping the deprecated format in sync. Feeds given
+// by handle are stored and matched by DID.
+func TestSavedFeeds(t *testing.T) {
+	const (
+		feedA = "at://did:plc:curator/app.bsky.feed.generator/a"
+		feedB = "at://did:plc:curator/app.bsky.feed.generator/b"
+		list  = "at://did:plc:curator/app.bsky.graph.list/c"
+	)
+	var (
+		server = &testFeedServer{prefs: json.RawMessage(`[
+			{"$type": "app.bsky.actor.defs#adultContentPref", "enabled": false},
+			{"$type": "app.bsky.actor.defs#savedFeedsPref", "saved": ["` + feedA + `"], "pinned": ["` + feedA + `"]}
+		]`)}
+		client = makeTestServerClient(t, server)
+		ctx    = context.Background()
+	)
+	// Ensure the deprecated format is picked up if the current one is missing,
+	// with the home timeline injected in front
+	feeds, err := client.SavedFeeds(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve saved feeds: %v", err)
+	}
+	if len(feeds) != 2 {
+		t.Fatalf("legacy saved feed count mismatch: have %d, want %d", len(feeds), 2)
+	}
+	if feeds[0].Type != SavedFeedTimeline || feeds[0].Value != "following" || !feeds[0].Pinned {
+		t.Errorf("injected timeline mismatch: have %+v", feeds[0])
+	}
+	if feeds[1].Value != feedA || !feeds[1].Pinned || feeds[1].Type != SavedFeedGenerator {
+		t.Errorf("legacy saved feed mismatch: have %+v", feeds[1])
+	}
+	// Save, pin and unpin a few feeds, checking the final state
+	if err := client.SaveFeed(ctx, feedB); err != nil {
+		t.Fatalf("failed to save feed: %v", err)
+	}
+	if err := client.SaveFeed(ctx, "at://Curator.Test/app.bsky.feed.generator/b"); err != nil {
+		t.Fatalf("failed to re-save feed by handle: %v", err)
+	}
+	if err := client.PinFeed(ctx, "at://curator.test/app.bsky.graph.list/c"); err != nil {
+		t.Fatalf("failed to pin list: %v", err)
+	}
+	if err := client.UnpinFeed(ctx, feedA); err != nil {
+		t.Fatalf("failed to unpin feed: %v", err)
+	}
+	if err := client.ReorderFeeds(ctx, list, "at://curator.test/app.bsky.feed.generator/b"); err != nil {
+		t.Fatalf("failed to reorder feeds: %v", err)
+	}
+	feeds, err = client.SavedFeeds(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve saved feeds: %v", err)
+	}
+	want := []SavedFeed{
+		{Type: SavedFeedList, Value: list, Pinned: true},
+		{Type: SavedFeedGenerator, Value: feedB},
+		{Type: SavedFeedTimeline, Value: "following", Pinned: true},
+		{Type: SavedFeedGenerator, Value: feedA},
+	}
+	if len(feeds) != len(want) {
+		t.Fatalf("saved feed count mismatch: have %d, want %d", len(feeds), len(want))
+	}
+	for i, feed := range feeds {
+		if feed.Type != want[i].Type || feed.Value != want[i].Value || feed.Pinned != want[i].Pinned || feed.ID == "" {
+			t.Errorf("saved feed %d mismatch: have %+v, want %+v", i, feed, want[i])
+		}
+	}
+	// Ensure the unrelated and deprecated preferences are retained and synced
+	prefs, err := client.fetchPreferences(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve preferences: %v", err)
+	}
+	if prefs.find("app.bsky.actor.defs#adultContentPref") == nil {
+		t.Errorf("unrelated preference dropped")
+	}
+	legacy := prefs.find(savedFeedsLegacyPrefType)
+	if have, want := string(legacy["saved"]), `["`+list+`","`+feedB+`","`+feedA+`"]`; have != want {
+		t.Errorf("legacy saved feeds mismatch: have %s, want %s", have, want)
+	}
+	if have, want := string(legacy["pinned"]), `["`+list+`"]`; have != want {
+		t.Errorf("legacy pinned feeds mismatch: have %s, want %s", have, want)
+	}
+	// Remove a feed and ensure invalid operations are rejected
+	if err := client.UnsaveFeed(ctx, feedA); err != nil {
+		t.Fatalf("failed to unsave feed: %v", err)
+	}
+	if feeds, _ := client.SavedFeeds(ctx); len(feeds) != 3 {
+		t.Errorf("saved feed count mismatch after removal: have %d, want %d", len(feeds), 3)
+	}
+	if err := client.SaveFeed(ctx, "at://did:plc:curator/app.bsky.feed.post/a"); !errors.Is(err, ErrUnsupportedFeed) {
+		t.Errorf("post save error mismatch: have %v, want %v", err, ErrUnsupportedFeed)
+	}
+	if err := client.ReorderFeeds(ctx, feedA); err == nil {
+		t.Errorf("reordering unsaved feed succeeded")
+	}
+}
+
+// Tests that a deprecated saved feeds preference with its lists omitted is read
+// as empty instead of failing, and can be migrated.
+func TestSavedFeedsLegacyPartial(t *testing.T) {
+	const feed = "at://did:plc:curator/app.bsky.feed.generator/a"
+
+	var (
+		server = &testFeedServer{prefs: json.RawMessage(`[{"$type": "app.bsky.actor.defs#savedFeedsPref", "saved": ["` + feed + `"]}]`)}
+		client = makeTestServerClient(t, server)
+		ctx    = context.Background()
+	)
+	feeds, err := client.SavedFeeds(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve saved feeds: %v", err)
+	}
+	if len(feeds) != 2 || feeds[0].Type != SavedFeedTimeline || feeds[1].Value != feed || feeds[1].Pinned {
+		t.Fatalf("legacy saved feeds mismatch: have %v", feeds)
+	}
+	server.prefs = json.RawMessage(`[{"$type": "app.bsky.actor.defs#savedFeedsPref"}]`)
+	if err := client.PinFeed(ctx, feed); err != nil {
+		t.Fatalf("failed to pin feed: %v", err)
+	}
+	if feeds, err = client.SavedFeeds(ctx); err != nil {
+		t.Fatalf("failed to retrieve saved feeds: %v", err)
+	}
+	if len(feeds) != 2 || feeds[0].Type != SavedFeedTimeline || feeds[1].Value != feed || !feeds[1].Pinned {
+		t.Errorf("migrated saved feeds mismatch: have %v", feeds)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package feedgen
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+const (
+	// skeletonMethod is the XRPC method service tokens are expected to be scoped
+	// to, if they are scoped at all.
+	skeletonMethod = "app.bsky.feed.getFeedSkeleton"
+
+	// keyRefreshInterval is the minimum time between two forced refreshes of the
+	// same user's signing key, to avoid forged tokens hammering the resolver.
+	keyRefreshInterval = time.Minute
+)
+
+// serviceClaims are the claims of an inter-service JWT, issued by the requesting
+// user's PDS and signed with the user's atproto signing key.
+type serviceClaims struct {
+	Issuer   string `json:"iss"` // DID of the requesting user, optionally with a service fragment
+	Audience string `json:"aud"` // DID of the feed generator service, optionally with a service fragment
+	Expiry   int64  `json:"exp"` // Unix timestamp when the token expires
+	Method   string `json:"lxm"` // XRPC method the token is scoped to, empty if unscoped
+}
+
+// authenticate verifies the inter-service JWT in an authorization header and
+// returns the DID of the user the request is made on behalf of. An empty DID is
+// returned without an error if the header is missing, as feeds may be served to
+// logged out users too.
+//
+// The token is signed with the user's atproto signing key. The resolved key is
+// cached, so on a signature mismatch the key is looked up again in case it was
+// rotated in the meantime, at most once per refresh interval per user.
+func (s *Server) authenticate(ctx context.Context, header string) (string, error) {
+	if header == "" {
+		return "", nil
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return "", fmt.Errorf("%w: not a bearer token", ErrInvalidToken)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	// Decode the header and claims, validating everything but the signature
+	var head struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return "", err
+	}
+	if head.Alg != "ES256K" && head.Alg != "ES256" {
+		return "", fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, head.Alg)
+	}
+	var claims serviceClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", err
+	}
+	if aud, _, _ := strings.Cut(claims.Audience, "#"); aud != s.config.ServiceDID {
+		return "", fmt.Errorf("%w: audience %q, want %q", ErrInvalidToken, claims.Audience, s.config.ServiceDID)
+	}
+	if time.Now().Unix() >= claims.Expiry {
+		return "", fmt.Errorf("%w: expired at %v", ErrInvalidToken, time.Unix(claims.Expiry, 0))
+	}
+	if claims.Method != "" && claims.Method != skeletonMethod {
+		return "", fmt.Errorf("%w: scoped to %q", ErrInvalidToken, claims.Method)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	// Verify the signature against the issuer's key, refreshing it once on failure
+	did, _, _ := strings.Cut(claims.Issuer, "#")
+	if _, err := syntax.ParseDID(did); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	for attempt := 0; ; attempt++ {
+		doc, err := s.config.Resolver.ResolveDID(ctx, did)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		key, err := crypto.ParsePublicMultibase(doc.SigningKey())
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid signing key of %s: %v", ErrInvalidToken, did, err)
+		}
+		if err = key.HashAndVerifyLenient(signed, sig); err == nil {
+			return did, nil
+		}
+		if attempt > 0 || !s.refreshable(did, time.Now()) {
+			return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		s.config.Resolver.Purge(did)
+	}
+}
+
+// refreshable checks whether the signing key of a user may be force refreshed
+// at a given time, recording the refresh if so.
+func (s *Server) refreshable(did string, now time.Time) bool {
+	s.refreshLock.Lock()
+	defer s.refreshLock.Unlock()
+
+	if now.Before(s.refreshed[did].Add(keyRefreshInterval)) {
+		return false
+	}
+	// Drop stale refresh times every now and again to avoid leaking memory
+	if len(s.refreshed) > 1024 {
+		for user, last := range s.refreshed {
+			if !now.Before(last.Add(keyRefreshInterval)) {
+				delete(s.refreshed, user)
+			}
+		}
+	}
+	s.refreshed[did] = now
+	return true
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT.
+func decodeSegment(segment string, v any) error {
+	blob, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(blob, v); err != nil {
+		return fmt.Errorf("%w: malformed segment: %v", ErrInvalidToken, err)
+	}
+	return nil
+}
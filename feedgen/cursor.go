@@ -0,0 +1,39 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package feedgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor is a position within a feed, sent to the AppView along with a page and
+// passed back when requesting the next one. It is the timestamp of the last post
+// on the page, with a key to break ties between posts with the same timestamp
+// (e.g. the content hash or record key of the post).
+type Cursor struct {
+	Time time.Time // Timestamp of the last post served, at millisecond precision
+	Key  string    // Tie breaker between posts with the same timestamp
+}
+
+// String encodes the cursor into its wire format.
+func (c *Cursor) String() string {
+	return strconv.FormatInt(c.Time.UnixMilli(), 10) + "::" + c.Key
+}
+
+// ParseCursor decodes a cursor from its wire format.
+func ParseCursor(s string) (*Cursor, error) {
+	ms, key, ok := strings.Cut(s, "::")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q: missing separator", ErrInvalidCursor, s)
+	}
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%w: %q: invalid timestamp", ErrInvalidCursor, s)
+	}
+	return &Cursor{Time: time.UnixMilli(n), Key: key}, nil
+}
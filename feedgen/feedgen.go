@@ -0,0 +1,280 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package feedgen is a framework for hosting custom Bluesky feeds. It serves the
+// feed skeletons to the AppView, publishes the did:web document of the service,
+// authenticates the users requesting the feeds and publishes the feed records.
+package feedgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karalabe/go-bluesky/identity"
+)
+
+var (
+	// ErrUnknownFeed is returned if a feed is requested that is not hosted by the
+	// server.
+	ErrUnknownFeed = errors.New("unknown feed")
+
+	// ErrInvalidCursor is returned if a feed is requested with a cursor that was
+	// not issued by the server.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidToken is returned if a feed is requested with an authentication
+	// token that is malformed, expired, not addressed to the server or not signed
+	// by its issuer.
+	ErrInvalidToken = errors.New("invalid service token")
+)
+
+const (
+	// defaultLimit is the number of posts to return if the request does not say.
+	defaultLimit = 50
+
+	// maxLimit is the maximum number of posts a request may ask for.
+	maxLimit = 100
+)
+
+// Handler is a callback to generate a page of a feed with. Failures are passed
+// to the configured error hook and reported to the AppView as server errors. A
+// nil skeleton is served as an empty page.
+type Handler func(ctx context.Context, req *Request) (*Skeleton, error)
+
+// Feed is a custom feed hosted by the server, along with the metadata to publish
+// its record with.
+type Feed struct {
+	Name        string  // Record key of the feed, the last component of its AT-URI
+	DisplayName string  // Name of the feed shown in the apps
+	Description string  // Description of the feed shown in the apps, empty if none
+	Avatar      []byte  // Picture of the feed (PNG or JPEG), nil if none
+	Handler     Handler // Callback generating the feed's pages
+}
+
+// Request is a query for a page of a feed.
+type Request struct {
+	Feed      string  // AT-URI of the requested feed
+	Requester string  // DID of the user requesting the feed, empty if anonymous
+	Cursor    *Cursor // Position to continue the feed from, nil for the first page
+	Limit     int     // Maximum number of posts to return
+}
+
+// Skeleton is a page of a feed, containing only references to the posts, which
+// the AppView hydrates before serving them to the user.
+type Skeleton struct {
+	Posts  []*SkeletonPost // Posts on the page of the feed
+	Cursor *Cursor         // Position to continue the feed from, nil if exhausted
+}
+
+// SkeletonPost is a reference to a post in a feed.
+type SkeletonPost struct {
+	URI     string // AT-URI of the post
+	Repost  string // AT-URI of the repost that surfaced the post, empty if none
+	Context string // Opaque context passed back in interactions, empty if none
+}
+
+// Config is the set of options to configure a feed generator server with.
+type Config struct {
+	Hostname   string             // Public hostname the server is reachable at (e.g. feeds.example.com)
+	Publisher  string             // DID of the account publishing the feed records
+	ServiceDID string             // DID of the feed generator service (empty = did:web:<Hostname>)
+	Resolver   *identity.Resolver // Resolver to look up requester signing keys with (nil = default)
+
+	OnError func(req *Request, err error) // Hook to report feed generation failures to, nil to ignore
+}
+
+// Server is a feed generator, hosting a set of custom feeds over HTTP.
+type Server struct {
+	config *Config // Server options to respect
+
+	lock  sync.RWMutex     // Lock protecting the registered feeds
+	feeds map[string]*Feed // Registered feeds, indexed by name
+
+	refreshLock sync.Mutex           // Lock protecting the key refresh times
+	refreshed   map[string]time.Time // Last forced signing key refresh per user
+}
+
+// New creates a feed generator server. The server is an http.Handler, which
+// needs to be served over HTTPS at the configured hostname.
+func New(config Config) (*Server, error) {
+	if config.Hostname == "" {
+		return nil, errors.New("feed generator hostname required")
+	}
+	if config.Publisher == "" {
+		return nil, errors.New("feed publisher DID required")
+	}
+	if config.ServiceDID == "" {
+		config.ServiceDID = "did:web:" + config.Hostname
+	}
+	if config.Resolver == nil {
+		config.Resolver = identity.New(identity.Config{})
+	}
+	return &Server{
+		config:    &config,
+		feeds:     make(map[string]*Feed),
+		refreshed: make(map[string]time.Time),
+	}, nil
+}
+
+// Register adds a feed to the server, replacing any previous one with the same
+// name.
+func (s *Server) Register(feed *Feed) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.feeds[feed.Name] = feed
+}
+
+// URI returns the AT-URI of a feed hosted by the server.
+func (s *Server) URI(name string) string {
+	return "at://" + s.config.Publisher + "/app.bsky.feed.generator/" + name
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/did.json":
+		if s.config.ServiceDID != "did:web:"+s.config.Hostname {
+			http.NotFound(w, r)
+			return
+		}
+		s.serveDocument(w)
+
+	case "/xrpc/app.bsky.feed.describeFeedGenerator":
+		s.serveDescription(w)
+
+	case "/xrpc/app.bsky.feed.getFeedSkeleton":
+		s.serveSkeleton(w, r)
+
+	default:
+		writeError(w, http.StatusNotImplemented, "MethodNotImplemented", "method not implemented")
+	}
+}
+
+// serveDocument responds with the did:web document of the service.
+func (s *Server) serveDocument(w http.ResponseWriter) {
+	writeJSON(w, map[string]any{
+		"@context": []string{"https://www.w3.org/ns/did/v1"},
+		"id":       s.config.ServiceDID,
+		"service": []map[string]string{{
+			"id":              "#bsky_fg",
+			"type":            "BskyFeedGenerator",
+			"serviceEndpoint": "https://" + s.config.Hostname,
+		}},
+	})
+}
+
+// serveDescription responds with the list of feeds hosted by the service.
+func (s *Server) serveDescription(w http.ResponseWriter) {
+	s.lock.RLock()
+	feeds := make([]map[string]string, 0, len(s.feeds))
+	for name := range s.feeds {
+		feeds = append(feeds, map[string]string{"uri": s.URI(name)})
+	}
+	s.lock.RUnlock()
+
+	writeJSON(w, map[string]any{
+		"did":   s.config.ServiceDID,
+		"feeds": feeds,
+	})
+}
+
+// serveSkeleton authenticates a feed request, generates the requested page of
+// the feed and responds with its skeleton.
+func (s *Server) serveSkeleton(w http.ResponseWriter, r *http.Request) {
+	requester, err := s.authenticate(r.Context(), r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "AuthenticationRequired", err.Error())
+		return
+	}
+	// Parse the feed request and look up the feed to serve
+	query := r.URL.Query()
+	req := &Request{
+		Feed:      query.Get("feed"),
+		Requester: requester,
+		Limit:     defaultLimit,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxLimit {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("invalid limit %q", limit))
+			return
+		}
+		req.Limit = n
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		if req.Cursor, err = ParseCursor(cursor); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+			return
+		}
+	}
+	s.lock.RLock()
+	var feed *Feed
+	for name, f := range s.feeds {
+		if s.URI(name) == req.Feed {
+			feed = f
+		}
+	}
+	s.lock.RUnlock()
+
+	if feed == nil {
+		writeError(w, http.StatusBadRequest, "UnknownFeed", fmt.Sprintf("%v: %s", ErrUnknownFeed, req.Feed))
+		return
+	}
+	// Generate the page and convert it to the wire format
+	skeleton, err := feed.Handler(r.Context(), req)
+	if err != nil {
+		if s.config.OnError != nil {
+			s.config.OnError(req, err)
+		}
+		writeError(w, http.StatusInternalServerError, "InternalServerError", "failed to generate feed")
+		return
+	}
+	if skeleton == nil {
+		skeleton = new(Skeleton)
+	}
+	type skeletonPost struct {
+		Post        string          `json:"post"`
+		Reason      json.RawMessage `json:"reason,omitempty"`
+		FeedContext string          `json:"feedContext,omitempty"`
+	}
+	res := struct {
+		Feed   []*skeletonPost `json:"feed"`
+		Cursor string          `json:"cursor,omitempty"`
+	}{Feed: make([]*skeletonPost, 0, len(skeleton.Posts))}
+
+	for _, post := range skeleton.Posts {
+		item := &skeletonPost{Post: post.URI, FeedContext: post.Context}
+		if post.Repost != "" {
+			item.Reason, _ = json.Marshal(map[string]string{
+				"$type":  "app.bsky.feed.defs#skeletonReasonRepost",
+				"repost": post.Repost,
+			})
+		}
+		res.Feed = append(res.Feed, item)
+	}
+	if skeleton.Cursor != nil {
+		res.Cursor = skeleton.Cursor.String()
+	}
+	writeJSON(w, res)
+}
+
+// writeJSON responds with a JSON encoded value.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError responds with an XRPC error.
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "message": message})
+}
@@ -0,0 +1,407 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package feedgen
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/karalabe/go-bluesky"
+	"github.com/karalabe/go-bluesky/identity"
+)
+
+// testPLCServer is a fake PLC directory serving the documents of test users.
+type testPLCServer struct {
+	lock    sync.Mutex
+	keys    map[string]crypto.PrivateKey // Signing keys of the users, indexed by DID
+	lookups map[string]int               // Number of document lookups per DID
+}
+
+func (s *testPLCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	did := strings.TrimPrefix(r.URL.Path, "/")
+	s.lookups[did]++
+
+	key, ok := s.keys[did]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	pub, _ := key.PublicKey()
+	json.NewEncoder(w).Encode(&identity.Document{
+		ID: did,
+		VerificationMethod: []*identity.VerificationMethod{{
+			ID:                 did + "#atproto",
+			Type:               "Multikey",
+			Controller:         did,
+			PublicKeyMultibase: pub.Multibase(),
+		}},
+	})
+}
+
+// rotate replaces the signing key of a test user with a new one.
+func (s *testPLCServer) rotate(t *testing.T, did string) crypto.PrivateKey {
+	t.Helper()
+
+	key, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatalf("failed to generate signing key: %v", err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.keys[did] = key
+	return key
+}
+
+// makeTestToken creates an inter-service JWT signed with the given key.
+func makeTestToken(t *testing.T, key crypto.PrivateKey, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "ES256K", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := key.HashAndSign([]byte(signed))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// makeTestServer creates a feed generator hosting a single feed of 5 posts, with
+// requester keys resolved from a fake PLC directory.
+func makeTestServer(t *testing.T) (*Server, *testPLCServer, *[]string) {
+	t.Helper()
+
+	plc := &testPLCServer{keys: make(map[string]crypto.PrivateKey), lookups: make(map[string]int)}
+	srv := httptest.NewServer(plc)
+	t.Cleanup(srv.Close)
+
+	server, err := New(Config{
+		Hostname:  "feeds.test",
+		Publisher: "did:plc:curator",
+		Resolver:  identity.New(identity.Config{PLCDirectory: srv.URL, HTTPClient: srv.Client()}),
+	})
+	if err != nil {
+		t.Fatalf("failed to create feed generator: %v", err)
+	}
+	requesters := new([]string)
+	server.Register(&Feed{
+		Name:        "picks",
+		DisplayName: "Picks",
+		Handler: func(ctx context.Context, req *Request) (*Skeleton, error) {
+			*requesters = append(*requesters, req.Requester)
+
+			start := 0
+			if req.Cursor != nil {
+				fmt.Sscanf(req.Cursor.Key, "%d", &start)
+			}
+			skeleton := new(Skeleton)
+			for i := start; i < min(start+req.Limit, 5); i++ {
+				post := &SkeletonPost{URI: fmt.Sprintf("at://did:plc:bob/app.bsky.feed.post/%d", i)}
+				if i == 1 {
+					post.Repost = "at://did:plc:carol/app.bsky.feed.repost/1"
+				}
+				skeleton.Posts = append(skeleton.Posts, post)
+			}
+			if start+req.Limit < 5 {
+				skeleton.Cursor = &Cursor{Time: time.UnixMilli(1700000000000), Key: fmt.Sprint(start + req.Limit)}
+			}
+			return skeleton, nil
+		},
+	})
+	return server, plc, requesters
+}
+
+// serve runs a request against a feed generator, returning the status code and
+// the decoded response.
+func serve(t *testing.T, server *Server, path string, token string) (int, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	var res map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s: failed to decode response: %v", path, err)
+	}
+	return rec.Code, res
+}
+
+// Tests that the service document and feed description are served.
+func TestServeMetadata(t *testing.T) {
+	server, _, _ := makeTestServer(t)
+
+	code, doc := serve(t, server, "/.well-known/did.json", "")
+	if code != http.StatusOK || doc["id"] != "did:web:feeds.test" {
+		t.Fatalf("did document mismatch: have %d %v", code, doc)
+	}
+	service := doc["service"].([]any)[0].(map[string]any)
+	if service["id"] != "#bsky_fg" || service["serviceEndpoint"] != "https://feeds.test" {
+		t.Errorf("service endpoint mismatch: have %v", service)
+	}
+	code, desc := serve(t, server, "/xrpc/app.bsky.feed.describeFeedGenerator", "")
+	if code != http.StatusOK || desc["did"] != "did:web:feeds.test" {
+		t.Fatalf("description mismatch: have %d %v", code, desc)
+	}
+	feeds := desc["feeds"].([]any)
+	if len(feeds) != 1 || feeds[0].(map[string]any)["uri"] != "at://did:plc:curator/app.bsky.feed.generator/picks" {
+		t.Errorf("described feeds mismatch: have %v", feeds)
+	}
+}
+
+// Tests that feed skeletons are served page by page, with cursors round-tripped
+// and malformed requests rejected.
+func TestServeSkeleton(t *testing.T) {
+	server, _, _ := makeTestServer(t)
+
+	var (
+		feed   = url.QueryEscape(server.URI("picks"))
+		cursor = ""
+		posts  []any
+	)
+	for pages := 1; ; pages++ {
+		path := "/xrpc/app.bsky.feed.getFeedSkeleton?limit=2&feed=" + feed
+		if cursor != "" {
+			path += "&cursor=" + url.QueryEscape(cursor)
+		}
+		code, res := serve(t, server, path, "")
+		if code != http.StatusOK {
+			t.Fatalf("page %d: failed to serve skeleton: %d %v", pages, code, res)
+		}
+		posts = append(posts, res["feed"].([]any)...)
+		if res["cursor"] == nil {
+			if pages != 3 {
+				t.Errorf("page count mismatch: have %d, want %d", pages, 3)
+			}
+			break
+		}
+		cursor = res["cursor"].(string)
+	}
+	if len(posts) != 5 {
+		t.Fatalf("post count mismatch: have %d, want %d", len(posts), 5)
+	}
+	if reason := posts[1].(map[string]any)["reason"].(map[string]any); reason["repost"] != "at://did:plc:carol/app.bsky.feed.repost/1" {
+		t.Errorf("repost reason mismatch: have %v", reason)
+	}
+	// Ensure invalid requests are rejected
+	tests := []struct {
+		query string
+		code  string
+	}{
+		{"feed=" + url.QueryEscape("at://did:plc:curator/app.bsky.feed.generator/other"), "UnknownFeed"},
+		{"feed=" + feed + "&cursor=garbage", "InvalidRequest"},
+		{"feed=" + feed + "&limit=1000", "InvalidRequest"},
+	}
+	for _, tt := range tests {
+		code, res := serve(t, server, "/xrpc/app.bsky.feed.getFeedSkeleton?"+tt.query, "")
+		if code != http.StatusBadRequest || res["error"] != tt.code {
+			t.Errorf("%s: error mismatch: have %d %v, want %s", tt.query, code, res["error"], tt.code)
+		}
+	}
+	// Ensure a handler returning no skeleton is served an empty page
+	server.Register(&Feed{Name: "empty", Handler: func(ctx context.Context, req *Request) (*Skeleton, error) {
+		return nil, nil
+	}})
+	code, res := serve(t, server, "/xrpc/app.bsky.feed.getFeedSkeleton?feed="+url.QueryEscape(server.URI("empty")), "")
+	if posts, ok := res["feed"].([]any); code != http.StatusOK || !ok || len(posts) != 0 || res["cursor"] != nil {
+		t.Errorf("empty skeleton mismatch: have %d %v", code, res)
+	}
+}
+
+// Tests that inter-service tokens are verified against the requester's signing
+// key, including after a key rotation.
+func TestServeAuthenticated(t *testing.T) {
+	server, plc, requesters := makeTestServer(t)
+	key := plc.rotate(t, "did:plc:alice")
+
+	var (
+		path   = "/xrpc/app.bsky.feed.getFeedSkeleton?feed=" + url.QueryEscape(server.URI("picks"))
+		expiry = time.Now().Add(time.Minute).Unix()
+		claims = map[string]any{"iss": "did:plc:alice", "aud": "did:web:feeds.test", "exp": expiry, "lxm": skeletonMethod}
+	)
+	if code, res := serve(t, server, path, makeTestToken(t, key, claims)); code != http.StatusOK {
+		t.Fatalf("failed to serve authenticated skeleton: %d %v", code, res)
+	}
+	// Rotate the key and ensure the cached one is refreshed
+	key = plc.rotate(t, "did:plc:alice")
+	if code, res := serve(t, server, path, makeTestToken(t, key, claims)); code != http.StatusOK {
+		t.Fatalf("failed to serve skeleton after key rotation: %d %v", code, res)
+	}
+	if have := strings.Join(*requesters, ","); have != "did:plc:alice,did:plc:alice" {
+		t.Errorf("requester mismatch: have %s", have)
+	}
+	// Ensure invalid tokens are rejected, without repeatedly refreshing the key
+	plc.lock.Lock()
+	lookups := plc.lookups["did:plc:alice"]
+	plc.lock.Unlock()
+
+	forged, _ := crypto.GeneratePrivateKeyK256()
+	tests := []struct {
+		name   string
+		key    crypto.PrivateKey
+		claims map[string]any
+	}{
+		{"forged", forged, claims},
+		{"audience", key, map[string]any{"iss": "did:plc:alice", "aud": "did:web:other.test", "exp": expiry}},
+		{"expired", key, map[string]any{"iss": "did:plc:alice", "aud": "did:web:feeds.test", "exp": time.Now().Add(-time.Minute).Unix()}},
+		{"scope", key, map[string]any{"iss": "did:plc:alice", "aud": "did:web:feeds.test", "exp": expiry, "lxm": "app.bsky.feed.getFeed"}},
+		{"issuer", key, map[string]any{"iss": "did:plc:mallory", "aud": "did:web:feeds.test", "exp": expiry}},
+	}
+	for _, tt := range tests {
+		code, res := serve(t, server, path, makeTestToken(t, tt.key, tt.claims))
+		if code != http.StatusUnauthorized || res["error"] != "AuthenticationRequired" {
+			t.Errorf("%s: error mismatch: have %d %v", tt.name, code, res)
+		}
+	}
+	if code, _ := serve(t, server, path, "not-a-jwt"); code != http.StatusUnauthorized {
+		t.Errorf("malformed token status mismatch: have %d, want %d", code, http.StatusUnauthorized)
+	}
+	plc.lock.Lock()
+	defer plc.lock.Unlock()
+
+	if have := plc.lookups["did:plc:alice"]; have != lookups {
+		t.Errorf("forged tokens refreshed the signing key: have %d lookups, want %d", have, lookups)
+	}
+}
+
+// Tests that cursors survive a round trip through their wire format.
+func TestCursor(t *testing.T) {
+	cursor := &Cursor{Time: time.UnixMilli(1700000000123), Key: "bafy::reikey"}
+
+	parsed, err := ParseCursor(cursor.String())
+	if err != nil {
+		t.Fatalf("failed to parse cursor: %v", err)
+	}
+	if !parsed.Time.Equal(cursor.Time) || parsed.Key != cursor.Key {
+		t.Errorf("cursor mismatch: have %+v, want %+v", parsed, cursor)
+	}
+	for _, bad := range []string{"", "123", "abc::key", "-1::key"} {
+		if _, err := ParseCursor(bad); err == nil {
+			t.Errorf("%q: invalid cursor accepted", bad)
+		}
+	}
+}
+
+// Tests that feed records are published via an authenticated client.
+func TestPublish(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		records = make(map[string]map[string]any)
+	)
+	pds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.server.describeServer":
+			json.NewEncoder(w).Encode(map[string]any{"did": "did:web:pds.test", "availableUserDomains": []string{}})
+
+		case "/xrpc/com.atproto.server.createSession":
+			claims := jwt.MapClaims{"scope": "com.atproto.appPass", "exp": time.Now().Add(time.Hour).Unix()}
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+			json.NewEncoder(w).Encode(map[string]any{"did": "did:plc:curator", "handle": "curator.test", "accessJwt": token, "refreshJwt": token})
+
+		case "/xrpc/com.atproto.repo.uploadBlob":
+			io.Copy(io.Discard, r.Body)
+			json.NewEncoder(w).Encode(map[string]any{"blob": map[string]any{
+				"$type": "blob", "ref": map[string]string{"$link": "bafkreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"},
+				"mimeType": "image/png", "size": 4,
+			}})
+
+		case "/xrpc/com.atproto.repo.getRecord":
+			query := r.URL.Query()
+			uri := "at://" + query.Get("repo") + "/" + query.Get("collection") + "/" + query.Get("rkey")
+			record, ok := records[uri]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "RecordNotFound"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"uri": uri, "cid": "cid", "value": record})
+
+		case "/xrpc/com.atproto.repo.putRecord":
+			var input struct {
+				Repo       string         `json:"repo"`
+				Collection string         `json:"collection"`
+				Rkey       string         `json:"rkey"`
+				Record     map[string]any `json:"record"`
+			}
+			json.NewDecoder(r.Body).Decode(&input)
+			uri := "at://" + input.Repo + "/" + input.Collection + "/" + input.Rkey
+			records[uri] = input.Record
+			json.NewEncoder(w).Encode(map[string]string{"uri": uri, "cid": "cid"})
+		}
+	}))
+	defer pds.Close()
+
+	client, err := bluesky.DialWithClient(context.Background(), pds.URL, new(http.Client))
+	if err != nil {
+		t.Fatalf("failed to dial fake PDS: %v", err)
+	}
+	defer client.Close()
+	if err := client.Login(context.Background(), "curator.test", "app-pass"); err != nil {
+		t.Fatalf("failed to log in to fake PDS: %v", err)
+	}
+	server, _, _ := makeTestServer(t)
+	server.Register(&Feed{Name: "art", DisplayName: "Art", Description: "Pretty things", Avatar: []byte("\x89PNG")})
+
+	refs, err := server.Publish(context.Background(), client)
+	if err != nil {
+		t.Fatalf("failed to publish feeds: %v", err)
+	}
+	if len(refs) != 2 || len(records) != 2 {
+		t.Fatalf("published feed count mismatch: have %d/%d, want 2", len(refs), len(records))
+	}
+	art := records[server.URI("art")]
+	if art["$type"] != "app.bsky.feed.generator" || art["did"] != "did:web:feeds.test" || art["displayName"] != "Art" || art["description"] != "Pretty things" {
+		t.Errorf("feed record mismatch: have %v", art)
+	}
+	if art["avatar"] == nil {
+		t.Errorf("feed avatar missing")
+	}
+	if picks := records[server.URI("picks")]; picks["avatar"] != nil || picks["description"] != nil {
+		t.Errorf("feed record without extras mismatch: have %v", picks)
+	}
+	// Republish the feeds and ensure the original creation time and any fields set
+	// by other tools are retained, while the server's own ones are updated
+	records[server.URI("art")]["createdAt"] = "2023-05-01T10:00:00Z"
+	records[server.URI("art")]["acceptsInteractions"] = true
+	records[server.URI("picks")]["description"] = "Stale description"
+	records[server.URI("picks")]["descriptionFacets"] = []any{}
+
+	if _, err := server.Publish(context.Background(), client); err != nil {
+		t.Fatalf("failed to republish feeds: %v", err)
+	}
+	art = records[server.URI("art")]
+	if have := art["createdAt"]; have != "2023-05-01T10:00:00Z" {
+		t.Errorf("creation time not retained: have %v, want %v", have, "2023-05-01T10:00:00Z")
+	}
+	if art["acceptsInteractions"] != true || art["displayName"] != "Art" || art["avatar"] == nil {
+		t.Errorf("republished feed record mismatch: have %v", art)
+	}
+	if picks := records[server.URI("picks")]; picks["description"] != nil || picks["descriptionFacets"] != nil {
+		t.Errorf("stale description retained: have %v", picks)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package feedgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/karalabe/go-bluesky"
+)
+
+// Publish creates or updates the app.bsky.feed.generator records of all the
+// feeds registered on the server, making them discoverable in the apps. The
+// client must be logged in as the configured publisher.
+func (s *Server) Publish(ctx context.Context, client *bluesky.Client) ([]*bluesky.RecordRef, error) {
+	s.lock.RLock()
+	feeds := make([]*Feed, 0, len(s.feeds))
+	for _, feed := range s.feeds {
+		feeds = append(feeds, feed)
+	}
+	s.lock.RUnlock()
+
+	refs := make([]*bluesky.RecordRef, 0, len(feeds))
+	for _, feed := range feeds {
+		ref, err := s.publish(ctx, client, feed)
+		if err != nil {
+			return refs, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// publishedFields are the fields of a feed generator record managed by the server,
+// any other field of an already published record is retained when updating it.
+var publishedFields = []string{"$type", "did", "displayName", "description", "avatar"}
+
+// publish creates or updates the record of a single feed, uploading its avatar
+// first if set. When updating, only the fields managed by the server are replaced,
+// retaining the creation time and any fields set by other tools.
+func (s *Server) publish(ctx context.Context, client *bluesky.Client, feed *Feed) (*bluesky.RecordRef, error) {
+	uri := s.URI(feed.Name)
+
+	record := &bsky.FeedGenerator{
+		LexiconTypeID: "app.bsky.feed.generator",
+		Did:           s.config.ServiceDID,
+		DisplayName:   feed.DisplayName,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if feed.Description != "" {
+		record.Description = &feed.Description
+	}
+	if feed.Avatar != nil {
+		err := client.CustomCall(func(api *xrpc.Client) error {
+			res, err := atproto.RepoUploadBlob(ctx, api, bytes.NewReader(feed.Avatar))
+			if err != nil {
+				return err
+			}
+			record.Avatar = res.Blob
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	blob, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		return nil, err
+	}
+	existing, err := bluesky.GetRecord[map[string]json.RawMessage](ctx, client, uri)
+	switch {
+	case err == nil:
+		merged := existing.Value
+		if merged == nil {
+			merged = make(map[string]json.RawMessage)
+		}
+		// Rich text annotations of a changed description would point into the void
+		var before, after string
+		json.Unmarshal(merged["description"], &before)
+		json.Unmarshal(fields["description"], &after)
+		if before != after {
+			delete(merged, "descriptionFacets")
+		}
+		for _, field := range publishedFields {
+			if value, ok := fields[field]; ok {
+				merged[field] = value
+			} else {
+				delete(merged, field)
+			}
+		}
+		if _, ok := merged["createdAt"]; !ok {
+			merged["createdAt"] = fields["createdAt"]
+		}
+		return bluesky.PutRecord(ctx, client, uri, merged, bluesky.WithSwapRecord(existing.CID))
+
+	case errors.Is(err, bluesky.ErrRecordNotFound):
+		return bluesky.PutRecord(ctx, client, uri, fields)
+
+	default:
+		return nil, err
+	}
+}
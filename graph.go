@@ -0,0 +1,210 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+// maxRelationshipsPerCall is the maximum number of other actors the server will
+// accept in a single relationship query.
+const maxRelationshipsPerCall = 30
+
+// Relationship tracks the social graph relation between an actor and some other
+// user on a Bluesky server.
+type Relationship struct {
+	DID      string // Identifier of the other user (as requested if not found)
+	NotFound bool   // Whether the other user could not be found by the server
+
+	Following  string // URI of the actor's follow record, empty if not following
+	FollowedBy string // URI of the other user's follow record, empty if not followed
+	Blocking   string // URI of the actor's block record, empty if not blocking
+	BlockedBy  string // URI of the other user's block record, empty if not blocked
+}
+
+// relationshipsOutput is the response of an app.bsky.graph.getRelationships
+// call. It is defined locally as the generated bindings do not (yet?) decode
+// the block states that the server returns.
+type relationshipsOutput struct {
+	Relationships []*struct {
+		Type       string  `json:"$type"`
+		DID        string  `json:"did"`
+		Actor      string  `json:"actor"`
+		Following  *string `json:"following"`
+		FollowedBy *string `json:"followedBy"`
+		Blocking   *string `json:"blocking"`
+		BlockedBy  *string `json:"blockedBy"`
+	} `json:"relationships"`
+}
+
+// Relationships retrieves the social graph relation between an actor and a list
+// of other users. The results are returned in the same order as requested.
+//
+// Supported IDs are the Bluesky handles or atproto DIDs.
+//
+// Note, the server limits the number of users that can be queried at once, so
+// this method will split the request up into multiple API calls if needed.
+func (c *Client) Relationships(ctx context.Context, actor string, others ...string) ([]*Relationship, error) {
+	for _, id := range append([]string{actor}, others...) {
+		if _, err := syntax.ParseAtIdentifier(id); err != nil {
+			return nil, err
+		}
+	}
+	rels := make([]*Relationship, 0, len(others))
+	for len(others) > 0 {
+		// Query the next batch of relationships from the server
+		batch := others
+		if len(batch) > maxRelationshipsPerCall {
+			batch = batch[:maxRelationshipsPerCall]
+		}
+		others = others[len(batch):]
+
+		var res relationshipsOutput
+		params := map[string]interface{}{
+			"actor":  actor,
+			"others": batch,
+		}
+		if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.graph.getRelationships", params, nil, &res); err != nil {
+			return nil, err
+		}
+		// Dig out the relevant fields and drop pointless pointers
+		for _, rel := range res.Relationships {
+			if rel.Type == "app.bsky.graph.defs#notFoundActor" {
+				rels = append(rels, &Relationship{DID: rel.Actor, NotFound: true})
+				continue
+			}
+			r := &Relationship{DID: rel.DID}
+			if rel.Following != nil {
+				r.Following = *rel.Following
+			}
+			if rel.FollowedBy != nil {
+				r.FollowedBy = *rel.FollowedBy
+			}
+			if rel.Blocking != nil {
+				r.Blocking = *rel.Blocking
+			}
+			if rel.BlockedBy != nil {
+				r.BlockedBy = *rel.BlockedBy
+			}
+			rels = append(rels, r)
+		}
+	}
+	return rels, nil
+}
+
+// Mutuals retrieves the list of users that both follow and are followed by the
+// profile's owner.
+//
+// Note, the method picks between crawling both the follower and followee lists
+// and intersecting them; or only crawling the shorter one and querying the
+// relationships of the results. The cheaper route in API calls is used.
+func (p *Profile) Mutuals(ctx context.Context) ([]*User, error) {
+	// Figure out how many API calls each approach would need
+	var (
+		shorter = min(p.FollowerCount, p.FolloweeCount)
+		crawls  = (p.FollowerCount+p.FolloweeCount)/100 + 2
+		queries = shorter/100 + shorter/maxRelationshipsPerCall + 2
+	)
+	if crawls <= queries {
+		return p.intersectMutuals(ctx)
+	}
+	return p.queryMutuals(ctx)
+}
+
+// intersectMutuals crawls both the followers and followees of a profile and
+// returns the users present in both.
+func (p *Profile) intersectMutuals(ctx context.Context) ([]*User, error) {
+	// Ensure the crawlers are torn down if we bail out early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Gather up all the followees into a lookup set
+	followeec, errc := p.StreamFollowees(ctx)
+
+	followees := make(map[string]struct{}, p.FolloweeCount)
+	for followee := range followeec {
+		followees[followee.DID] = struct{}{}
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	// Stream the followers and retain only the followed ones
+	followerc, errc := p.StreamFollowers(ctx)
+
+	var mutuals []*User
+	for follower := range followerc {
+		if _, ok := followees[follower.DID]; ok {
+			mutuals = append(mutuals, follower)
+		}
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return mutuals, nil
+}
+
+// queryMutuals crawls the shorter of the follower and followee lists of a profile
+// and queries the relationship with the results in batches.
+func (p *Profile) queryMutuals(ctx context.Context) ([]*User, error) {
+	// Ensure the crawler is torn down if we bail out early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Stream whichever list is shorter
+	var (
+		userc <-chan *User
+		errc  <-chan error
+	)
+	if p.FollowerCount < p.FolloweeCount {
+		userc, errc = p.StreamFollowers(ctx)
+	} else {
+		userc, errc = p.StreamFollowees(ctx)
+	}
+	// Gather up users into batches and check whether the relation is mutual
+	var (
+		mutuals []*User
+		batch   = make([]*User, 0, maxRelationshipsPerCall)
+	)
+	flush := func() error {
+		dids := make([]string, len(batch))
+		for i, user := range batch {
+			dids[i] = user.DID
+		}
+		rels, err := p.client.Relationships(ctx, p.DID, dids...)
+		if err != nil {
+			return err
+		}
+		mutual := make(map[string]bool, len(rels))
+		for _, rel := range rels {
+			mutual[rel.DID] = rel.Following != "" && rel.FollowedBy != ""
+		}
+		for _, user := range batch {
+			if mutual[user.DID] {
+				mutuals = append(mutuals, user)
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for user := range userc {
+		if batch = append(batch, user); len(batch) == maxRelationshipsPerCall {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return mutuals, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"testing"
+)
+
+// Tests that the relationship between two users can be queried.
+func TestRelationships(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+	)
+	rels, err := client.Relationships(ctx, testDIDTester, testDIDPeter, "did:plc:thisdoesnotexistatall")
+	if err != nil {
+		t.Fatalf("failed to query relationships: %v", err)
+	}
+	if len(rels) != 2 {
+		t.Fatalf("relationship count mismatch: have %d, want %d", len(rels), 2)
+	}
+	if rels[0].DID != testDIDPeter {
+		t.Errorf("relationship target mismatch: have %v, want %v", rels[0].DID, testDIDPeter)
+	}
+	if rels[0].Following == "" { // only follow this lib's author
+		t.Errorf("following state mismatch: have empty, want non-empty")
+	}
+	if !rels[1].NotFound {
+		t.Errorf("not found state mismatch: have %v, want %v", rels[1].NotFound, true)
+	}
+}
+
+// Tests that relationship queries above the server limit get split into batches.
+func TestRelationshipsBatching(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+	)
+	profile, err := client.FetchProfile(ctx, testDIDTester)
+	if err != nil {
+		t.Fatalf("failed to fetch user profile: %v", err)
+	}
+	if err := profile.ResolveFollowers(ctx); err != nil {
+		t.Fatalf("failed to fetch user followers: %v", err)
+	}
+	if len(profile.Followers) <= maxRelationshipsPerCall {
+		t.Skipf("not enough followers to test batching: have %d, want > %d", len(profile.Followers), maxRelationshipsPerCall)
+	}
+	dids := make([]string, len(profile.Followers))
+	for i, follower := range profile.Followers {
+		dids[i] = follower.DID
+	}
+	rels, err := client.Relationships(ctx, testDIDTester, dids...)
+	if err != nil {
+		t.Fatalf("failed to query relationships: %v", err)
+	}
+	if len(rels) != len(dids) {
+		t.Fatalf("relationship count mismatch: have %d, want %d", len(rels), len(dids))
+	}
+	for i, rel := range rels {
+		if rel.DID != dids[i] {
+			t.Errorf("relationship %d: target mismatch: have %v, want %v", i, rel.DID, dids[i])
+		}
+		if !rel.NotFound && rel.FollowedBy == "" {
+			t.Errorf("relationship %d: follower state mismatch: have empty, want non-empty", i)
+		}
+	}
+}
+
+// Tests that both mutual resolution strategies yield the same results.
+func TestMutuals(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+	)
+	profile, err := client.FetchProfile(ctx, testDIDTester)
+	if err != nil {
+		t.Fatalf("failed to fetch user profile: %v", err)
+	}
+	intersected, err := profile.intersectMutuals(ctx)
+	if err != nil {
+		t.Fatalf("failed to intersect mutuals: %v", err)
+	}
+	queried, err := profile.queryMutuals(ctx)
+	if err != nil {
+		t.Fatalf("failed to query mutuals: %v", err)
+	}
+	if len(intersected) != len(queried) {
+		t.Fatalf("mutual count mismatch: intersected %d, queried %d", len(intersected), len(queried))
+	}
+	dids := make(map[string]bool)
+	for _, user := range intersected {
+		dids[user.DID] = true
+	}
+	for _, user := range queried {
+		if !dids[user.DID] {
+			t.Errorf("queried mutual %v not found via intersection", user)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import "strings"
+
+// Document is a DID document, limited to the fields relevant to atproto.
+type Document struct {
+	ID                 string                `json:"id"`                 // DID the document describes
+	AlsoKnownAs        []string              `json:"alsoKnownAs"`        // Aliases of the DID, including at:// handles
+	VerificationMethod []*VerificationMethod `json:"verificationMethod"` // Public keys of the DID
+	Service            []*Service            `json:"service"`            // Service endpoints of the DID
+}
+
+// VerificationMethod is a public key declared in a DID document.
+type VerificationMethod struct {
+	ID                 string `json:"id"`                 // Identifier of the key (e.g. did:plc:xyz#atproto)
+	Type               string `json:"type"`               // Type of the key (e.g. Multikey)
+	Controller         string `json:"controller"`         // DID controlling the key
+	PublicKeyMultibase string `json:"publicKeyMultibase"` // Multibase encoding of the public key
+}
+
+// Service is a service endpoint declared in a DID document.
+type Service struct {
+	ID              string `json:"id"`              // Identifier of the service (e.g. #atproto_pds)
+	Type            string `json:"type"`            // Type of the service (e.g. AtprotoPersonalDataServer)
+	ServiceEndpoint string `json:"serviceEndpoint"` // URL of the service
+}
+
+// Handle returns the first atproto handle claimed by the document, or an empty
+// string if none. Note, the claim is not verified.
+func (d *Document) Handle() string {
+	for _, aka := range d.AlsoKnownAs {
+		if handle, ok := strings.CutPrefix(aka, "at://"); ok && handle != "" {
+			return strings.ToLower(handle)
+		}
+	}
+	return ""
+}
+
+// PDS returns the endpoint of the personal data server hosting the DID's repo,
+// or an empty string if none.
+func (d *Document) PDS() string {
+	return d.service("#atproto_pds", "AtprotoPersonalDataServer")
+}
+
+// SigningKey returns the multibase encoded public key the DID's repository is
+// signed with, or an empty string if none.
+func (d *Document) SigningKey() string {
+	for _, method := range d.VerificationMethod {
+		if method.ID == "#atproto" || method.ID == d.ID+"#atproto" {
+			return method.PublicKeyMultibase
+		}
+	}
+	return ""
+}
+
+// service returns the endpoint of a service by its identifier and type, or an
+// empty string if none.
+func (d *Document) service(id string, kind string) string {
+	for _, service := range d.Service {
+		if (service.ID == id || service.ID == d.ID+id) && service.Type == kind {
+			return service.ServiceEndpoint
+		}
+	}
+	return ""
+}
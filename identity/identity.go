@@ -0,0 +1,203 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package identity resolves atproto handles and DIDs directly from their sources
+// of truth (DNS, HTTPS, the PLC directory), without trusting any AppView.
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrHandleNotFound is returned if a handle cannot be resolved to a DID via
+	// neither DNS nor HTTPS.
+	ErrHandleNotFound = errors.New("handle not found")
+
+	// ErrDIDNotFound is returned if the document of a DID cannot be retrieved.
+	ErrDIDNotFound = errors.New("did not found")
+
+	// ErrUnsupportedDID is returned if a DID uses a method other than plc or web.
+	ErrUnsupportedDID = errors.New("unsupported did method")
+
+	// ErrHandleMismatch is returned if a handle resolves to a DID whose document
+	// does not claim the handle back.
+	ErrHandleMismatch = errors.New("handle not claimed by did")
+)
+
+// defaultPLCDirectory is the PLC directory to resolve did:plc identifiers via.
+const defaultPLCDirectory = "https://plc.directory"
+
+// defaultTTL is the time to cache resolved handles and documents for.
+const defaultTTL = time.Hour
+
+// maxCacheEntries is the maximum number of resolutions to cache of each kind, to
+// avoid unbounded growth when resolving identities supplied by untrusted parties
+// (e.g. the issuers of unverified tokens).
+const maxCacheEntries = 16384
+
+// Identity is a resolved and bi-directionally verified atproto identity.
+type Identity struct {
+	DID        string    // Permanent identifier of the account
+	Handle     string    // Verified handle of the account, empty if invalid
+	PDS        string    // Endpoint of the personal data server hosting the account
+	SigningKey string    // Multibase encoded public key the repository is signed with
+	Document   *Document // Full DID document of the account
+}
+
+// Config is the set of options to configure a resolver with.
+type Config struct {
+	PLCDirectory string                                                   // PLC directory URL (empty = https://plc.directory)
+	HTTPClient   *http.Client                                             // HTTP client for well-known and DID lookups (nil = default)
+	LookupTXT    func(ctx context.Context, name string) ([]string, error) // DNS TXT resolver (nil = system resolver)
+	TTL          time.Duration                                            // Time to cache the results for (0 = 1 hour, negative = disabled)
+}
+
+// Resolver resolves handles and DIDs, caching the results for a while.
+type Resolver struct {
+	config *Config // Options to resolve identities with
+
+	lock    sync.Mutex                    // Lock protecting the caches
+	handles map[string]*cached[string]    // Cache of handle to DID resolutions
+	docs    map[string]*cached[*Document] // Cache of DID to document resolutions
+}
+
+// cached is a resolution result along with its expiration time.
+type cached[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// New creates an identity resolver.
+func New(config Config) *Resolver {
+	if config.PLCDirectory == "" {
+		config.PLCDirectory = defaultPLCDirectory
+	}
+	config.PLCDirectory = strings.TrimSuffix(config.PLCDirectory, "/")
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.LookupTXT == nil {
+		config.LookupTXT = net.DefaultResolver.LookupTXT
+	}
+	if config.TTL == 0 {
+		config.TTL = defaultTTL
+	}
+	return &Resolver{
+		config:  &config,
+		handles: make(map[string]*cached[string]),
+		docs:    make(map[string]*cached[*Document]),
+	}
+}
+
+// Lookup resolves an identity by handle or DID, verifying that the handle and
+// DID mutually reference each other.
+//
+// If looked up by handle, the lookup fails with ErrHandleMismatch if the DID's
+// document does not claim the handle. If looked up by DID, the handle claimed
+// by its document is left empty if it does not resolve back to the DID.
+func (r *Resolver) Lookup(ctx context.Context, id string) (*Identity, error) {
+	id = strings.TrimPrefix(strings.TrimPrefix(id, "at://"), "@")
+
+	if strings.HasPrefix(id, "did:") {
+		doc, err := r.ResolveDID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		ident := newIdentity(doc)
+		if handle := doc.Handle(); handle != "" {
+			if did, err := r.ResolveHandle(ctx, handle); err == nil && did == doc.ID {
+				ident.Handle = handle
+			}
+		}
+		return ident, nil
+	}
+	handle := strings.ToLower(id)
+
+	did, err := r.ResolveHandle(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := r.ResolveDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Handle() != handle {
+		return nil, fmt.Errorf("%w: %s resolved to %s, claiming %q", ErrHandleMismatch, handle, did, doc.Handle())
+	}
+	ident := newIdentity(doc)
+	ident.Handle = handle
+	return ident, nil
+}
+
+// newIdentity assembles an identity from a DID document, with the handle left
+// empty until verified.
+func newIdentity(doc *Document) *Identity {
+	return &Identity{
+		DID:        doc.ID,
+		PDS:        doc.PDS(),
+		SigningKey: doc.SigningKey(),
+		Document:   doc,
+	}
+}
+
+// Purge removes a handle or DID from the resolver's caches, forcing the next
+// lookup to hit the network (e.g. after a handle change notification).
+func (r *Resolver) Purge(id string) {
+	id = strings.TrimPrefix(strings.TrimPrefix(id, "at://"), "@")
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.handles, strings.ToLower(id))
+	delete(r.docs, id)
+}
+
+// cacheGet retrieves a non-expired entry from a resolver cache.
+func cacheGet[T any](r *Resolver, cache map[string]*cached[T], key string) (T, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entry, ok := cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// cachePut inserts an entry into a resolver cache, unless caching is disabled.
+// If the cache is full, expired entries are dropped first, and if that does not
+// free up enough space, random live ones too.
+func cachePut[T any](r *Resolver, cache map[string]*cached[T], key string, value T) {
+	if r.config.TTL < 0 {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if _, ok := cache[key]; !ok && len(cache) >= maxCacheEntries {
+		for old, entry := range cache {
+			if now.After(entry.expires) {
+				delete(cache, old)
+			}
+		}
+		// Evict down to a low watermark so a full cache is not swept on every insert
+		for old := range cache {
+			if len(cache) < maxCacheEntries*3/4 {
+				break
+			}
+			delete(cache, old)
+		}
+	}
+	cache[key] = &cached[T]{value: value, expires: now.Add(r.config.TTL)}
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+// makeTestResolver creates a resolver against a fake internet, where every host
+// is served by the same local HTTPS server and DNS records come from a map.
+func makeTestResolver(t *testing.T, ttl time.Duration, docs map[string]*Document, wellKnown map[string]string, txt map[string][]string) (*Resolver, *atomic.Int32) {
+	t.Helper()
+
+	fetches := new(atomic.Int32)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		host, _, _ := strings.Cut(r.Host, ":")
+		switch {
+		case host == "plc.test":
+			if doc, ok := docs[strings.TrimPrefix(r.URL.Path, "/")]; ok {
+				json.NewEncoder(w).Encode(doc)
+				return
+			}
+		case r.URL.Path == "/.well-known/did.json":
+			if doc, ok := docs["did:web:"+host]; ok {
+				json.NewEncoder(w).Encode(doc)
+				return
+			}
+		case r.URL.Path == "/.well-known/atproto-did":
+			if did, ok := wellKnown[host]; ok {
+				w.Write([]byte(did + "\n"))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := srv.Client()
+	// Route every host to the test server, accepting its certificate for all
+	client.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return new(net.Dialer).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	resolver := New(Config{
+		PLCDirectory: "https://plc.test/",
+		HTTPClient:   client,
+		LookupTXT: func(ctx context.Context, name string) ([]string, error) {
+			fetches.Add(1)
+			if records, ok := txt[name]; ok {
+				return records, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		},
+		TTL: ttl,
+	})
+	return resolver, fetches
+}
+
+// makeTestDocument creates a DID document for an account hosted on a PDS.
+func makeTestDocument(did string, handle string) *Document {
+	return &Document{
+		ID:          did,
+		AlsoKnownAs: []string{"at://" + handle},
+		VerificationMethod: []*VerificationMethod{{
+			ID:                 did + "#atproto",
+			Type:               "Multikey",
+			Controller:         did,
+			PublicKeyMultibase: "zQ3shXjHeiBuRCKmM36cuYnm7YEMzhGnCmCyW92sRJ9pribSF",
+		}},
+		Service: []*Service{{
+			ID:              "#atproto_pds",
+			Type:            "AtprotoPersonalDataServer",
+			ServiceEndpoint: "https://pds.test",
+		}},
+	}
+}
+
+// Tests that identities are resolved and verified bi-directionally via both DNS
+// and HTTPS, across both supported DID methods.
+func TestLookup(t *testing.T) {
+	var (
+		docs = map[string]*Document{
+			"did:plc:alice":   makeTestDocument("did:plc:alice", "alice.test"),
+			"did:web:bob.dev": makeTestDocument("did:web:bob.dev", "bob.test"),
+			"did:plc:mallory": makeTestDocument("did:plc:mallory", "alice.test"),
+		}
+		wellKnown = map[string]string{"bob.test": "did:web:bob.dev"}
+		txt       = map[string][]string{
+			"_atproto.alice.test":   {"did=did:plc:alice"},
+			"_atproto.mallory.test": {"did=did:plc:mallory"},
+		}
+	)
+	resolver, _ := makeTestResolver(t, 0, docs, wellKnown, txt)
+
+	// Resolve via DNS and PLC, both by handle and by DID
+	for _, id := range []string{"@Alice.Test", "did:plc:alice", "at://alice.test"} {
+		ident, err := resolver.Lookup(context.Background(), id)
+		if err != nil {
+			t.Fatalf("%s: failed to look up: %v", id, err)
+		}
+		if ident.DID != "did:plc:alice" || ident.Handle != "alice.test" || ident.PDS != "https://pds.test" || ident.SigningKey == "" {
+			t.Errorf("%s: identity mismatch: have %+v", id, ident)
+		}
+	}
+	// Resolve via HTTPS and did:web
+	ident, err := resolver.Lookup(context.Background(), "bob.test")
+	if err != nil {
+		t.Fatalf("failed to look up via well-known: %v", err)
+	}
+	if ident.DID != "did:web:bob.dev" || ident.Handle != "bob.test" {
+		t.Errorf("identity mismatch: have %+v", ident)
+	}
+	// Ensure handles not claimed back are rejected or dropped
+	if _, err := resolver.Lookup(context.Background(), "mallory.test"); !errors.Is(err, ErrHandleMismatch) {
+		t.Errorf("unclaimed handle error mismatch: have %v, want %v", err, ErrHandleMismatch)
+	}
+	if ident, err := resolver.Lookup(context.Background(), "did:plc:mallory"); err != nil || ident.Handle != "" {
+		t.Errorf("impersonating did mismatch: have %+v/%v, want empty handle", ident, err)
+	}
+	// Ensure missing and unsupported identities are reported
+	if _, err := resolver.Lookup(context.Background(), "nobody.test"); !errors.Is(err, ErrHandleNotFound) {
+		t.Errorf("missing handle error mismatch: have %v, want %v", err, ErrHandleNotFound)
+	}
+	if _, err := resolver.Lookup(context.Background(), "did:plc:nobody"); !errors.Is(err, ErrDIDNotFound) {
+		t.Errorf("missing did error mismatch: have %v, want %v", err, ErrDIDNotFound)
+	}
+	if _, err := resolver.Lookup(context.Background(), "did:key:zQ3sh"); !errors.Is(err, ErrUnsupportedDID) {
+		t.Errorf("unsupported did error mismatch: have %v, want %v", err, ErrUnsupportedDID)
+	}
+}
+
+// Tests that resolutions are cached until purged, unless caching is disabled.
+func TestLookupCache(t *testing.T) {
+	var (
+		docs = map[string]*Document{"did:plc:alice": makeTestDocument("did:plc:alice", "alice.test")}
+		txt  = map[string][]string{"_atproto.alice.test": {"did=did:plc:alice"}}
+	)
+	resolver, fetches := makeTestResolver(t, 0, docs, nil, txt)
+	for i := 0; i < 3; i++ {
+		if _, err := resolver.Lookup(context.Background(), "alice.test"); err != nil {
+			t.Fatalf("failed to look up: %v", err)
+		}
+	}
+	if have := fetches.Load(); have != 2 {
+		t.Errorf("cached fetch count mismatch: have %d, want 2", have)
+	}
+	resolver.Purge("did:plc:alice")
+	if _, err := resolver.Lookup(context.Background(), "alice.test"); err != nil {
+		t.Fatalf("failed to look up: %v", err)
+	}
+	if have := fetches.Load(); have != 3 {
+		t.Errorf("purged fetch count mismatch: have %d, want 3", have)
+	}
+	resolver, fetches = makeTestResolver(t, -1, docs, nil, txt)
+	for i := 0; i < 3; i++ {
+		if _, err := resolver.Lookup(context.Background(), "alice.test"); err != nil {
+			t.Fatalf("failed to look up: %v", err)
+		}
+	}
+	if have := fetches.Load(); have != 6 {
+		t.Errorf("uncached fetch count mismatch: have %d, want 6", have)
+	}
+}
+
+// Tests that malformed handles and DIDs are rejected before any network access,
+// so they cannot redirect the resolver to arbitrary hosts, ports or paths.
+func TestLookupInvalidSyntax(t *testing.T) {
+	resolver, fetches := makeTestResolver(t, 0, nil, nil, nil)
+
+	for _, id := range []string{"127.0.0.1:8080", "evil.test/x?", "user@evil.test", "localhost", "did:plc:", "did:web:evil.test/x"} {
+		if _, err := resolver.Lookup(context.Background(), id); !errors.Is(err, syntax.ErrInvalidSyntax) {
+			t.Errorf("%s: error mismatch: have %v, want %v", id, err, syntax.ErrInvalidSyntax)
+		}
+	}
+	if _, err := resolver.ResolveHandle(context.Background(), "evil.test:443"); !errors.Is(err, syntax.ErrInvalidSyntax) {
+		t.Errorf("handle with port error mismatch: have %v, want %v", err, syntax.ErrInvalidSyntax)
+	}
+	if have := fetches.Load(); have != 0 {
+		t.Errorf("network access count mismatch: have %d, want 0", have)
+	}
+}
+
+// Tests that the resolver caches are bounded, dropping expired entries first and
+// live ones only if still full.
+func TestCacheBound(t *testing.T) {
+	resolver, _ := makeTestResolver(t, 0, nil, nil, nil)
+
+	// Fill the cache with expired entries and ensure they are swept on overflow
+	for i := 0; i < maxCacheEntries; i++ {
+		cachePut(resolver, resolver.handles, fmt.Sprintf("user%d.test", i), "did:plc:expired")
+		resolver.handles[fmt.Sprintf("user%d.test", i)].expires = time.Now().Add(-time.Second)
+	}
+	cachePut(resolver, resolver.handles, "alice.test", "did:plc:alice")
+	if have := len(resolver.handles); have != 1 {
+		t.Errorf("expired entries not swept: have %d entries, want 1", have)
+	}
+	// Fill the cache with live entries and ensure it does not grow past the cap
+	for i := 0; i < 2*maxCacheEntries; i++ {
+		cachePut(resolver, resolver.handles, fmt.Sprintf("user%d.test", i), "did:plc:live")
+		if have := len(resolver.handles); have > maxCacheEntries {
+			t.Fatalf("cache grew past its cap: have %d entries, want at most %d", have, maxCacheEntries)
+		}
+	}
+	if did, ok := cacheGet(resolver, resolver.handles, fmt.Sprintf("user%d.test", 2*maxCacheEntries-1)); !ok || did != "did:plc:live" {
+		t.Errorf("latest entry missing: have %q/%v", did, ok)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+// maxResponseSize is the maximum size of a well-known or DID document response,
+// to avoid malicious servers feeding infinite data.
+const maxResponseSize = 1024 * 1024
+
+// ResolveHandle resolves a handle to a DID, first via a DNS TXT record on the
+// _atproto subdomain, then via the HTTPS well-known endpoint of the domain.
+//
+// The handle is validated before any network access, so that it cannot smuggle
+// ports, paths or other hosts into the DNS and HTTPS queries.
+//
+// Note, the DID is not verified to claim the handle back, see Lookup for that.
+func (r *Resolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	parsed, err := syntax.ParseHandle(strings.TrimPrefix(handle, "@"))
+	if err != nil {
+		return "", err
+	}
+	handle = parsed.String()
+	if did, ok := cacheGet(r, r.handles, handle); ok {
+		return did, nil
+	}
+	did, dnsErr := r.resolveHandleDNS(ctx, handle)
+	if dnsErr != nil {
+		var httpErr error
+		if did, httpErr = r.resolveHandleHTTPS(ctx, handle); httpErr != nil {
+			return "", fmt.Errorf("%w: %s: dns: %v, https: %v", ErrHandleNotFound, handle, dnsErr, httpErr)
+		}
+	}
+	cachePut(r, r.handles, handle, did)
+	return did, nil
+}
+
+// resolveHandleDNS resolves a handle to a DID via a DNS TXT record.
+func (r *Resolver) resolveHandleDNS(ctx context.Context, handle string) (string, error) {
+	records, err := r.config.LookupTXT(ctx, "_atproto."+handle)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, record := range records {
+		if did, ok := strings.CutPrefix(record, "did="); ok {
+			if _, err := syntax.ParseDID(did); err == nil {
+				found = append(found, did)
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no did in TXT records")
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous TXT records: %v", found)
+	}
+}
+
+// resolveHandleHTTPS resolves a handle to a DID via the well-known endpoint.
+func (r *Resolver) resolveHandleHTTPS(ctx context.Context, handle string) (string, error) {
+	blob, err := r.fetch(ctx, "https://"+handle+"/.well-known/atproto-did")
+	if err != nil {
+		return "", err
+	}
+	did := strings.TrimSpace(string(blob))
+	if _, err := syntax.ParseDID(did); err != nil {
+		return "", err
+	}
+	return did, nil
+}
+
+// ResolveDID retrieves the document of a did:plc or did:web identifier. The DID
+// is validated before any network access.
+func (r *Resolver) ResolveDID(ctx context.Context, did string) (*Document, error) {
+	if _, err := syntax.ParseDID(did); err != nil {
+		return nil, err
+	}
+	if doc, ok := cacheGet(r, r.docs, did); ok {
+		return doc, nil
+	}
+	var endpoint string
+	switch {
+	case strings.HasPrefix(did, "did:plc:"):
+		endpoint = r.config.PLCDirectory + "/" + did
+
+	case strings.HasPrefix(did, "did:web:"):
+		// Per spec, ports are percent encoded and colons separate path components,
+		// which atproto does not support
+		rest := strings.TrimPrefix(did, "did:web:")
+		if strings.Contains(rest, ":") {
+			return nil, fmt.Errorf("%w: %s has path", ErrUnsupportedDID, did)
+		}
+		host, err := url.PathUnescape(rest)
+		if err != nil || host == "" || strings.ContainsAny(host, "/?#@") {
+			return nil, fmt.Errorf("%w: invalid did:web %s", ErrDIDNotFound, did)
+		}
+		endpoint = "https://" + host + "/.well-known/did.json"
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedDID, did)
+	}
+	blob, err := r.fetch(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrDIDNotFound, did, err)
+	}
+	doc := new(Document)
+	if err := json.Unmarshal(blob, doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: invalid document: %v", ErrDIDNotFound, did, err)
+	}
+	if doc.ID != did {
+		return nil, fmt.Errorf("%w: %s: document of %s", ErrDIDNotFound, did, doc.ID)
+	}
+	cachePut(r, r.docs, did, doc)
+	return doc, nil
+}
+
+// fetch retrieves a small document over HTTP, failing on any non-200 response.
+func (r *Resolver) fetch(ctx context.Context, endpoint string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+}
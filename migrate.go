@@ -0,0 +1,412 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// maxMissingBlobsPerCall is the maximum number of missing blobs the server will
+// return in a single listing query.
+const maxMissingBlobsPerCall = 1000
+
+var (
+	// ErrMigrationUnsupported is returned if an account is attempted to be migrated
+	// whose identity cannot be updated by the PDS (e.g. did:web).
+	ErrMigrationUnsupported = errors.New("migration unsupported")
+
+	// ErrPLCTokenRequired is returned from a migration when it reaches the identity
+	// update and no email confirmation token was configured. The old PDS will have
+	// emailed one to the user, with which the migration can be resumed.
+	ErrPLCTokenRequired = errors.New("plc token required")
+)
+
+// MigrationStep is a single resumable stage of an account migration.
+type MigrationStep string
+
+const (
+	MigrateCreateAccount MigrationStep = "create-account" // Create the account on the new PDS
+	MigrateImportRepo    MigrationStep = "import-repo"    // Export the repository from the old PDS and import into the new
+	MigrateBlobs         MigrationStep = "transfer-blobs" // Transfer all the blobs missing from the new PDS
+	MigratePreferences   MigrationStep = "preferences"    // Copy the private preferences over to the new PDS
+	MigrateIdentity      MigrationStep = "identity"       // Point the DID to the new PDS via a signed PLC operation
+	MigrateActivate      MigrationStep = "activate"       // Activate the new account and deactivate the old one
+)
+
+// migrationSteps is the order in which the migration steps are executed.
+var migrationSteps = []MigrationStep{
+	MigrateCreateAccount,
+	MigrateImportRepo,
+	MigrateBlobs,
+	MigratePreferences,
+	MigrateIdentity,
+	MigrateActivate,
+}
+
+// MigrationConfig is the set of options to migrate an account with.
+//
+// Note, contrary to the rest of the library, migrations require the accounts'
+// master passwords, as app passwords are not permitted to create accounts or
+// to sign identity operations. The passwords are only used for the sessions
+// internal to the migration, the clients are never logged in with them.
+type MigrationConfig struct {
+	Account     string // Handle or DID of the account on the old PDS
+	OldPassword string // Master password of the account on the old PDS
+
+	Handle     string // Handle of the account on the new PDS
+	Email      string // Email address of the account on the new PDS
+	Password   string // Master password of the account on the new PDS
+	InviteCode string // Invite code for the new PDS, if it requires one
+
+	PLCToken string // Emailed token to sign the identity update with, empty to request one
+	State    string // File to persist the migration progress into, empty to disable
+	DryRun   bool   // Whether to only run the read-only parts of the steps
+
+	OnStep func(step MigrationStep, dryRun bool) // Hook to report finished steps to, nil to ignore
+}
+
+// MigrationState is the progress of an account migration, persisted to allow
+// resuming an interrupted run.
+type MigrationState struct {
+	DID  string          `json:"did"`  // DID of the account being migrated
+	Done []MigrationStep `json:"done"` // Steps already finished
+}
+
+// Migration moves an account (repository, blobs, preferences and identity) from
+// one PDS to another.
+type Migration struct {
+	from   *Client          // Client connected to the old PDS
+	to     *Client          // Client connected to the new PDS
+	config *MigrationConfig // Options to run the migration with
+	state  *MigrationState  // Progress of the migration
+
+	fromAPI *xrpc.Client // Session authenticated to the old PDS
+	toAPI   *xrpc.Client // Session authenticated to the new PDS
+}
+
+// NewMigration creates a migration of an account from one PDS to another. The
+// clients need to be connected to the respective servers, but not logged in. If
+// a state file is configured and exists, the migration resumes from it.
+func NewMigration(from *Client, to *Client, config MigrationConfig) (*Migration, error) {
+	if config.Account == "" || config.OldPassword == "" {
+		return nil, errors.New("old account credentials required")
+	}
+	if config.Handle == "" || config.Password == "" {
+		return nil, errors.New("new account credentials required")
+	}
+	m := &Migration{
+		from:   from,
+		to:     to,
+		config: &config,
+		state:  new(MigrationState),
+	}
+	if config.State != "" {
+		blob, err := os.ReadFile(config.State)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(blob, m.state); err != nil {
+				return nil, fmt.Errorf("failed to parse migration state: %w", err)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Pending returns the steps of the migration not yet finished.
+func (m *Migration) Pending() []MigrationStep {
+	var pending []MigrationStep
+	for _, step := range migrationSteps {
+		if !slices.Contains(m.state.Done, step) {
+			pending = append(pending, step)
+		}
+	}
+	return pending
+}
+
+// Run executes all the pending steps of the migration in order, persisting the
+// progress after each one.
+//
+// The identity update requires a token emailed by the old PDS. If none is set,
+// the migration requests one and returns ErrPLCTokenRequired, after which it can
+// be rerun with the token configured.
+//
+// In dry-run mode, the accounts are authenticated and the read-only part of each
+// step is executed (e.g. exporting the repository, listing the preferences), but
+// nothing is written to either PDS and the progress is not persisted.
+func (m *Migration) Run(ctx context.Context) error {
+	// Authenticate to the old PDS, ensuring the account can be migrated
+	var err error
+	if m.fromAPI, err = privilegedSession(ctx, m.from, m.config.Account, m.config.OldPassword); err != nil {
+		return fmt.Errorf("failed to log in to old PDS: %w", err)
+	}
+	if m.state.DID == "" {
+		m.state.DID = m.fromAPI.Auth.Did
+	}
+	if m.state.DID != m.fromAPI.Auth.Did {
+		return fmt.Errorf("migration state of %s, logged in as %s", m.state.DID, m.fromAPI.Auth.Did)
+	}
+	if !strings.HasPrefix(m.state.DID, "did:plc:") {
+		return fmt.Errorf("%w: %s", ErrMigrationUnsupported, m.state.DID)
+	}
+	// If the account was already created, authenticate to the new PDS too
+	if slices.Contains(m.state.Done, MigrateCreateAccount) {
+		if m.toAPI, err = privilegedSession(ctx, m.to, m.state.DID, m.config.Password); err != nil {
+			return fmt.Errorf("failed to log in to new PDS: %w", err)
+		}
+	}
+	for _, step := range m.Pending() {
+		if err := m.step(ctx, step); err != nil {
+			return fmt.Errorf("migration step %s failed: %w", step, err)
+		}
+		if m.config.OnStep != nil {
+			m.config.OnStep(step, m.config.DryRun)
+		}
+		if m.config.DryRun {
+			continue
+		}
+		m.state.Done = append(m.state.Done, step)
+		if err := m.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// step executes a single step of the migration.
+func (m *Migration) step(ctx context.Context, step MigrationStep) error {
+	switch step {
+	case MigrateCreateAccount:
+		return m.createAccount(ctx)
+	case MigrateImportRepo:
+		return m.importRepo(ctx)
+	case MigrateBlobs:
+		return m.transferBlobs(ctx)
+	case MigratePreferences:
+		return m.migratePreferences(ctx)
+	case MigrateIdentity:
+		return m.updateIdentity(ctx)
+	case MigrateActivate:
+		return m.activate(ctx)
+	default:
+		return fmt.Errorf("unknown migration step: %s", step)
+	}
+}
+
+// createAccount creates a deactivated account on the new PDS for the migrated
+// DID, authorized by a service token from the old PDS.
+//
+// If a previous run crashed after creating the account but before recording it,
+// the creation fails and the existing account is logged into instead.
+func (m *Migration) createAccount(ctx context.Context) error {
+	desc, err := atproto.ServerDescribeServer(ctx, m.to.client)
+	if err != nil {
+		return err
+	}
+	if desc.InviteCodeRequired != nil && *desc.InviteCodeRequired && m.config.InviteCode == "" {
+		return errors.New("new PDS requires an invite code")
+	}
+	auth, err := atproto.ServerGetServiceAuth(ctx, m.fromAPI, desc.Did, time.Now().Add(time.Hour).Unix(), "com.atproto.server.createAccount")
+	if err != nil {
+		return err
+	}
+	if m.config.DryRun {
+		return nil
+	}
+	input := &atproto.ServerCreateAccount_Input{
+		Did:      &m.state.DID,
+		Handle:   m.config.Handle,
+		Password: &m.config.Password,
+	}
+	if m.config.Email != "" {
+		input.Email = &m.config.Email
+	}
+	if m.config.InviteCode != "" {
+		input.InviteCode = &m.config.InviteCode
+	}
+	api := &xrpc.Client{
+		Client: m.to.client.Client,
+		Host:   m.to.client.Host,
+		Auth:   &xrpc.AuthInfo{AccessJwt: auth.Token},
+	}
+	res, err := atproto.ServerCreateAccount(ctx, api, input)
+	if err != nil {
+		if existing, loginErr := privilegedSession(ctx, m.to, m.state.DID, m.config.Password); loginErr == nil {
+			m.toAPI = existing
+			return nil
+		}
+		return err
+	}
+	api.Auth = &xrpc.AuthInfo{
+		AccessJwt:  res.AccessJwt,
+		RefreshJwt: res.RefreshJwt,
+		Handle:     res.Handle,
+		Did:        res.Did,
+	}
+	m.toAPI = api
+	return nil
+}
+
+// importRepo streams the repository export from the old PDS into the new one.
+func (m *Migration) importRepo(ctx context.Context) error {
+	if m.config.DryRun {
+		return m.from.exportRepo(ctx, m.state.DID, "", io.Discard)
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(m.from.exportRepo(ctx, m.state.DID, "", writer))
+	}()
+	defer reader.Close()
+
+	return m.toAPI.Do(ctx, xrpc.Procedure, "application/vnd.ipld.car", "com.atproto.repo.importRepo", nil, reader, nil)
+}
+
+// transferBlobs copies all the blobs the new PDS is missing from the old one.
+// The step is naturally resumable, as already transferred blobs are not listed.
+func (m *Migration) transferBlobs(ctx context.Context) error {
+	if m.config.DryRun {
+		for _, err := range iterate(ctx, m.from.fetchBlobs(m.state.DID, ""), nil) {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	uploaded := make(map[string]struct{})
+	for {
+		// Retrieve the next batch of missing blobs, they will drop off the list as
+		// they are uploaded, so always start from the beginning
+		var res atproto.RepoListMissingBlobs_Output
+		params := map[string]interface{}{"limit": maxMissingBlobsPerCall}
+		if err := m.toAPI.Do(ctx, xrpc.Query, "", "com.atproto.repo.listMissingBlobs", params, nil, &res); err != nil {
+			return err
+		}
+		if len(res.Blobs) == 0 {
+			return nil
+		}
+		for _, blob := range res.Blobs {
+			if _, ok := uploaded[blob.Cid]; ok {
+				return fmt.Errorf("blob %s still missing after upload", blob.Cid)
+			}
+			uploaded[blob.Cid] = struct{}{}
+
+			var buf bytes.Buffer
+			if err := m.from.exportBlob(ctx, m.state.DID, blob.Cid, &buf); err != nil {
+				return err
+			}
+			if err := m.toAPI.Do(ctx, xrpc.Procedure, http.DetectContentType(buf.Bytes()), "com.atproto.repo.uploadBlob", nil, &buf, nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// migratePreferences copies the private preferences of the account over to the
+// new PDS. They are passed through undecoded, to retain any the library does
+// not know about.
+func (m *Migration) migratePreferences(ctx context.Context) error {
+	var prefs struct {
+		Preferences json.RawMessage `json:"preferences"`
+	}
+	if err := m.fromAPI.Do(ctx, xrpc.Query, "", "app.bsky.actor.getPreferences", nil, nil, &prefs); err != nil {
+		return err
+	}
+	if m.config.DryRun {
+		return nil
+	}
+	return m.toAPI.Do(ctx, xrpc.Procedure, "application/json", "app.bsky.actor.putPreferences", nil, &prefs, nil)
+}
+
+// updateIdentity points the account's DID to the new PDS, by having the old PDS
+// sign a PLC operation with the credentials recommended by the new PDS.
+func (m *Migration) updateIdentity(ctx context.Context) error {
+	if m.config.DryRun {
+		return nil
+	}
+	// Without a token, request one to be emailed and bail out
+	if m.config.PLCToken == "" {
+		if err := m.fromAPI.Do(ctx, xrpc.Procedure, "", "com.atproto.identity.requestPlcOperationSignature", nil, nil, nil); err != nil {
+			return err
+		}
+		return ErrPLCTokenRequired
+	}
+	// Sign the recommended credentials on the old PDS and submit via the new one.
+	// All the payloads are passed through undecoded, the generated bindings only
+	// accept typed lexicon objects.
+	var creds map[string]json.RawMessage
+	if err := m.toAPI.Do(ctx, xrpc.Query, "", "com.atproto.identity.getRecommendedDidCredentials", nil, nil, &creds); err != nil {
+		return err
+	}
+	creds["token"], _ = json.Marshal(m.config.PLCToken)
+
+	var signed struct {
+		Operation json.RawMessage `json:"operation"`
+	}
+	if err := m.fromAPI.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.identity.signPlcOperation", nil, creds, &signed); err != nil {
+		return err
+	}
+	return m.toAPI.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.identity.submitPlcOperation", nil, &signed, nil)
+}
+
+// activate enables the account on the new PDS and disables it on the old one.
+func (m *Migration) activate(ctx context.Context) error {
+	if m.config.DryRun {
+		return nil
+	}
+	if err := m.toAPI.Do(ctx, xrpc.Procedure, "", "com.atproto.server.activateAccount", nil, nil, nil); err != nil {
+		return err
+	}
+	return m.fromAPI.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.server.deactivateAccount", nil, map[string]any{}, nil)
+}
+
+// save persists the migration progress into the configured state file, if any.
+func (m *Migration) save() error {
+	if m.config.State == "" {
+		return nil
+	}
+	blob, err := json.MarshalIndent(m.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.config.State, blob)
+}
+
+// privilegedSession authenticates to a PDS with master credentials, returning
+// an API client separate from the library client, so the session does not leak
+// into any other operation.
+func privilegedSession(ctx context.Context, c *Client, account string, password string) (*xrpc.Client, error) {
+	api := &xrpc.Client{
+		Client: c.client.Client,
+		Host:   c.client.Host,
+	}
+	sess, err := atproto.ServerCreateSession(ctx, api, &atproto.ServerCreateSession_Input{
+		Identifier: account,
+		Password:   password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	api.Auth = &xrpc.AuthInfo{
+		AccessJwt:  sess.AccessJwt,
+		RefreshJwt: sess.RefreshJwt,
+		Handle:     sess.Handle,
+		Did:        sess.Did,
+	}
+	return api, nil
+}
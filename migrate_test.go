@@ -0,0 +1,242 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// testMigrationServer is a minimal fake of the account APIs of a PDS, used to
+// test the migration flow offline.
+type testMigrationServer struct {
+	lock    sync.Mutex
+	created bool              // Whether the account exists on the server
+	calls   []string          // Methods called on the server, in order
+	blobs   map[string]string // Blobs stored on the server, indexed by hash
+	missing []string          // Blobs referenced from the repo but not stored
+	prefs   json.RawMessage   // Private preferences of the account
+	repo    string            // Content of the account repository
+}
+
+func (s *testMigrationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	method := strings.TrimPrefix(r.URL.Path, "/xrpc/")
+	s.calls = append(s.calls, method)
+
+	var res any = map[string]any{}
+	switch method {
+	case "com.atproto.server.createSession":
+		if !s.created {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "AuthenticationRequired"})
+			return
+		}
+		res = map[string]string{"did": "did:plc:tester", "handle": "tester", "accessJwt": "access", "refreshJwt": "refresh"}
+	case "com.atproto.server.createAccount":
+		if s.created {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "InvalidRequest", "message": "Account already exists"})
+			return
+		}
+		s.created = true
+		res = map[string]string{"did": "did:plc:tester", "handle": "tester", "accessJwt": "access", "refreshJwt": "refresh"}
+	case "com.atproto.server.describeServer":
+		res = map[string]any{"did": "did:web:new.pds", "availableUserDomains": []string{}}
+	case "com.atproto.server.getServiceAuth":
+		res = map[string]string{"token": "service"}
+	case "com.atproto.sync.getRepo":
+		w.Write([]byte(s.repo))
+		return
+	case "com.atproto.repo.importRepo":
+		blob, _ := io.ReadAll(r.Body)
+		s.repo = string(blob)
+	case "com.atproto.sync.listBlobs":
+		var cids []string
+		for cid := range s.blobs {
+			cids = append(cids, cid)
+		}
+		res = map[string]any{"cids": cids}
+	case "com.atproto.sync.getBlob":
+		w.Write([]byte(s.blobs[r.URL.Query().Get("cid")]))
+		return
+	case "com.atproto.repo.listMissingBlobs":
+		var blobs []any
+		for _, cid := range s.missing {
+			blobs = append(blobs, map[string]string{"cid": cid, "recordUri": "at://did:plc:tester/app.bsky.feed.post/abc"})
+		}
+		res = map[string]any{"blobs": blobs}
+	case "com.atproto.repo.uploadBlob":
+		blob, _ := io.ReadAll(r.Body)
+		for i, cid := range s.missing {
+			if cid == "cid-"+string(blob) {
+				s.missing = slices.Delete(s.missing, i, i+1)
+				break
+			}
+		}
+	case "app.bsky.actor.getPreferences":
+		res = map[string]any{"preferences": s.prefs}
+	case "app.bsky.actor.putPreferences":
+		var input struct {
+			Preferences json.RawMessage `json:"preferences"`
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		s.prefs = input.Preferences
+	case "com.atproto.identity.getRecommendedDidCredentials":
+		res = map[string]any{"rotationKeys": []string{"did:key:new"}}
+	case "com.atproto.identity.signPlcOperation":
+		var input map[string]any
+		json.NewDecoder(r.Body).Decode(&input)
+		if input["token"] != "emailed" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "InvalidToken"})
+			return
+		}
+		res = map[string]any{"operation": map[string]any{"type": "plc_operation"}}
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// Tests that an account migration runs all the steps in order, stopping for the
+// emailed token, and that a dry-run does not write anything.
+func TestMigration(t *testing.T) {
+	var (
+		oldPDS = &testMigrationServer{
+			created: true,
+			repo:    "car",
+			blobs:   map[string]string{"cid-one": "one", "cid-two": "two"},
+			prefs:   json.RawMessage(`[{"$type":"app.bsky.actor.defs#unknownPref","value":1}]`),
+		}
+		newPDS = &testMigrationServer{
+			missing: []string{"cid-one", "cid-two"},
+		}
+		oldSrv = httptest.NewServer(oldPDS)
+		newSrv = httptest.NewServer(newPDS)
+	)
+	defer oldSrv.Close()
+	defer newSrv.Close()
+
+	var (
+		from   = &Client{client: &xrpc.Client{Client: new(http.Client), Host: oldSrv.URL}}
+		to     = &Client{client: &xrpc.Client{Client: new(http.Client), Host: newSrv.URL}}
+		config = MigrationConfig{
+			Account:     "tester.old.pds",
+			OldPassword: "old-secret",
+			Handle:      "tester.new.pds",
+			Password:    "new-secret",
+			State:       filepath.Join(t.TempDir(), "migration.json"),
+		}
+	)
+	// Run a dry-run migration and ensure nothing is written
+	dry := config
+	dry.DryRun = true
+
+	var steps []MigrationStep
+	dry.OnStep = func(step MigrationStep, dryRun bool) { steps = append(steps, step) }
+
+	migration, err := NewMigration(from, to, dry)
+	if err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+	if err := migration.Run(context.Background()); err != nil {
+		t.Fatalf("failed to dry-run migration: %v", err)
+	}
+	if !slices.Equal(steps, migrationSteps) {
+		t.Errorf("dry-run steps mismatch: have %v, want %v", steps, migrationSteps)
+	}
+	if newPDS.repo != "" || len(newPDS.missing) != 2 || slices.Contains(oldPDS.calls, "com.atproto.server.deactivateAccount") {
+		t.Fatalf("dry-run modified state: new calls %v", newPDS.calls)
+	}
+	if len(migration.Pending()) != len(migrationSteps) {
+		t.Errorf("dry-run progressed: pending %v", migration.Pending())
+	}
+	// Run the migration for real, stopping for the emailed token
+	if migration, err = NewMigration(from, to, config); err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+	if err := migration.Run(context.Background()); !errors.Is(err, ErrPLCTokenRequired) {
+		t.Fatalf("tokenless run error mismatch: have %v, want %v", err, ErrPLCTokenRequired)
+	}
+	if pending := migration.Pending(); !slices.Equal(pending, []MigrationStep{MigrateIdentity, MigrateActivate}) {
+		t.Fatalf("pending steps mismatch: have %v", pending)
+	}
+	if newPDS.repo != "car" || len(newPDS.missing) != 0 || string(newPDS.prefs) != string(oldPDS.prefs) {
+		t.Errorf("migrated data mismatch: repo %q, missing %v, prefs %s", newPDS.repo, newPDS.missing, newPDS.prefs)
+	}
+	// Resume the migration from disk with the token and ensure it finishes
+	config.PLCToken = "emailed"
+	if migration, err = NewMigration(from, to, config); err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+	imports := strings.Count(strings.Join(newPDS.calls, " "), "importRepo")
+	if err := migration.Run(context.Background()); err != nil {
+		t.Fatalf("failed to resume migration: %v", err)
+	}
+	if len(migration.Pending()) != 0 {
+		t.Errorf("migration not finished: pending %v", migration.Pending())
+	}
+	if have := strings.Count(strings.Join(newPDS.calls, " "), "importRepo"); have != imports {
+		t.Errorf("finished steps rerun: imports %d, want %d", have, imports)
+	}
+	for _, call := range []string{"com.atproto.identity.submitPlcOperation", "com.atproto.server.activateAccount"} {
+		if !slices.Contains(newPDS.calls, call) {
+			t.Errorf("new PDS missing call %s", call)
+		}
+	}
+	if !slices.Contains(oldPDS.calls, "com.atproto.server.deactivateAccount") {
+		t.Errorf("old account not deactivated")
+	}
+}
+
+// Tests that a migration interrupted after creating the new account, but before
+// recording it, logs into the existing account when resumed.
+func TestMigrationResumeCreated(t *testing.T) {
+	var (
+		oldPDS = &testMigrationServer{created: true, repo: "car"}
+		newPDS = &testMigrationServer{created: true}
+		oldSrv = httptest.NewServer(oldPDS)
+		newSrv = httptest.NewServer(newPDS)
+	)
+	defer oldSrv.Close()
+	defer newSrv.Close()
+
+	var (
+		from   = &Client{client: &xrpc.Client{Client: new(http.Client), Host: oldSrv.URL}}
+		to     = &Client{client: &xrpc.Client{Client: new(http.Client), Host: newSrv.URL}}
+		config = MigrationConfig{
+			Account:     "tester.old.pds",
+			OldPassword: "old-secret",
+			Handle:      "tester.new.pds",
+			Password:    "new-secret",
+			State:       filepath.Join(t.TempDir(), "migration.json"),
+		}
+	)
+	migration, err := NewMigration(from, to, config)
+	if err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+	if err := migration.Run(context.Background()); !errors.Is(err, ErrPLCTokenRequired) {
+		t.Fatalf("resumed run error mismatch: have %v, want %v", err, ErrPLCTokenRequired)
+	}
+	if pending := migration.Pending(); !slices.Equal(pending, []MigrationStep{MigrateIdentity, MigrateActivate}) {
+		t.Fatalf("pending steps mismatch: have %v", pending)
+	}
+	if !slices.Contains(newPDS.calls, "com.atproto.server.createSession") || newPDS.repo != "car" {
+		t.Errorf("existing account not reused: calls %v", newPDS.calls)
+	}
+}
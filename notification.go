@@ -0,0 +1,164 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// NotificationReason defines the interaction a notification was raised for.
+type NotificationReason string
+
+const (
+	NotificationLike    NotificationReason = "like"    // Someone liked a post of the user
+	NotificationRepost  NotificationReason = "repost"  // Someone reposted a post of the user
+	NotificationFollow  NotificationReason = "follow"  // Someone followed the user
+	NotificationMention NotificationReason = "mention" // Someone mentioned the user in a post
+	NotificationReply   NotificationReason = "reply"   // Someone replied to a post of the user
+	NotificationQuote   NotificationReason = "quote"   // Someone quoted a post of the user
+)
+
+// Notification is an event in the logged in user's notification feed.
+type Notification struct {
+	client *Client // Embedded API client to resolve the subject with
+
+	URI    string             // AT-URI of the record that raised the notification (e.g. like, follow, post)
+	CID    string             // Content hash of the record that raised the notification
+	Reason NotificationReason // Interaction the notification was raised for
+
+	Author  *User  // User whose action raised the notification
+	Subject string // AT-URI of the user's record that was interacted with, empty if none
+	Post    *Post  // Post that raised the notification for replies, mentions and quotes, nil otherwise
+
+	Read      bool      // Whether the notification was already seen
+	IndexedAt time.Time // Time when the notification was indexed by the server
+	Labels    []*Label  // Moderation labels attached to the notification record
+}
+
+// StreamNotifications gradually resolves the notifications of the logged in user,
+// newest first, feeding the results into a channel. If reasons are given, only
+// notifications raised for them are delivered.
+func (c *Client) StreamNotifications(ctx context.Context, reasons []NotificationReason, opts ...PageOption) (<-chan *Notification, <-chan error) {
+	stream := newStream(ctx, c.notificationFetcher(reasons), opts)
+	return stream.Items(), stream.Err()
+}
+
+// IterNotifications returns an iterator over the notifications of the logged in
+// user, newest first, retrieving them page by page as the iteration progresses.
+// If reasons are given, only notifications raised for them are delivered.
+func (c *Client) IterNotifications(ctx context.Context, reasons []NotificationReason, opts ...PageOption) iter.Seq2[*Notification, error] {
+	return iterate(ctx, c.notificationFetcher(reasons), opts)
+}
+
+// notificationFetcher creates a page fetcher for notifications filtered to the
+// given reasons.
+func (c *Client) notificationFetcher(reasons []NotificationReason) pageFetcher[*Notification] {
+	filter := make([]string, len(reasons))
+	for i, reason := range reasons {
+		filter[i] = string(reason)
+	}
+	return func(ctx context.Context, cursor string, limit int) ([]*Notification, string, error) {
+		// Assemble only the parameters actually set, the server rejects empty ones
+		params := map[string]interface{}{
+			"limit": min(limit, 100),
+		}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		if len(filter) > 0 {
+			params["reasons"] = filter
+		}
+		var res bsky.NotificationListNotifications_Output
+		if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.notification.listNotifications", params, nil, &res); err != nil {
+			return nil, "", err
+		}
+		// Parse the notifications and drop pointless pointers
+		notifs := make([]*Notification, 0, len(res.Notifications))
+		for _, notif := range res.Notifications {
+			notifs = append(notifs, newNotification(c, notif))
+		}
+		if res.Cursor == nil {
+			return notifs, "", nil
+		}
+		return notifs, *res.Cursor, nil
+	}
+}
+
+// newNotification converts an API notification into the library's notification
+// type, hydrating the post record for post based interactions.
+func newNotification(client *Client, view *bsky.NotificationListNotifications_Notification) *Notification {
+	notif := &Notification{
+		client:    client,
+		URI:       view.Uri,
+		CID:       view.Cid,
+		Reason:    NotificationReason(view.Reason),
+		Author:    newUserFromView(client, view.Author),
+		Read:      view.IsRead,
+		IndexedAt: parseTime(&view.IndexedAt),
+		Labels:    parseLabels(view.Labels),
+	}
+	if view.ReasonSubject != nil {
+		notif.Subject = *view.ReasonSubject
+	}
+	// If the notification was raised by a post, hydrate it so it can be acted
+	// upon (e.g. replied to) without a second lookup
+	switch notif.Reason {
+	case NotificationReply, NotificationMention, NotificationQuote:
+		if view.Record == nil {
+			break
+		}
+		if record, ok := view.Record.Val.(*bsky.FeedPost); ok {
+			notif.Post = &Post{
+				client:    client,
+				URI:       view.Uri,
+				CID:       view.Cid,
+				Author:    notif.Author,
+				IndexedAt: notif.IndexedAt,
+				Labels:    notif.Labels,
+			}
+			notif.Post.fillRecord(record)
+		}
+	}
+	return notif
+}
+
+// FetchSubject retrieves the post that was interacted with (e.g. liked, reposted).
+// If the notification has no subject (e.g. follows) or it's not a post, nil is
+// returned.
+func (n *Notification) FetchSubject(ctx context.Context) (*Post, error) {
+	if n.Subject == "" {
+		return nil, nil
+	}
+	if _, collection, _, err := parseATURI(n.Subject); err != nil || collection != "app.bsky.feed.post" {
+		return nil, err
+	}
+	return n.client.FetchPost(ctx, n.Subject)
+}
+
+// UnreadNotificationCount retrieves the number of unseen notifications of the
+// logged in user. It is a cheap call to check whether there is anything new.
+func (c *Client) UnreadNotificationCount(ctx context.Context) (int, error) {
+	var res bsky.NotificationGetUnreadCount_Output
+	if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.notification.getUnreadCount", nil, nil, &res); err != nil {
+		return 0, err
+	}
+	return int(res.Count), nil
+}
+
+// MarkNotificationsSeen marks all notifications up to a given time as seen. If
+// the time is zero, all notifications up to now are marked.
+func (c *Client) MarkNotificationsSeen(ctx context.Context, at time.Time) error {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return bsky.NotificationUpdateSeen(ctx, c.client, &bsky.NotificationUpdateSeen_Input{
+		SeenAt: at.UTC().Format(time.RFC3339Nano),
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// Tests that notifications raised by posts get the post hydrated, whereas other
+// interactions only link to their subject.
+func TestNotificationHydration(t *testing.T) {
+	const notifs = `[
+		{"uri": "at://did:plc:bob/app.bsky.feed.post/1", "cid": "c1", "reason": "reply", "isRead": false,
+		 "indexedAt": "2023-05-01T10:01:00Z", "author": {"did": "did:plc:bob", "handle": "bob.test"},
+		 "record": {"$type": "app.bsky.feed.post", "text": "hello", "createdAt": "2023-05-01T10:00:00Z",
+			"reply": {"root": {"uri": "at://did:plc:alice/app.bsky.feed.post/0", "cid": "c0"},
+			          "parent": {"uri": "at://did:plc:alice/app.bsky.feed.post/0", "cid": "c0"}}}},
+		{"uri": "at://did:plc:bob/app.bsky.feed.like/2", "cid": "c2", "reason": "like", "isRead": true,
+		 "reasonSubject": "at://did:plc:alice/app.bsky.feed.post/0",
+		 "indexedAt": "2023-05-01T10:02:00Z", "author": {"did": "did:plc:bob", "handle": "bob.test"},
+		 "record": {"$type": "app.bsky.feed.like", "createdAt": "2023-05-01T10:02:00Z",
+			"subject": {"uri": "at://did:plc:alice/app.bsky.feed.post/0", "cid": "c0"}}}
+	]`
+	var views []*bsky.NotificationListNotifications_Notification
+	if err := json.Unmarshal([]byte(notifs), &views); err != nil {
+		t.Fatalf("failed to parse test notifications: %v", err)
+	}
+	reply := newNotification(nil, views[0])
+	if reply.Reason != NotificationReply || reply.Read || reply.Author.Handle != "bob.test" {
+		t.Errorf("reply metadata mismatch: have %+v", reply)
+	}
+	if reply.Post == nil {
+		t.Fatalf("reply post not hydrated")
+	}
+	if reply.Post.Text != "hello" || reply.Post.URI != views[0].Uri || reply.Post.CID != "c1" {
+		t.Errorf("reply post mismatch: have %+v", reply.Post)
+	}
+	if reply.Post.ReplyParent == nil || reply.Post.ReplyParent.URI != "at://did:plc:alice/app.bsky.feed.post/0" {
+		t.Errorf("reply parent mismatch: have %v", reply.Post.ReplyParent)
+	}
+	like := newNotification(nil, views[1])
+	if like.Reason != NotificationLike || !like.Read || like.Post != nil {
+		t.Errorf("like metadata mismatch: have %+v", like)
+	}
+	if like.Subject != "at://did:plc:alice/app.bsky.feed.post/0" {
+		t.Errorf("like subject mismatch: have %s", like.Subject)
+	}
+}
+
+// Tests that notifications can be listed and counted.
+func TestNotifications(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+	)
+	if _, err := client.UnreadNotificationCount(ctx); err != nil {
+		t.Fatalf("failed to retrieve unread count: %v", err)
+	}
+	reasons := []NotificationReason{NotificationLike, NotificationFollow}
+	for notif, err := range client.IterNotifications(ctx, reasons, WithMaxItems(50)) {
+		if err != nil {
+			t.Fatalf("failed to iterate notifications: %v", err)
+		}
+		if notif.Reason != NotificationLike && notif.Reason != NotificationFollow {
+			t.Errorf("notification reason not filtered: %s", notif.Reason)
+		}
+	}
+	if err := client.MarkNotificationsSeen(ctx, time.Time{}); err != nil {
+		t.Fatalf("failed to mark notifications seen: %v", err)
+	}
+	count, err := client.UnreadNotificationCount(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve unread count: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("unread count mismatch: have %d, want 0", count)
+	}
+}
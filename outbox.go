@@ -0,0 +1,154 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxStatus defines the publishing state of a queued post.
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"   // Post is waiting to be published
+	OutboxPublished OutboxStatus = "published" // Post was successfully published
+	OutboxFailed    OutboxStatus = "failed"    // Post was permanently rejected or ran out of retries
+)
+
+// OutboxItem is a post queued for publishing by the scheduler.
+type OutboxItem struct {
+	ID        string       `json:"id"`        // Unique identifier of the queued post
+	Draft     *PostDraft   `json:"draft"`     // Content of the post to publish
+	PublishAt time.Time    `json:"publishAt"` // Time when the post should be published
+	Status    OutboxStatus `json:"status"`    // Publishing state of the post
+
+	RecordKey   string    `json:"rkey,omitempty"`        // Record key reserved for the post on the first attempt
+	Attempts    int       `json:"attempts"`              // Number of publishing attempts made
+	NextAttempt time.Time `json:"nextAttempt,omitempty"` // Time of the next retry after a transient failure
+	LastError   string    `json:"lastError,omitempty"`   // Failure of the last publishing attempt
+
+	Published   *RecordRef `json:"published,omitempty"`   // Reference to the published post record
+	PublishedAt time.Time  `json:"publishedAt,omitempty"` // Time when the post was actually published
+}
+
+// OutboxStore is a durable storage for the posts queued by the scheduler. The
+// scheduler serializes all calls, implementations need not be thread safe.
+type OutboxStore interface {
+	// Load retrieves all the items in the store, in any order.
+	Load() ([]*OutboxItem, error)
+
+	// Save inserts a new item or replaces an existing one with the same ID. When
+	// the method returns, the item must be durably persisted.
+	Save(item *OutboxItem) error
+
+	// Delete removes an item from the store. Deleting a missing item is a noop.
+	Delete(id string) error
+}
+
+// FileOutbox is an outbox store persisting all the items into a single JSON file.
+// The entire file is rewritten (atomically) on every change, so it is meant for
+// modest queues, not bulk posting.
+type FileOutbox struct {
+	path  string                 // File to persist the items into
+	lock  sync.Mutex             // Lock protecting the items
+	items map[string]*OutboxItem // Items currently in the store, nil until loaded
+}
+
+// NewFileOutbox creates an outbox store backed by a JSON file. The file is
+// created on the first save if it does not exist.
+func NewFileOutbox(path string) *FileOutbox {
+	return &FileOutbox{path: path}
+}
+
+// Load implements OutboxStore, retrieving all the items in the store.
+func (f *FileOutbox) Load() ([]*OutboxItem, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	items := make([]*OutboxItem, 0, len(f.items))
+	for _, item := range f.items {
+		dup := *item
+		items = append(items, &dup)
+	}
+	return items, nil
+}
+
+// Save implements OutboxStore, inserting or replacing an item.
+func (f *FileOutbox) Save(item *OutboxItem) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+	dup := *item
+	f.items[item.ID] = &dup
+	return f.flush()
+}
+
+// Delete implements OutboxStore, removing an item.
+func (f *FileOutbox) Delete(id string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+	if _, ok := f.items[id]; !ok {
+		return nil
+	}
+	delete(f.items, id)
+	return f.flush()
+}
+
+// load reads the items from disk if not yet done.
+func (f *FileOutbox) load() error {
+	if f.items != nil {
+		return nil
+	}
+	items := make(map[string]*OutboxItem)
+
+	blob, err := os.ReadFile(f.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// No outbox yet, start with an empty one
+	case err != nil:
+		return err
+	default:
+		var list []*OutboxItem
+		if err := json.Unmarshal(blob, &list); err != nil {
+			return err
+		}
+		for _, item := range list {
+			items[item.ID] = item
+		}
+	}
+	f.items = items
+	return nil
+}
+
+// flush writes the items to disk, sorted by ID for stable output.
+func (f *FileOutbox) flush() error {
+	list := make([]*OutboxItem, 0, len(f.items))
+	for _, item := range f.items {
+		list = append(list, item)
+	}
+	slices.SortFunc(list, func(a, b *OutboxItem) int { return strings.Compare(a.ID, b.ID) })
+
+	blob, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, blob)
+}
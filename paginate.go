@@ -0,0 +1,267 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"iter"
+	"slices"
+)
+
+// defaultPageSize is the number of items to request per API call if the user
+// did not explicitly configure it. Endpoints with lower limits will clamp it.
+const defaultPageSize = 100
+
+// pageFetcher retrieves a single page of a paginated list from the server,
+// returning the items in it and the cursor to retrieve the next page with. An
+// empty next cursor signals that there are no more pages.
+//
+// The limit is the maximum number of items the caller wants, the fetcher may
+// clamp it further to the maximum accepted by the endpoint.
+type pageFetcher[T any] func(ctx context.Context, cursor string, limit int) (items []T, next string, err error)
+
+// failedFetcher creates a page fetcher which fails right away, used to report
+// invalid arguments through the error path of the iterators and streams.
+func failedFetcher[T any](err error) pageFetcher[T] {
+	return func(ctx context.Context, cursor string, limit int) ([]T, string, error) {
+		return nil, "", err
+	}
+}
+
+// page is a single batch of items retrieved from a paginated list, along with
+// the cursor that retrieves the batch after it.
+type page[T any] struct {
+	items []T
+	next  string
+}
+
+// PageInfo contains progress information about a paginated list crawl, passed
+// to the page hook after each fully delivered page.
+type PageInfo struct {
+	Index     int    // Sequence number of the page within this crawl (0 based)
+	Items     int    // Number of items delivered from this page
+	Delivered int    // Total number of items delivered so far
+	Cursor    string // Cursor to resume the crawl after this page (empty if exhausted)
+}
+
+// pageConfig is the set of options to crawl a paginated list with.
+type pageConfig struct {
+	cursor   string          // Cursor to start the crawl from
+	pageSize int             // Number of items to request per API call
+	maxItems int             // Maximum number of items to deliver (0 = unlimited)
+	prefetch int             // Number of pages to retrieve ahead of the consumer
+	onPage   func(*PageInfo) // Callback to invoke after each delivered page
+}
+
+// PageOption is a configuration option for crawling a paginated list.
+type PageOption func(*pageConfig)
+
+// WithCursor starts the crawl from a previously saved pagination cursor instead
+// of the beginning of the list.
+func WithCursor(cursor string) PageOption {
+	return func(cfg *pageConfig) { cfg.cursor = cursor }
+}
+
+// WithPageSize sets the number of items to request per API call. The value will
+// be clamped to the maximum accepted by the specific endpoint.
+func WithPageSize(items int) PageOption {
+	return func(cfg *pageConfig) { cfg.pageSize = items }
+}
+
+// WithMaxItems caps the total number of items to deliver (0 = unlimited).
+func WithMaxItems(items int) PageOption {
+	return func(cfg *pageConfig) { cfg.maxItems = items }
+}
+
+// WithPrefetch sets the number of pages to retrieve in the background, ahead of
+// the consumer. Streams default to 1, iterators to 0 (i.e. fetch on demand).
+func WithPrefetch(pages int) PageOption {
+	return func(cfg *pageConfig) { cfg.prefetch = pages }
+}
+
+// WithPageHook sets a callback to invoke after each fully delivered page, which
+// can be used for progress reporting or to checkpoint the cursor.
+func WithPageHook(hook func(info *PageInfo)) PageOption {
+	return func(cfg *pageConfig) { cfg.onPage = hook }
+}
+
+// withStartCursor adds an explicit starting cursor to a set of page options. An
+// empty cursor is dropped, so it does not override one set via WithCursor.
+func withStartCursor(cursor string, opts []PageOption) []PageOption {
+	if cursor == "" {
+		return opts
+	}
+	return append(slices.Clip(opts), WithCursor(cursor))
+}
+
+// newPageConfig assembles a crawl configuration from the user's options on top
+// of the given prefetch default.
+func newPageConfig(prefetch int, opts []PageOption) *pageConfig {
+	cfg := &pageConfig{
+		pageSize: defaultPageSize,
+		prefetch: prefetch,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.pageSize <= 0 {
+		cfg.pageSize = defaultPageSize
+	}
+	if cfg.prefetch < 0 {
+		cfg.prefetch = 0
+	}
+	return cfg
+}
+
+// paginator is a generic cursor based crawler over a paginated list endpoint.
+// It is not safe for concurrent use, wrappers must ensure a single user.
+type paginator[T any] struct {
+	fetch   pageFetcher[T] // Endpoint specific page retriever
+	config  *pageConfig    // Crawl options to respect
+	cursor  string         // Cursor of the next page to retrieve
+	fetched int            // Number of items retrieved so far
+	done    bool           // Whether the last page was already retrieved
+}
+
+// newPaginator creates a paginator over a list endpoint.
+func newPaginator[T any](fetch pageFetcher[T], config *pageConfig) *paginator[T] {
+	return &paginator[T]{
+		fetch:  fetch,
+		config: config,
+		cursor: config.cursor,
+	}
+}
+
+// next retrieves the next page of the list, or nil if the list is exhausted.
+func (p *paginator[T]) next(ctx context.Context) (*page[T], error) {
+	if p.done {
+		return nil, nil
+	}
+	// Request at most as many items as permitted by the item cap
+	limit := p.config.pageSize
+	if p.config.maxItems > 0 {
+		limit = min(limit, p.config.maxItems-p.fetched)
+	}
+	items, next, err := p.fetch(ctx, p.cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	p.fetched += len(items)
+
+	// If there are no further pages to retrieve (or the server is looping on an
+	// empty page, or the item cap was reached), mark the paginator done
+	if next == "" || (len(items) == 0 && next == p.cursor) {
+		p.done = true
+		next = ""
+	}
+	if p.config.maxItems > 0 && p.fetched >= p.config.maxItems {
+		p.done = true
+	}
+	p.cursor = next
+	return &page[T]{items: items, next: next}, nil
+}
+
+// puller returns a function to retrieve the pages of the list one by one, either
+// directly or from a background prefetcher as configured. The stop function must
+// be called to release any background resources.
+func (p *paginator[T]) puller(ctx context.Context) (pull func() (*page[T], error), stop func()) {
+	if p.config.prefetch == 0 {
+		return func() (*page[T], error) { return p.next(ctx) }, func() {}
+	}
+	// Prefetching requested, retrieve the pages on a background thread
+	var (
+		pages = make(chan *page[T], p.config.prefetch)
+		fails = make(chan error, 1)
+		done  = make(chan struct{})
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer close(done)
+		defer close(pages)
+
+		for {
+			page, err := p.next(ctx)
+			if err != nil {
+				fails <- err
+				return
+			}
+			if page == nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case pages <- page:
+			}
+		}
+	}()
+	pull = func() (*page[T], error) {
+		if page, ok := <-pages; ok {
+			return page, nil
+		}
+		select {
+		case err := <-fails:
+			return nil, err
+		default:
+			return nil, ctx.Err()
+		}
+	}
+	stop = func() {
+		cancel()
+		<-done
+	}
+	return pull, stop
+}
+
+// iterate returns an iterator over every item of a paginated list. Unless page
+// prefetching is requested, the pages are retrieved on demand on the caller's
+// thread. Either way, breaking out of the iteration early does not leave anything
+// running in the background.
+//
+// If a failure occurs, it's yielded as the error of the last iteration step.
+func iterate[T any](ctx context.Context, fetch pageFetcher[T], opts []PageOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var (
+			config     = newPageConfig(0, opts)
+			pull, stop = newPaginator(fetch, config).puller(ctx)
+			delivered  int
+		)
+		defer stop()
+
+		for index := 0; ; index++ {
+			page, err := pull()
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			if page == nil {
+				return
+			}
+			for _, item := range page.items {
+				if err := ctx.Err(); err != nil {
+					var zero T
+					yield(zero, err)
+					return
+				}
+				if !yield(item, nil) {
+					return
+				}
+				delivered++
+			}
+			if config.onPage != nil {
+				config.onPage(&PageInfo{
+					Index:     index,
+					Items:     len(page.items),
+					Delivered: delivered,
+					Cursor:    page.next,
+				})
+			}
+		}
+	}
+}
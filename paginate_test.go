@@ -0,0 +1,153 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPrefetches are the prefetch settings to run the pagination tests with.
+var testPrefetches = []int{0, 1, 3}
+
+// Tests that iterating over a paginated list yields all items in order and can
+// be repeated.
+func TestIterate(t *testing.T) {
+	seq := iterate(context.Background(), makeTestFetcher(95, 10, -1), nil)
+
+	for run := 0; run < 2; run++ {
+		var next int
+		for item, err := range seq {
+			if err != nil {
+				t.Fatalf("run %d: iteration failed: %v", run, err)
+			}
+			if item != next {
+				t.Fatalf("run %d: item mismatch: have %d, want %d", run, item, next)
+			}
+			next++
+		}
+		if next != 95 {
+			t.Fatalf("run %d: item count mismatch: have %d, want %d", run, next, 95)
+		}
+	}
+}
+
+// Tests that breaking out of an iteration stops fetching further pages.
+func TestIterateBreak(t *testing.T) {
+	var (
+		fetcher = makeTestFetcher(100, 10, -1)
+		fetches int
+	)
+	seq := iterate(context.Background(), func(ctx context.Context, cursor string, limit int) ([]int, string, error) {
+		fetches++
+		return fetcher(ctx, cursor, limit)
+	}, nil)
+	for item, err := range seq {
+		if err != nil {
+			t.Fatalf("iteration failed: %v", err)
+		}
+		if item == 15 {
+			break
+		}
+	}
+	if fetches != 2 {
+		t.Fatalf("page fetch count mismatch: have %d, want %d", fetches, 2)
+	}
+}
+
+// Tests that failures are yielded as the last iteration step.
+func TestIterateFailure(t *testing.T) {
+	var (
+		items int
+		fails int
+	)
+	for _, err := range iterate(context.Background(), makeTestFetcher(100, 10, 30), nil) {
+		if err != nil {
+			fails++
+			continue
+		}
+		if fails > 0 {
+			t.Fatalf("item yielded after failure")
+		}
+		items++
+	}
+	if items != 30 || fails != 1 {
+		t.Fatalf("iteration result mismatch: have %d items and %d failures, want %d and %d", items, fails, 30, 1)
+	}
+}
+
+// Tests that the page size and item cap options are respected, both with and
+// without prefetching, and that the page hook reports the progress.
+func TestIterateOptions(t *testing.T) {
+	for _, prefetch := range testPrefetches {
+		var (
+			fetcher = makeTestFetcher(100, 50, -1)
+			limits  []int
+			infos   []PageInfo
+		)
+		seq := iterate(context.Background(), func(ctx context.Context, cursor string, limit int) ([]int, string, error) {
+			limits = append(limits, limit)
+			return fetcher(ctx, cursor, limit)
+		}, []PageOption{
+			WithPageSize(20),
+			WithMaxItems(50),
+			WithPrefetch(prefetch),
+			WithPageHook(func(info *PageInfo) { infos = append(infos, *info) }),
+		})
+		var items int
+		for _, err := range seq {
+			if err != nil {
+				t.Fatalf("prefetch %d: iteration failed: %v", prefetch, err)
+			}
+			items++
+		}
+		if items != 50 {
+			t.Errorf("prefetch %d: item count mismatch: have %d, want %d", prefetch, items, 50)
+		}
+		if want := []int{20, 20, 10}; len(limits) != len(want) || limits[0] != want[0] || limits[1] != want[1] || limits[2] != want[2] {
+			t.Errorf("prefetch %d: requested limits mismatch: have %v, want %v", prefetch, limits, want)
+		}
+		if len(infos) != 3 {
+			t.Fatalf("prefetch %d: page hook count mismatch: have %d, want %d", prefetch, len(infos), 3)
+		}
+		if last := infos[2]; last.Index != 2 || last.Items != 10 || last.Delivered != 50 || last.Cursor != "50" {
+			t.Errorf("prefetch %d: last page info mismatch: have %+v", prefetch, last)
+		}
+	}
+}
+
+// Tests that breaking out of a prefetching iteration tears down the background
+// fetcher.
+func TestIterateBreakPrefetch(t *testing.T) {
+	var (
+		fetcher = makeTestFetcher(1000, 10, -1)
+		running atomic.Int32
+		fetches atomic.Int32
+	)
+	seq := iterate(context.Background(), func(ctx context.Context, cursor string, limit int) ([]int, string, error) {
+		running.Add(1)
+		defer running.Add(-1)
+
+		fetches.Add(1)
+		time.Sleep(time.Millisecond) // simulate some network latency
+		return fetcher(ctx, cursor, limit)
+	}, []PageOption{WithPrefetch(2)})
+
+	for item := range seq {
+		if item == 25 {
+			break
+		}
+	}
+	if n := running.Load(); n != 0 {
+		t.Fatalf("background fetches still running after break: %d", n)
+	}
+	done := fetches.Load()
+	time.Sleep(50 * time.Millisecond)
+	if n := fetches.Load(); n != done {
+		t.Fatalf("background fetches continued after break: have %d, want %d", n, done)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// maxPostsPerCall is the maximum number of posts the server will accept in a
+// single batch post query.
+const maxPostsPerCall = 25
+
+// ErrPostNotFound is returned if a post is requested that the server does not
+// know about (or refuses to return, e.g. due to blocks).
+var ErrPostNotFound = errors.New("post not found")
+
+// Post represents a post (skeet) on a Bluesky server.
+type Post struct {
+	client *Client // Embedded API client to interact with the post
+
+	URI string // AT-URI of the post record (at://did/app.bsky.feed.post/rkey)
+	CID string // Content hash of the specific version of the post
+
+	Author *User    // User who made the post
+	Text   string   // Textual content of the post, may be empty if there are embeds
+	Langs  []string // Languages the post is written in
+	Tags   []string // Additional hashtags on top of any within the text
+	Facets []*Facet // Mentions, links and hashtags annotated within the text
+
+	ReplyParent *RecordRef // Post this one replies to, nil if not a reply
+	ReplyRoot   *RecordRef // Root post of the thread this one is part of, nil if not a reply
+	Quote       *RecordRef // Record embedded (quoted) in this post, nil if none
+
+	CreatedAt time.Time // Time when the post was created (as claimed by the author)
+	IndexedAt time.Time // Time when the post was indexed by the server
+
+	ReplyCount  uint // Number of replies to this post
+	RepostCount uint // Number of reposts of this post
+	LikeCount   uint // Number of likes of this post
+	QuoteCount  uint // Number of quotes of this post
+
+	Labels []*Label        // Moderation labels attached to the post
+	Viewer PostViewerState // Interactions of the logged in user with this post
+}
+
+// PostViewerState tracks the interactions of the logged in user (the viewer)
+// with a post on a Bluesky server.
+type PostViewerState struct {
+	Like   string // URI of the viewer's like record, empty if not liked
+	Repost string // URI of the viewer's repost record, empty if not reposted
+}
+
+// FetchPost retrieves all the metadata about a specific post.
+func (c *Client) FetchPost(ctx context.Context, uri string) (*Post, error) {
+	posts, err := c.FetchPosts(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if posts[0] == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPostNotFound, uri)
+	}
+	return posts[0], nil
+}
+
+// FetchPosts retrieves all the metadata about a batch of posts. The results are
+// returned in the same order as requested, with nil entries for posts that the
+// server did not return (e.g. deleted).
+//
+// Note, the server limits the number of posts that can be queried at once, so
+// this method will split the request up into multiple API calls if needed.
+func (c *Client) FetchPosts(ctx context.Context, uris ...string) ([]*Post, error) {
+	// Validate and normalize the URIs, without modifying the caller's slice
+	normalized := make([]string, len(uris))
+	for i, uri := range uris {
+		repo, collection, rkey, err := parseATURI(uri)
+		if err != nil {
+			return nil, err
+		}
+		normalized[i] = "at://" + repo + "/" + collection + "/" + rkey
+	}
+	uris = normalized
+
+	posts := make([]*Post, 0, len(uris))
+	for len(uris) > 0 {
+		batch := uris
+		if len(batch) > maxPostsPerCall {
+			batch = batch[:maxPostsPerCall]
+		}
+		uris = uris[len(batch):]
+
+		res, err := bsky.FeedGetPosts(ctx, c.client, batch)
+		if err != nil {
+			return nil, err
+		}
+		// The server might return the posts in any order and skip some, and the
+		// requested URIs might reference the authors by handle instead of DID, so
+		// match them up via the authors and record keys
+		found := make(map[string]*bsky.FeedDefs_PostView)
+		for _, post := range res.Posts {
+			if _, _, rkey, err := parseATURI(post.Uri); err == nil {
+				found[post.Author.Did+"/"+rkey] = post
+				found[post.Author.Handle+"/"+rkey] = post
+			}
+		}
+		for _, uri := range batch {
+			repo, _, rkey, err := parseATURI(uri)
+			if err != nil {
+				return nil, err
+			}
+			view, ok := found[repo+"/"+rkey]
+			if !ok {
+				posts = append(posts, nil)
+				continue
+			}
+			posts = append(posts, newPostFromView(c, view))
+		}
+	}
+	return posts, nil
+}
+
+// newPostFromView converts an API post view into the library's post type,
+// dropping the pointless pointers.
+func newPostFromView(client *Client, view *bsky.FeedDefs_PostView) *Post {
+	post := &Post{
+		client:    client,
+		URI:       view.Uri,
+		CID:       view.Cid,
+		Author:    newUserFromBasicView(client, view.Author),
+		IndexedAt: parseTime(&view.IndexedAt),
+		Labels:    parseLabels(view.Labels),
+	}
+	if view.ReplyCount != nil {
+		post.ReplyCount = uint(*view.ReplyCount)
+	}
+	if view.RepostCount != nil {
+		post.RepostCount = uint(*view.RepostCount)
+	}
+	if view.LikeCount != nil {
+		post.LikeCount = uint(*view.LikeCount)
+	}
+	if view.QuoteCount != nil {
+		post.QuoteCount = uint(*view.QuoteCount)
+	}
+	if view.Viewer != nil {
+		if view.Viewer.Like != nil {
+			post.Viewer.Like = *view.Viewer.Like
+		}
+		if view.Viewer.Repost != nil {
+			post.Viewer.Repost = *view.Viewer.Repost
+		}
+	}
+	if view.Record != nil {
+		if record, ok := view.Record.Val.(*bsky.FeedPost); ok {
+			post.fillRecord(record)
+		}
+	}
+	return post
+}
+
+// fillRecord injects the fields from a raw post record into a post.
+func (p *Post) fillRecord(record *bsky.FeedPost) {
+	p.Text = record.Text
+	p.Langs = record.Langs
+	p.Tags = record.Tags
+	p.Facets = parseFacets(record.Text, record.Facets)
+	p.CreatedAt = parseTime(&record.CreatedAt)
+
+	if record.Reply != nil {
+		if record.Reply.Parent != nil {
+			p.ReplyParent = &RecordRef{URI: record.Reply.Parent.Uri, CID: record.Reply.Parent.Cid}
+		}
+		if record.Reply.Root != nil {
+			p.ReplyRoot = &RecordRef{URI: record.Reply.Root.Uri, CID: record.Reply.Root.Cid}
+		}
+	}
+	if record.Embed != nil {
+		switch {
+		case record.Embed.EmbedRecord != nil && record.Embed.EmbedRecord.Record != nil:
+			quote := record.Embed.EmbedRecord.Record
+			p.Quote = &RecordRef{URI: quote.Uri, CID: quote.Cid}
+
+		case record.Embed.EmbedRecordWithMedia != nil && record.Embed.EmbedRecordWithMedia.Record != nil && record.Embed.EmbedRecordWithMedia.Record.Record != nil:
+			quote := record.Embed.EmbedRecordWithMedia.Record.Record
+			p.Quote = &RecordRef{URI: quote.Uri, CID: quote.Cid}
+		}
+	}
+}
+
+// newUserFromBasicView converts an API basic profile view into the library's
+// user type, dropping the pointless pointers.
+func newUserFromBasicView(client *Client, view *bsky.ActorDefs_ProfileViewBasic) *User {
+	if view == nil {
+		return nil
+	}
+	user := &User{
+		client: client,
+		Handle: view.Handle,
+		DID:    view.Did,
+	}
+	if view.DisplayName != nil {
+		user.Name = *view.DisplayName
+	}
+	if view.Avatar != nil {
+		user.AvatarURL = *view.Avatar
+	}
+	return user
+}
+
+// String implements the stringer interface to help debug things.
+func (p *Post) String() string {
+	if p.Author == nil {
+		return fmt.Sprintf("%s: %s", p.URI, maybeEscape(p.Text))
+	}
+	return fmt.Sprintf("%s (%s): %s", p.Author.Handle, p.URI, maybeEscape(p.Text))
+}
+
+// Ref returns a strong reference to the specific version of the post.
+func (p *Post) Ref() *RecordRef {
+	return &RecordRef{URI: p.URI, CID: p.CID}
+}
@@ -11,10 +11,14 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"iter"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/karalabe/go-bluesky/syntax"
 )
 
 const (
@@ -48,6 +52,38 @@ type Profile struct {
 	Followees     []*User // Actual list of followees, nil if not yet resolved
 
 	PostCount uint // Number of posts this user made
+
+	ListCount        uint // Number of lists this user created
+	FeedCount        uint // Number of feed generators this user operates
+	StarterPackCount uint // Number of starter packs this user created
+	Labeler          bool // Whether this user runs a labeler service
+
+	PinnedPost *RecordRef // Reference to the post pinned by the user, nil if unset
+
+	CreatedAt time.Time // Time when the account was created, zero if unknown
+	IndexedAt time.Time // Time when the profile was last indexed, zero if unknown
+
+	Labels []*Label    // Moderation labels attached to the profile
+	Viewer ViewerState // Relationship between the logged in user and this one
+}
+
+// ViewerState tracks the relationship between the logged in user (the viewer)
+// and some other user on a Bluesky server.
+type ViewerState struct {
+	Following  string // URI of the viewer's follow record, empty if not following
+	FollowedBy string // URI of the user's follow record, empty if not followed
+	Blocking   string // URI of the viewer's block record, empty if not blocking
+	BlockedBy  bool   // Whether the user is blocking the viewer
+	Muted      bool   // Whether the viewer has muted the user
+}
+
+// Label is a moderation label attached to some content by a labeler.
+type Label struct {
+	Source  string    // DID of the actor who created the label
+	Value   string    // Short string name of the value or type of the label
+	Negated bool      // Whether this label negates a previous one
+	Created time.Time // Time when the label was created
+	Expires time.Time // Time when the label expires, zero if never
 }
 
 // User tracks some metadata about a user on a Bluesky server.
@@ -76,19 +112,33 @@ func (c *Client) FetchProfile(ctx context.Context, id string) (*Profile, error)
 	if strings.HasPrefix(id, "at://") {
 		id = id[5:]
 	}
+	actor, err := syntax.ParseAtIdentifier(id)
+	if err != nil {
+		return nil, err
+	}
 	// Retrieve the remote profile
-	profile, err := bsky.ActorGetProfile(ctx, c.client, id)
+	profile, err := bsky.ActorGetProfile(ctx, c.client, actor.String())
 	if err != nil {
 		return nil, err
 	}
 	// Dig out the relevant fields and drop pointless pointers
 	p := &Profile{
-		client:        c,
-		Handle:        profile.Handle,
-		DID:           profile.Did,
-		FollowerCount: uint(*profile.FollowersCount),
-		FolloweeCount: uint(*profile.FollowsCount),
-		PostCount:     uint(*profile.PostsCount),
+		client:    c,
+		Handle:    profile.Handle,
+		DID:       profile.Did,
+		CreatedAt: parseTime(profile.CreatedAt),
+		IndexedAt: parseTime(profile.IndexedAt),
+		Labels:    parseLabels(profile.Labels),
+		Viewer:    parseViewerState(profile.Viewer),
+	}
+	if profile.FollowersCount != nil {
+		p.FollowerCount = uint(*profile.FollowersCount)
+	}
+	if profile.FollowsCount != nil {
+		p.FolloweeCount = uint(*profile.FollowsCount)
+	}
+	if profile.PostsCount != nil {
+		p.PostCount = uint(*profile.PostsCount)
 	}
 	if profile.DisplayName != nil {
 		p.Name = *profile.DisplayName
@@ -102,9 +152,76 @@ func (c *Client) FetchProfile(ctx context.Context, id string) (*Profile, error)
 	if profile.Banner != nil {
 		p.BannerURL = *profile.Banner
 	}
+	if assoc := profile.Associated; assoc != nil {
+		if assoc.Lists != nil {
+			p.ListCount = uint(*assoc.Lists)
+		}
+		if assoc.Feedgens != nil {
+			p.FeedCount = uint(*assoc.Feedgens)
+		}
+		if assoc.StarterPacks != nil {
+			p.StarterPackCount = uint(*assoc.StarterPacks)
+		}
+		if assoc.Labeler != nil {
+			p.Labeler = *assoc.Labeler
+		}
+	}
+	if profile.PinnedPost != nil {
+		p.PinnedPost = &RecordRef{
+			URI: profile.PinnedPost.Uri,
+			CID: profile.PinnedPost.Cid,
+		}
+	}
 	return p, nil
 }
 
+// parseViewerState converts an API viewer state into the library's version,
+// dropping the pointless pointers.
+func parseViewerState(viewer *bsky.ActorDefs_ViewerState) ViewerState {
+	var state ViewerState
+	if viewer == nil {
+		return state
+	}
+	if viewer.Following != nil {
+		state.Following = *viewer.Following
+	}
+	if viewer.FollowedBy != nil {
+		state.FollowedBy = *viewer.FollowedBy
+	}
+	if viewer.Blocking != nil {
+		state.Blocking = *viewer.Blocking
+	}
+	if viewer.BlockedBy != nil {
+		state.BlockedBy = *viewer.BlockedBy
+	}
+	if viewer.Muted != nil {
+		state.Muted = *viewer.Muted
+	}
+	return state
+}
+
+// parseLabels converts a list of API moderation labels into the library's
+// version, dropping the pointless pointers.
+func parseLabels(labels []*atproto.LabelDefs_Label) []*Label {
+	if len(labels) == 0 {
+		return nil
+	}
+	res := make([]*Label, 0, len(labels))
+	for _, label := range labels {
+		l := &Label{
+			Source:  label.Src,
+			Value:   label.Val,
+			Created: parseTime(&label.Cts),
+			Expires: parseTime(label.Exp),
+		}
+		if label.Neg != nil {
+			l.Negated = *label.Neg
+		}
+		res = append(res, l)
+	}
+	return res
+}
+
 // String implements the stringer interface to help debug things.
 func (p *Profile) String() string {
 	if p.Name == "" {
@@ -195,58 +312,49 @@ func (p *Profile) ResolveFollowers(ctx context.Context) error {
 //
 // Note, this method is meant to process the follower list as a stream, and will
 // thus not populate the profile's followers field.
-func (p *Profile) StreamFollowers(ctx context.Context) (<-chan *User, <-chan error) {
-	var (
-		cursor    string
-		followers = make(chan *User, 100) // Ensure all results fit to unblock a second call
-		errc      = make(chan error, 1)   // Ensure the failure fits to unblock termination
-	)
-	go func() {
-		// No matter what happens, close both channels
-		defer func() {
-			close(followers)
-			close(errc)
-		}()
-		for {
-			// Resolve the followers from the Bluesky server
-			res, err := bsky.GraphGetFollowers(ctx, p.client.client, p.DID, cursor, 100)
-			if err != nil {
-				errc <- err
-				return
-			}
-			// Parse the followers and feed them one by one to the sink channel
-			for _, follower := range res.Followers {
-				f := &User{
-					client: p.client,
-					Handle: follower.Handle,
-					DID:    follower.Did,
-				}
-				if follower.DisplayName != nil {
-					f.Name = *follower.DisplayName
-				}
-				if follower.Description != nil {
-					f.Bio = *follower.Description
-				}
-				if follower.Avatar != nil {
-					f.AvatarURL = *follower.Avatar
-				}
-				select {
-				case <-ctx.Done():
-					// Request is being torn down, abort
-					errc <- ctx.Err()
-					return
-				case followers <- f:
-					// Follower read, get the next one
-				}
-			}
-			// If there are further followers to parse, repeat
-			if res.Cursor == nil {
-				break
-			}
-			cursor = *res.Cursor
-		}
-	}()
-	return followers, errc
+func (p *Profile) StreamFollowers(ctx context.Context, opts ...PageOption) (<-chan *User, <-chan error) {
+	stream := p.StreamFollowersFrom(ctx, "", opts...)
+	return stream.Items(), stream.Err()
+}
+
+// StreamFollowersFrom gradually resolves the list of followers of a profile,
+// starting from a pagination cursor (empty to start from the beginning, or from
+// the cursor set via WithCursor, if any). The returned stream tracks the cursor
+// of the last fully delivered page, so that an interrupted crawl may be resumed
+// later.
+//
+// Note, this method is meant to process the follower list as a stream, and will
+// thus not populate the profile's followers field.
+func (p *Profile) StreamFollowersFrom(ctx context.Context, cursor string, opts ...PageOption) *Stream[*User] {
+	return newStream(ctx, p.fetchFollowers, withStartCursor(cursor, opts))
+}
+
+// IterFollowers returns an iterator over the full list of followers of a profile,
+// retrieving them page by page as the iteration progresses. Breaking out of the
+// loop early stops the crawl without leaving anything running in the background.
+//
+// Note, this method is meant to process the follower list as a stream, and will
+// thus not populate the profile's followers field.
+func (p *Profile) IterFollowers(ctx context.Context, opts ...PageOption) iter.Seq2[*User, error] {
+	return iterate(ctx, p.fetchFollowers, opts)
+}
+
+// fetchFollowers retrieves a single page of followers of a profile.
+func (p *Profile) fetchFollowers(ctx context.Context, cursor string, limit int) ([]*User, string, error) {
+	// Resolve the followers from the Bluesky server
+	res, err := bsky.GraphGetFollowers(ctx, p.client.client, p.DID, cursor, int64(min(limit, 100)))
+	if err != nil {
+		return nil, "", err
+	}
+	// Parse the followers and drop pointless pointers
+	followers := make([]*User, 0, len(res.Followers))
+	for _, follower := range res.Followers {
+		followers = append(followers, newUserFromView(p.client, follower))
+	}
+	if res.Cursor == nil {
+		return followers, "", nil
+	}
+	return followers, *res.Cursor, nil
 }
 
 // ResolveFollowees resolves the full list of followees of a profile and injects
@@ -277,58 +385,69 @@ func (p *Profile) ResolveFollowees(ctx context.Context) error {
 //
 // Note, this method is meant to process the followeer list as a stream, and will
 // thus not populate the profile's followees field.
-func (p *Profile) StreamFollowees(ctx context.Context) (<-chan *User, <-chan error) {
-	var (
-		cursor    string
-		followees = make(chan *User, 100) // Ensure all results fit to unblock a second call
-		errc      = make(chan error, 1)   // Ensure the failure fits to unblock termination
-	)
-	go func() {
-		// No matter what happens, close both channels
-		defer func() {
-			close(followees)
-			close(errc)
-		}()
-		for {
-			// Resolve the followees from the Bluesky server
-			res, err := bsky.GraphGetFollows(ctx, p.client.client, p.DID, cursor, 100)
-			if err != nil {
-				errc <- err
-				return
-			}
-			// Parse the followers and feed them one by one to the sink channel
-			for _, followee := range res.Follows {
-				f := &User{
-					client: p.client,
-					Handle: followee.Handle,
-					DID:    followee.Did,
-				}
-				if followee.DisplayName != nil {
-					f.Name = *followee.DisplayName
-				}
-				if followee.Description != nil {
-					f.Bio = *followee.Description
-				}
-				if followee.Avatar != nil {
-					f.AvatarURL = *followee.Avatar
-				}
-				select {
-				case <-ctx.Done():
-					// Request is being torn down, abort
-					errc <- ctx.Err()
-					return
-				case followees <- f:
-					// Followee read, get the next one
-				}
-			}
-			// If there are further followees to parse, repeat
-			if res.Cursor == nil {
-				break
-			}
-			cursor = *res.Cursor
-		}
-	}()
-	return followees, errc
+func (p *Profile) StreamFollowees(ctx context.Context, opts ...PageOption) (<-chan *User, <-chan error) {
+	stream := p.StreamFolloweesFrom(ctx, "", opts...)
+	return stream.Items(), stream.Err()
+}
+
+// StreamFolloweesFrom gradually resolves the list of followees of a profile,
+// starting from a pagination cursor (empty to start from the beginning, or from
+// the cursor set via WithCursor, if any). The returned stream tracks the cursor
+// of the last fully delivered page, so that an interrupted crawl may be resumed
+// later.
+//
+// Note, this method is meant to process the followee list as a stream, and will
+// thus not populate the profile's followees field.
+func (p *Profile) StreamFolloweesFrom(ctx context.Context, cursor string, opts ...PageOption) *Stream[*User] {
+	return newStream(ctx, p.fetchFollowees, withStartCursor(cursor, opts))
+}
+
+// IterFollowees returns an iterator over the full list of followees of a profile,
+// retrieving them page by page as the iteration progresses. Breaking out of the
+// loop early stops the crawl without leaving anything running in the background.
+//
+// Note, this method is meant to process the followee list as a stream, and will
+// thus not populate the profile's followees field.
+func (p *Profile) IterFollowees(ctx context.Context, opts ...PageOption) iter.Seq2[*User, error] {
+	return iterate(ctx, p.fetchFollowees, opts)
+}
+
+// fetchFollowees retrieves a single page of followees of a profile.
+func (p *Profile) fetchFollowees(ctx context.Context, cursor string, limit int) ([]*User, string, error) {
+	// Resolve the followees from the Bluesky server
+	res, err := bsky.GraphGetFollows(ctx, p.client.client, p.DID, cursor, int64(min(limit, 100)))
+	if err != nil {
+		return nil, "", err
+	}
+	// Parse the followees and drop pointless pointers
+	followees := make([]*User, 0, len(res.Follows))
+	for _, followee := range res.Follows {
+		followees = append(followees, newUserFromView(p.client, followee))
+	}
+	if res.Cursor == nil {
+		return followees, "", nil
+	}
+	return followees, *res.Cursor, nil
+}
+
+// newUserFromView converts an API profile view into the library's user type,
+// dropping the pointless pointers.
+func newUserFromView(client *Client, view *bsky.ActorDefs_ProfileView) *User {
+	user := &User{
+		client: client,
+		Handle: view.Handle,
+		DID:    view.Did,
+	}
+	if view.DisplayName != nil {
+		user.Name = *view.DisplayName
+	}
+	if view.Description != nil {
+		user.Bio = *view.Description
+	}
+	if view.Avatar != nil {
+		user.AvatarURL = *view.Avatar
+	}
+	return user
 }
 
 // String implements the stringer interface to help debug things.
@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net/http"
 	"testing"
 )
 
@@ -78,6 +79,30 @@ func testFetchProfile(t *testing.T, id string) {
 	}
 }
 
+// Tests that the extended metadata fields of a profile are populated.
+func TestFetchProfileDetails(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+	)
+	profile, err := client.FetchProfile(ctx, testDIDTester)
+	if err != nil {
+		t.Fatalf("failed to fetch user profile: %v", err)
+	}
+	if profile.CreatedAt.IsZero() {
+		t.Errorf("creation time mismatch: have zero, want non-zero")
+	}
+	if profile.IndexedAt.IsZero() {
+		t.Errorf("index time mismatch: have zero, want non-zero")
+	}
+	if profile.IndexedAt.Before(profile.CreatedAt) {
+		t.Errorf("index time before creation: indexed %v, created %v", profile.IndexedAt, profile.CreatedAt)
+	}
+	if profile.Labeler {
+		t.Errorf("labeler flag mismatch: have %v, want %v", profile.Labeler, false)
+	}
+}
+
 // Tests that the library can retrieve profile avatars and banners advertised.
 func TestResolveProfileImages(t *testing.T) {
 	var (
@@ -281,3 +306,65 @@ func TestResolveProfileFolloweeAvatar(t *testing.T) {
 		}
 	}
 }
+
+// makeTestGraphClient creates a client against a fake server with 25 followers
+// and 25 followees, paginated via their index.
+func makeTestGraphClient(t *testing.T) *Client {
+	t.Helper()
+
+	return makeTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var field string
+		switch r.URL.Path {
+		case "/xrpc/app.bsky.graph.getFollowers":
+			field = "followers"
+		case "/xrpc/app.bsky.graph.getFollows":
+			field = "follows"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		serveTestPage(w, r, 25, field, testUser, map[string]any{"subject": map[string]string{"did": "did:plc:tester", "handle": "tester.test"}})
+	}))
+}
+
+// Tests that follower and followee streams can be resumed from a cursor passed
+// as a page option.
+func TestStreamFollowersResume(t *testing.T) {
+	profile := &Profile{client: makeTestGraphClient(t), DID: "did:plc:tester"}
+
+	streams := map[string]func() (<-chan *User, <-chan error){
+		"followers": func() (<-chan *User, <-chan error) {
+			return profile.StreamFollowers(context.Background(), WithPageSize(10), WithCursor("20"))
+		},
+		"followees": func() (<-chan *User, <-chan error) {
+			stream := profile.StreamFolloweesFrom(context.Background(), "", WithPageSize(10), WithCursor("20"))
+			return stream.Items(), stream.Err()
+		},
+	}
+	for name, stream := range streams {
+		userc, errc := stream()
+
+		var users []*User
+		for user := range userc {
+			users = append(users, user)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("%s: failed to stream: %v", name, err)
+		}
+		if len(users) == 0 {
+			t.Fatalf("%s: resumed stream empty", name)
+		}
+		if len(users) != 5 || users[0].DID != "did:plc:user20" {
+			t.Errorf("%s: resumed stream mismatch: have %d users starting at %v", name, len(users), users[0])
+		}
+	}
+	// Ensure an explicit cursor takes precedence over the option
+	stream := profile.StreamFollowersFrom(context.Background(), "10", WithCursor("20"))
+	var users int
+	for range stream.Items() {
+		users++
+	}
+	if err := <-stream.Err(); err != nil || users != 15 {
+		t.Errorf("explicit cursor mismatch: have %d users, err %v, want 15", users, err)
+	}
+}
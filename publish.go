@@ -0,0 +1,226 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// maxImagesPerPost is the maximum number of images that can be attached to a
+// single post.
+const maxImagesPerPost = 4
+
+// PostDraft is the content of a post to publish.
+type PostDraft struct {
+	Text  string   // Textual content of the post, mentions, links and hashtags are annotated
+	Langs []string // Languages the post is written in
+	Tags  []string // Additional hashtags on top of any within the text
+
+	ReplyParent *RecordRef   // Post to reply to, nil if not a reply
+	ReplyRoot   *RecordRef   // Root post of the thread to reply in, defaults to the parent
+	Quote       *RecordRef   // Record to embed (quote) in the post, nil if none
+	Images      []*PostImage // Images to attach to the post (at most 4)
+}
+
+// PostImage is an image to attach to a post.
+type PostImage struct {
+	Data   []byte // Encoded image content (e.g. PNG, JPEG)
+	Alt    string // Alt text describing the image, for accessibility
+	Width  int    // Width of the image for the aspect ratio hint, 0 if unknown
+	Height int    // Height of the image for the aspect ratio hint, 0 if unknown
+}
+
+// Publish creates a new post on behalf of the logged in user, returning a
+// reference to the published record.
+func (c *Client) Publish(ctx context.Context, draft *PostDraft) (*RecordRef, error) {
+	return c.publish(ctx, draft, "")
+}
+
+// publish creates a new post with the given record key, or a server assigned
+// one if empty.
+func (c *Client) publish(ctx context.Context, draft *PostDraft, rkey string) (*RecordRef, error) {
+	record, err := c.newPostRecord(ctx, draft, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return c.createRecord(ctx, "app.bsky.feed.post", rkey, record)
+}
+
+// Reply publishes a textual reply to the post on behalf of the logged in user,
+// threading it into the same conversation.
+func (p *Post) Reply(ctx context.Context, text string) (*RecordRef, error) {
+	return p.client.Publish(ctx, p.ReplyDraft(text))
+}
+
+// ReplyDraft creates a post draft replying to the post, threaded into the same
+// conversation. The draft can be further customized before publishing.
+func (p *Post) ReplyDraft(text string) *PostDraft {
+	draft := &PostDraft{
+		Text:        text,
+		ReplyParent: p.Ref(),
+		ReplyRoot:   p.ReplyRoot,
+	}
+	if draft.ReplyRoot == nil {
+		draft.ReplyRoot = p.Ref()
+	}
+	return draft
+}
+
+// newPostRecord assembles the raw post record from a draft, annotating the text
+// and uploading any attached images.
+func (c *Client) newPostRecord(ctx context.Context, draft *PostDraft, created time.Time) (*bsky.FeedPost, error) {
+	if len(draft.Images) > maxImagesPerPost {
+		return nil, fmt.Errorf("too many images: have %d, max %d", len(draft.Images), maxImagesPerPost)
+	}
+	record := &bsky.FeedPost{
+		Text:      draft.Text,
+		Langs:     draft.Langs,
+		Tags:      draft.Tags,
+		Facets:    c.detectFacets(ctx, draft.Text),
+		CreatedAt: created.UTC().Format(time.RFC3339Nano),
+	}
+	if draft.ReplyParent != nil {
+		root := draft.ReplyRoot
+		if root == nil {
+			root = draft.ReplyParent
+		}
+		record.Reply = &bsky.FeedPost_ReplyRef{
+			Parent: &atproto.RepoStrongRef{Uri: draft.ReplyParent.URI, Cid: draft.ReplyParent.CID},
+			Root:   &atproto.RepoStrongRef{Uri: root.URI, Cid: root.CID},
+		}
+	}
+	// Upload any attached images and embed them along with the quote
+	var images *bsky.EmbedImages
+	if len(draft.Images) > 0 {
+		images = new(bsky.EmbedImages)
+		for _, image := range draft.Images {
+			res, err := atproto.RepoUploadBlob(ctx, c.client, bytes.NewReader(image.Data))
+			if err != nil {
+				return nil, err
+			}
+			embed := &bsky.EmbedImages_Image{Alt: image.Alt, Image: res.Blob}
+			if image.Width > 0 && image.Height > 0 {
+				embed.AspectRatio = &bsky.EmbedDefs_AspectRatio{Width: int64(image.Width), Height: int64(image.Height)}
+			}
+			images.Images = append(images.Images, embed)
+		}
+	}
+	var quote *bsky.EmbedRecord
+	if draft.Quote != nil {
+		quote = &bsky.EmbedRecord{
+			Record: &atproto.RepoStrongRef{Uri: draft.Quote.URI, Cid: draft.Quote.CID},
+		}
+	}
+	switch {
+	case images != nil && quote != nil:
+		record.Embed = &bsky.FeedPost_Embed{
+			EmbedRecordWithMedia: &bsky.EmbedRecordWithMedia{
+				Record: quote,
+				Media:  &bsky.EmbedRecordWithMedia_Media{EmbedImages: images},
+			},
+		}
+	case images != nil:
+		record.Embed = &bsky.FeedPost_Embed{EmbedImages: images}
+	case quote != nil:
+		record.Embed = &bsky.FeedPost_Embed{EmbedRecord: quote}
+	}
+	return record, nil
+}
+
+// DeletePost removes a post of the logged in user. The post may be referenced by
+// the user's DID or by the handle they are logged in with.
+func (c *Client) DeletePost(ctx context.Context, uri string) error {
+	_, collection, _, err := c.ownedRecord(uri)
+	if err != nil {
+		return err
+	}
+	if collection != "app.bsky.feed.post" {
+		return fmt.Errorf("record %s is not a post", uri)
+	}
+	return c.DeleteRecord(ctx, uri)
+}
+
+// EditPost replaces the text of a post of the logged in user, keeping everything
+// else (creation time, embeds, reply references) intact. The annotations of the
+// text are recreated.
+//
+// The post may be referenced by the user's DID or by the handle they are logged
+// in with. If the reference contains a content hash, the edit is only done if
+// the post still has that version, otherwise a *ConflictError is returned. The
+// check is also enforced server side, so concurrent edits cannot be lost.
+func (c *Client) EditPost(ctx context.Context, post *RecordRef, text string) (*RecordRef, error) {
+	ref, _, err := c.editPost(ctx, post, text)
+	return ref, err
+}
+
+// editPost is the implementation of EditPost, also returning the new version of
+// the raw post record.
+func (c *Client) editPost(ctx context.Context, post *RecordRef, text string) (*RecordRef, *bsky.FeedPost, error) {
+	_, collection, _, err := c.ownedRecord(post.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	if collection != "app.bsky.feed.post" {
+		return nil, nil, fmt.Errorf("record %s is not a post", post.URI)
+	}
+	// Retrieve the current version of the post and ensure it's the expected one
+	res, err := c.getRecord(ctx, post.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Keep the raw fields of the post, so anything not modelled by the lexicon
+	// bindings is retained as is
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(res.Value, &fields); err != nil || fields == nil || res.CID == nil {
+		return nil, nil, fmt.Errorf("record %s is not a valid post", post.URI)
+	}
+	record := new(bsky.FeedPost)
+	if err := json.Unmarshal(res.Value, record); err != nil {
+		return nil, nil, fmt.Errorf("record %s is not a valid post", post.URI)
+	}
+	if post.CID != "" && post.CID != *res.CID {
+		return nil, nil, &ConflictError{URI: post.URI, Want: post.CID, Have: *res.CID}
+	}
+	// Replace the text and its annotations, and swap the post out
+	record.Text = text
+	record.Facets = c.detectFacets(ctx, text)
+
+	fields["text"], _ = json.Marshal(record.Text)
+	if len(record.Facets) > 0 {
+		fields["facets"], _ = json.Marshal(record.Facets)
+	} else {
+		delete(fields, "facets")
+	}
+	ref, err := PutRecord(ctx, c, post.URI, fields, WithSwapRecord(*res.CID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ref, record, nil
+}
+
+// Delete removes the post, which must have been made by the logged in user.
+func (p *Post) Delete(ctx context.Context) error {
+	return p.client.DeletePost(ctx, p.URI)
+}
+
+// Edit replaces the text of the post, which must have been made by the logged in
+// user. If the post was modified since it was retrieved, a *ConflictError is
+// returned. On success, the post's content and version are updated.
+func (p *Post) Edit(ctx context.Context, text string) error {
+	ref, record, err := p.client.editPost(ctx, p.Ref(), text)
+	if err != nil {
+		return err
+	}
+	p.CID = ref.CID
+	p.fillRecord(record)
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// Tests that posts can be published and replied to in-thread.
+func TestPublishReply(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+	)
+	ref, err := client.Publish(ctx, &PostDraft{Text: "go-bluesky test post, please ignore #gobluesky", Langs: []string{"en"}})
+	if err != nil {
+		t.Fatalf("failed to publish post: %v", err)
+	}
+	defer client.DeletePost(ctx, ref.URI)
+
+	post, err := client.FetchPost(ctx, ref.URI)
+	if err != nil {
+		t.Fatalf("failed to fetch published post: %v", err)
+	}
+	if len(post.Facets) != 1 || post.Facets[0].Tag != "gobluesky" {
+		t.Errorf("published facets mismatch: have %v", post.Facets)
+	}
+	reply, err := post.Reply(ctx, "go-bluesky test reply, please ignore")
+	if err != nil {
+		t.Fatalf("failed to reply to post: %v", err)
+	}
+	defer client.DeletePost(ctx, reply.URI)
+
+	if post, err = client.FetchPost(ctx, reply.URI); err != nil {
+		t.Fatalf("failed to fetch reply: %v", err)
+	}
+	if post.ReplyParent == nil || *post.ReplyParent != *ref || post.ReplyRoot == nil || *post.ReplyRoot != *ref {
+		t.Errorf("reply threading mismatch: have parent %v, root %v, want %v", post.ReplyParent, post.ReplyRoot, ref)
+	}
+}
+
+// Tests that posts can be edited in place, preserving everything but the text,
+// and that concurrent modifications are detected.
+func TestEditPost(t *testing.T) {
+	var (
+		server = newTestRepoServer()
+		client = makeTestServerClient(t, server)
+		ctx    = context.Background()
+	)
+	parent := &RecordRef{URI: "at://did:plc:other/app.bsky.feed.post/parent", CID: "cid-parent"}
+	ref, err := client.Publish(ctx, &PostDraft{Text: "original #tag", Langs: []string{"en"}, ReplyParent: parent})
+	if err != nil {
+		t.Fatalf("failed to publish post: %v", err)
+	}
+	original, err := client.getRecord(ctx, ref.URI)
+	if err != nil {
+		t.Fatalf("failed to retrieve original post: %v", err)
+	}
+	var before bsky.FeedPost
+	if err := json.Unmarshal(original.Value, &before); err != nil {
+		t.Fatalf("failed to decode original post: %v", err)
+	}
+	// Inject a field unknown to the lexicon bindings, which must survive the edit
+	var fields map[string]json.RawMessage
+	json.Unmarshal(original.Value, &fields)
+	fields["via"] = json.RawMessage(`"custom-client"`)
+
+	server.lock.Lock()
+	for _, record := range server.records {
+		record.value, _ = json.Marshal(fields)
+	}
+	server.lock.Unlock()
+
+	// Edit the post and ensure only the text and annotations changed
+	edited, err := client.EditPost(ctx, ref, "edited https://example.com")
+	if err != nil {
+		t.Fatalf("failed to edit post: %v", err)
+	}
+	if edited.URI != ref.URI || edited.CID == ref.CID {
+		t.Errorf("edited reference mismatch: have %v, original %v", edited, ref)
+	}
+	res, err := client.getRecord(ctx, ref.URI)
+	if err != nil {
+		t.Fatalf("failed to retrieve edited post: %v", err)
+	}
+	var after bsky.FeedPost
+	if err := json.Unmarshal(res.Value, &after); err != nil {
+		t.Fatalf("failed to decode edited post: %v", err)
+	}
+	if after.Text != "edited https://example.com" {
+		t.Errorf("edited text mismatch: have %q", after.Text)
+	}
+	if len(after.Facets) != 1 || after.Facets[0].Features[0].RichtextFacet_Link == nil {
+		t.Errorf("edited facets mismatch: have %v", after.Facets)
+	}
+	if after.CreatedAt != before.CreatedAt {
+		t.Errorf("creation time changed: have %s, want %s", after.CreatedAt, before.CreatedAt)
+	}
+	if after.Reply == nil || after.Reply.Parent.Uri != parent.URI || after.Reply.Root.Uri != parent.URI {
+		t.Errorf("reply references not preserved: have %+v", after.Reply)
+	}
+	if len(after.Langs) != 1 || after.Langs[0] != "en" {
+		t.Errorf("languages not preserved: have %v", after.Langs)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(res.Value, &raw); err != nil || string(raw["via"]) != `"custom-client"` {
+		t.Errorf("unknown field not preserved: have %s", raw["via"])
+	}
+	// Editing the stale version should be rejected with a conflict
+	_, err = client.EditPost(ctx, ref, "lost update")
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("stale edit not rejected: %v", err)
+	}
+	if conflict.Want != ref.CID || conflict.Have != edited.CID {
+		t.Errorf("conflict mismatch: have %+v", conflict)
+	}
+	// Swapping the stale version server side should also be rejected
+	if _, err := PutRecord(ctx, client, ref.URI, &after, WithSwapRecord(ref.CID)); !errors.As(err, &conflict) {
+		t.Errorf("stale swap not rejected: %v", err)
+	}
+}
+
+// Tests that posts can be deleted, but only if owned by the logged in user.
+func TestDeletePost(t *testing.T) {
+	var (
+		server = newTestRepoServer()
+		client = makeTestServerClient(t, server)
+		ctx    = context.Background()
+	)
+	ref, err := client.Publish(ctx, &PostDraft{Text: "to be deleted"})
+	if err != nil {
+		t.Fatalf("failed to publish post: %v", err)
+	}
+	if err := client.DeletePost(ctx, "at://did:plc:other/app.bsky.feed.post/abc"); !errors.Is(err, ErrRecordNotOwned) {
+		t.Errorf("foreign post deletion not rejected: %v", err)
+	}
+	// Delete the post via the logged in handle instead of the DID
+	_, _, rkey, _ := parseATURI(ref.URI)
+	if err := client.DeletePost(ctx, "at://Tester.Test/app.bsky.feed.post/"+rkey); err != nil {
+		t.Fatalf("failed to delete post: %v", err)
+	}
+	if _, err := client.getRecord(ctx, ref.URI); !isRecordNotFound(err) {
+		t.Errorf("deleted post still retrievable: %v", err)
+	}
+}
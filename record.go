@@ -0,0 +1,470 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+var (
+	// ErrRecordNotOwned is returned if a write operation targets a record that
+	// is not in the logged in user's repository.
+	ErrRecordNotOwned = errors.New("record not owned by user")
+
+	// ErrRecordNotFound is returned if a record is requested that the server
+	// does not know about.
+	ErrRecordNotFound = errors.New("record not found")
+)
+
+// maxRecordsPerCall is the maximum number of records the server will return in
+// a single listing query.
+const maxRecordsPerCall = 100
+
+// ConflictError is returned if a compare-and-swap write operation is rejected
+// because the record changed since it was last retrieved.
+type ConflictError struct {
+	URI  string // AT-URI of the record (or repository) that was attempted to be modified
+	Want string // Content hash the record was expected to have, empty if expected to be missing
+	Have string // Content hash the record actually has, empty if missing or unknown
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string {
+	if e.Have == "" {
+		return fmt.Sprintf("record %s changed: want %s", e.URI, e.Want)
+	}
+	return fmt.Sprintf("record %s changed: have %s, want %s", e.URI, e.Have, e.Want)
+}
+
+// RecordRef is a strong reference to a specific version of a record stored in
+// a user's repository.
+type RecordRef struct {
+	URI string // AT-URI of the record (at://did/collection/rkey)
+	CID string // Content hash of the specific version of the record
+}
+
+// parseATURI validates an AT-URI of a record and splits it into its normalized
+// repository (DID or handle), collection and record key components.
+func parseATURI(uri string) (repo string, collection string, rkey string, err error) {
+	parsed, err := syntax.ParseATURI(uri)
+	if err != nil {
+		return "", "", "", err
+	}
+	if parsed.RecordKey() == "" {
+		return "", "", "", fmt.Errorf("%w: record uri %q: want at://repo/collection/rkey", syntax.ErrInvalidSyntax, uri)
+	}
+	return parsed.Authority().String(), parsed.Collection().String(), parsed.RecordKey().String(), nil
+}
+
+// createRecord creates a new record in the logged in user's repository with the
+// given record key, or a server assigned one if empty.
+func (c *Client) createRecord(ctx context.Context, collection string, rkey string, record lexutil.CBOR) (*RecordRef, error) {
+	did, err := c.userDID()
+	if err != nil {
+		return nil, err
+	}
+	input := &atproto.RepoCreateRecord_Input{
+		Collection: collection,
+		Repo:       did,
+		Record:     &lexutil.LexiconTypeDecoder{Val: record},
+	}
+	if rkey != "" {
+		input.Rkey = &rkey
+	}
+	res, err := atproto.RepoCreateRecord(ctx, c.client, input)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordRef{URI: res.Uri, CID: res.Cid}, nil
+}
+
+// fetchRecordRef retrieves the current version of a record, returning a strong
+// reference to it.
+func (c *Client) fetchRecordRef(ctx context.Context, uri string) (*RecordRef, error) {
+	res, err := c.getRecord(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	ref := &RecordRef{URI: res.URI}
+	if res.CID != nil {
+		ref.CID = *res.CID
+	}
+	return ref, nil
+}
+
+// recordOutput is the response of a com.atproto.repo.getRecord call. It is
+// defined locally to leave the record content undecoded, as the generated bindings
+// reject any record type they do not know about.
+type recordOutput struct {
+	URI   string          `json:"uri"`
+	CID   *string         `json:"cid"`
+	Value json.RawMessage `json:"value"`
+}
+
+// getRecord retrieves the current version of a record, along with its content.
+func (c *Client) getRecord(ctx context.Context, uri string) (*recordOutput, error) {
+	repo, collection, rkey, err := parseATURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	// Call the endpoint directly, the generated binding sends an empty content
+	// hash filter which the server rejects as malformed
+	var res recordOutput
+	params := map[string]interface{}{
+		"repo":       repo,
+		"collection": collection,
+		"rkey":       rkey,
+	}
+	if err := c.client.Do(ctx, xrpc.Query, "", "com.atproto.repo.getRecord", params, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ownedRecord splits a record AT-URI into its components, ensuring that it is in
+// the logged in user's repository. The repository may be referenced either by
+// the DID or by the handle of the session, the returned repo is always the DID.
+//
+// Note, handles are not resolved, so a handle the user switched to since logging
+// in is rejected.
+func (c *Client) ownedRecord(uri string) (did string, collection string, rkey string, err error) {
+	if did, err = c.userDID(); err != nil {
+		return "", "", "", err
+	}
+	repo, collection, rkey, err := parseATURI(uri)
+	if err != nil {
+		return "", "", "", err
+	}
+	if repo != did && repo != c.userHandle() {
+		return "", "", "", fmt.Errorf("%w: %s not in %s", ErrRecordNotOwned, uri, did)
+	}
+	return did, collection, rkey, nil
+}
+
+// isInvalidSwap returns whether an error is the server rejecting a write due to
+// a compare-and-swap mismatch.
+func isInvalidSwap(err error) bool {
+	var xerr *xrpc.XRPCError
+	return errors.As(err, &xerr) && xerr.ErrStr == "InvalidSwap"
+}
+
+// isRecordNotFound returns whether an error is the server reporting a missing
+// record.
+func isRecordNotFound(err error) bool {
+	var xerr *xrpc.XRPCError
+	return errors.As(err, &xerr) && xerr.ErrStr == "RecordNotFound"
+}
+
+// Record is a typed record stored in a user's repository, along with the strong
+// reference to its specific version.
+type Record[T any] struct {
+	URI   string // AT-URI of the record (at://did/collection/rkey)
+	CID   string // Content hash of the specific version of the record
+	Value T      // Decoded content of the record
+}
+
+// Ref returns a strong reference to the specific version of the record.
+func (r *Record[T]) Ref() *RecordRef {
+	return &RecordRef{URI: r.URI, CID: r.CID}
+}
+
+// recordConfig is the set of options to write a record with.
+type recordConfig struct {
+	rkey       string // Record key to create the record with (empty = new TID)
+	swapRecord string // Content hash the record must currently have (empty = no check)
+	swapCommit string // Commit hash the repository must currently be at (empty = no check)
+}
+
+// RecordOption is a configuration option for writing a record.
+type RecordOption func(*recordConfig)
+
+// WithRecordKey creates the record with a specific record key instead of a newly
+// generated timestamp id. Only meaningful for record creation.
+func WithRecordKey(rkey string) RecordOption {
+	return func(cfg *recordConfig) { cfg.rkey = rkey }
+}
+
+// WithSwapRecord rejects the write with a *ConflictError unless the record's
+// current version matches the given content hash. Only meaningful for updates
+// and deletions.
+func WithSwapRecord(cid string) RecordOption {
+	return func(cfg *recordConfig) { cfg.swapRecord = cid }
+}
+
+// WithSwapCommit rejects the write with a *ConflictError unless the repository's
+// latest commit matches the given hash (see Client.LatestCommit).
+func WithSwapCommit(cid string) RecordOption {
+	return func(cfg *recordConfig) { cfg.swapCommit = cid }
+}
+
+// newRecordConfig assembles a record write configuration from the user's options.
+func newRecordConfig(opts []RecordOption) *recordConfig {
+	cfg := new(recordConfig)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// withRecordKey validates the record key of a create operation, generating a new
+// timestamp id if none was specified.
+func (cfg *recordConfig) withRecordKey() (*recordConfig, error) {
+	if cfg.rkey == "" {
+		cfg.rkey = syntax.NextTID().String()
+		return cfg, nil
+	}
+	if _, err := syntax.ParseRecordKey(cfg.rkey); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// conflict converts a compare-and-swap rejection into a *ConflictError, tagging
+// it with whichever hash the write was conditioned on.
+func (cfg *recordConfig) conflict(uri string) *ConflictError {
+	if cfg.swapRecord != "" {
+		return &ConflictError{URI: uri, Want: cfg.swapRecord}
+	}
+	return &ConflictError{URI: uri, Want: cfg.swapCommit}
+}
+
+// recordWriteInput is the request of a com.atproto.repo.createRecord or putRecord
+// call. It is defined locally to pass the record content pre-encoded, as the
+// generated bindings reject any record type they do not know about.
+type recordWriteInput struct {
+	Repo       string          `json:"repo"`
+	Collection string          `json:"collection"`
+	Rkey       string          `json:"rkey"`
+	Record     json.RawMessage `json:"record"`
+	SwapRecord *string         `json:"swapRecord,omitempty"`
+	SwapCommit *string         `json:"swapCommit,omitempty"`
+}
+
+// LatestCommit retrieves the hash of the latest commit of the logged in user's
+// repository, which can be used to condition writes on via WithSwapCommit.
+func (c *Client) LatestCommit(ctx context.Context) (string, error) {
+	did, err := c.userDID()
+	if err != nil {
+		return "", err
+	}
+	res, err := atproto.SyncGetLatestCommit(ctx, c.client, did)
+	if err != nil {
+		return "", err
+	}
+	return res.Cid, nil
+}
+
+// CreateRecord creates a new record of an arbitrary type in a collection of the
+// logged in user's repository. The record is encoded as JSON, with its $type set
+// to the collection if missing. Unless specified otherwise, the record key is a
+// newly generated timestamp id.
+//
+// Note, Go does not permit generic methods, hence the client being a parameter.
+// The collection may be a plain string or a syntax.NSID.
+func CreateRecord[T any, N ~string](ctx context.Context, c *Client, collection N, record T, opts ...RecordOption) (*RecordRef, error) {
+	did, err := c.userDID()
+	if err != nil {
+		return nil, err
+	}
+	blob, err := encodeRecord(string(collection), record)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := newRecordConfig(opts).withRecordKey()
+	if err != nil {
+		return nil, err
+	}
+	input := &recordWriteInput{
+		Repo:       did,
+		Collection: string(collection),
+		Rkey:       cfg.rkey,
+		Record:     blob,
+	}
+	if cfg.swapCommit != "" {
+		input.SwapCommit = &cfg.swapCommit
+	}
+	var res atproto.RepoCreateRecord_Output
+	if err := c.client.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.createRecord", nil, input, &res); err != nil {
+		if isInvalidSwap(err) {
+			return nil, cfg.conflict("at://" + did + "/" + string(collection) + "/" + cfg.rkey)
+		}
+		return nil, err
+	}
+	return &RecordRef{URI: res.Uri, CID: res.Cid}, nil
+}
+
+// GetRecord retrieves the current version of a record from any repository and
+// decodes its content into the requested type. The URI may be a plain string or
+// a syntax.ATURI.
+func GetRecord[T any, U ~string](ctx context.Context, c *Client, uri U) (*Record[T], error) {
+	res, err := c.getRecord(ctx, string(uri))
+	if err != nil {
+		if isRecordNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrRecordNotFound, uri)
+		}
+		return nil, err
+	}
+	record := &Record[T]{URI: res.URI}
+	if res.CID != nil {
+		record.CID = *res.CID
+	}
+	if err := json.Unmarshal(res.Value, &record.Value); err != nil {
+		return nil, fmt.Errorf("failed to decode record %s: %w", uri, err)
+	}
+	return record, nil
+}
+
+// PutRecord creates or replaces a record of an arbitrary type in the logged in
+// user's repository. The record is encoded as JSON, with its $type set to the
+// collection if missing.
+//
+// Note, Go does not permit generic methods, hence the client being a parameter.
+// The URI may be a plain string or a syntax.ATURI.
+func PutRecord[T any, U ~string](ctx context.Context, c *Client, uri U, record T, opts ...RecordOption) (*RecordRef, error) {
+	did, collection, rkey, err := c.ownedRecord(string(uri))
+	if err != nil {
+		return nil, err
+	}
+	blob, err := encodeRecord(collection, record)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newRecordConfig(opts)
+	input := &recordWriteInput{
+		Repo:       did,
+		Collection: collection,
+		Rkey:       rkey,
+		Record:     blob,
+	}
+	if cfg.swapRecord != "" {
+		input.SwapRecord = &cfg.swapRecord
+	}
+	if cfg.swapCommit != "" {
+		input.SwapCommit = &cfg.swapCommit
+	}
+	var res atproto.RepoPutRecord_Output
+	if err := c.client.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.putRecord", nil, input, &res); err != nil {
+		if isInvalidSwap(err) {
+			return nil, cfg.conflict(string(uri))
+		}
+		return nil, err
+	}
+	return &RecordRef{URI: res.Uri, CID: res.Cid}, nil
+}
+
+// DeleteRecord removes a record from the logged in user's repository. Deleting
+// a missing record is a noop.
+func (c *Client) DeleteRecord(ctx context.Context, uri string, opts ...RecordOption) error {
+	did, collection, rkey, err := c.ownedRecord(uri)
+	if err != nil {
+		return err
+	}
+	cfg := newRecordConfig(opts)
+	input := &atproto.RepoDeleteRecord_Input{
+		Collection: collection,
+		Repo:       did,
+		Rkey:       rkey,
+	}
+	if cfg.swapRecord != "" {
+		input.SwapRecord = &cfg.swapRecord
+	}
+	if cfg.swapCommit != "" {
+		input.SwapCommit = &cfg.swapCommit
+	}
+	if _, err := atproto.RepoDeleteRecord(ctx, c.client, input); err != nil {
+		if isInvalidSwap(err) {
+			return cfg.conflict(uri)
+		}
+		return err
+	}
+	return nil
+}
+
+// ListRecords returns an iterator over all the records in a collection of any
+// repository (DID or handle), decoding their content into the requested type and
+// retrieving them page by page as the iteration progresses. The repository and
+// collection may be plain strings or their syntax package types.
+func ListRecords[T any, R ~string, N ~string](ctx context.Context, c *Client, repo R, collection N, opts ...PageOption) iter.Seq2[*Record[T], error] {
+	return iterate(ctx, recordFetcher[T](c, string(repo), string(collection)), opts)
+}
+
+// recordFetcher creates a page fetcher over the records in a collection of a
+// repository, decoding their content into the requested type.
+func recordFetcher[T any](c *Client, repo string, collection string) pageFetcher[*Record[T]] {
+	id, err := syntax.ParseAtIdentifier(repo)
+	if err != nil {
+		return failedFetcher[*Record[T]](err)
+	}
+	nsid, err := syntax.ParseNSID(collection)
+	if err != nil {
+		return failedFetcher[*Record[T]](err)
+	}
+	repo, collection = id.String(), nsid.String()
+
+	return func(ctx context.Context, cursor string, limit int) ([]*Record[T], string, error) {
+		// Call the endpoint directly, the generated binding rejects any record
+		// type it does not know about
+		var res struct {
+			Cursor  *string         `json:"cursor"`
+			Records []*recordOutput `json:"records"`
+		}
+		params := map[string]interface{}{
+			"repo":       repo,
+			"collection": collection,
+			"limit":      min(limit, maxRecordsPerCall),
+		}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		if err := c.client.Do(ctx, xrpc.Query, "", "com.atproto.repo.listRecords", params, nil, &res); err != nil {
+			return nil, "", err
+		}
+		records := make([]*Record[T], 0, len(res.Records))
+		for _, rec := range res.Records {
+			record := &Record[T]{URI: rec.URI}
+			if rec.CID != nil {
+				record.CID = *rec.CID
+			}
+			if err := json.Unmarshal(rec.Value, &record.Value); err != nil {
+				return nil, "", fmt.Errorf("failed to decode record %s: %w", rec.URI, err)
+			}
+			records = append(records, record)
+		}
+		if res.Cursor == nil {
+			return records, "", nil
+		}
+		return records, *res.Cursor, nil
+	}
+}
+
+// encodeRecord encodes an arbitrary record into JSON, setting its $type to the
+// collection if the record does not declare one itself.
+func encodeRecord(collection string, record any) (json.RawMessage, error) {
+	if _, err := syntax.ParseNSID(collection); err != nil {
+		return nil, err
+	}
+	blob, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil || fields == nil {
+		return nil, fmt.Errorf("record for %s is not a JSON object", collection)
+	}
+	if kind, ok := fields["$type"]; ok && string(kind) != `""` && string(kind) != "null" {
+		return blob, nil
+	}
+	fields["$type"], _ = json.Marshal(collection)
+	return json.Marshal(fields)
+}
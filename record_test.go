@@ -0,0 +1,410 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+// Tests that record AT-URIs are split into their components correctly.
+func TestParseATURI(t *testing.T) {
+	tests := []struct {
+		uri        string
+		repo       string
+		collection string
+		rkey       string
+		fail       bool
+	}{
+		{uri: "at://" + testDIDTester + "/app.bsky.feed.post/3jv6wqr6tqs2x", repo: testDIDTester, collection: "app.bsky.feed.post", rkey: "3jv6wqr6tqs2x"},
+		{uri: "at://" + testHandleTester + "/app.bsky.feed.like/abc", repo: testHandleTester, collection: "app.bsky.feed.like", rkey: "abc"},
+		{uri: testDIDTester + "/app.bsky.feed.post/3jv6wqr6tqs2x", fail: true},
+		{uri: "at://" + testDIDTester + "/app.bsky.feed.post", fail: true},
+		{uri: "at://" + testDIDTester + "//3jv6wqr6tqs2x", fail: true},
+		{uri: "at://" + testDIDTester + "/app.bsky.feed.post/3jv6wqr6tqs2x/extra", fail: true},
+		{uri: "at://Tester.Example.COM/app.bsky.feed.like/abc", repo: "tester.example.com", collection: "app.bsky.feed.like", rkey: "abc"},
+		{uri: "at://" + testDIDTester + "/post/3jv6wqr6tqs2x", fail: true},
+		{uri: "at://" + testDIDTester + "/app.bsky.feed.post/..", fail: true},
+		{uri: "at://not_a_handle/app.bsky.feed.post/3jv6wqr6tqs2x", fail: true},
+	}
+	for _, tt := range tests {
+		repo, collection, rkey, err := parseATURI(tt.uri)
+		if tt.fail {
+			if !errors.Is(err, syntax.ErrInvalidSyntax) {
+				t.Errorf("%s: error mismatch: have %v, want %v", tt.uri, err, syntax.ErrInvalidSyntax)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed to parse URI: %v", tt.uri, err)
+			continue
+		}
+		if repo != tt.repo || collection != tt.collection || rkey != tt.rkey {
+			t.Errorf("%s: components mismatch: have %s/%s/%s, want %s/%s/%s", tt.uri, repo, collection, rkey, tt.repo, tt.collection, tt.rkey)
+		}
+	}
+}
+
+// Tests that the client APIs reject malformed identifiers without contacting the
+// server, and send the normalized forms of valid ones.
+func TestIdentifierValidation(t *testing.T) {
+	var (
+		lock sync.Mutex
+		uris []string
+	)
+	client := makeTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.URL.Path != "/xrpc/app.bsky.feed.getPosts" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		uris = append(uris, r.URL.Query()["uris"]...)
+		w.Write([]byte(`{"posts": []}`))
+	}))
+	ctx := context.Background()
+
+	if _, err := client.FetchProfile(ctx, "not_a_handle"); !errors.Is(err, syntax.ErrInvalidSyntax) {
+		t.Errorf("profile error mismatch: have %v, want %v", err, syntax.ErrInvalidSyntax)
+	}
+	if _, err := client.FetchPosts(ctx, "at://did:plc:bob/app.bsky.feed.post/a", "at://bob/post/b"); !errors.Is(err, syntax.ErrInvalidSyntax) {
+		t.Errorf("posts error mismatch: have %v, want %v", err, syntax.ErrInvalidSyntax)
+	}
+	if _, err := client.Like(ctx, "at://did:plc:bob/app.bsky.feed.post/.."); !errors.Is(err, syntax.ErrInvalidSyntax) {
+		t.Errorf("like error mismatch: have %v, want %v", err, syntax.ErrInvalidSyntax)
+	}
+	for _, err := range client.SearchPosts(ctx, &PostSearch{Query: "test", Author: "bob@example.com"}) {
+		if !errors.Is(err, syntax.ErrInvalidSyntax) {
+			t.Errorf("search error mismatch: have %v, want %v", err, syntax.ErrInvalidSyntax)
+		}
+	}
+	for _, err := range ListRecords[json.RawMessage](ctx, client, "did:plc:bob", "posts") {
+		if !errors.Is(err, syntax.ErrInvalidSyntax) {
+			t.Errorf("list error mismatch: have %v, want %v", err, syntax.ErrInvalidSyntax)
+		}
+	}
+	// Ensure valid identifiers are normalized before being sent to the server
+	if _, err := client.FetchPosts(ctx, "at://Bob.Example.COM/app.bsky.feed.post/a"); err != nil {
+		t.Fatalf("failed to fetch posts: %v", err)
+	}
+	if len(uris) != 1 || uris[0] != "at://bob.example.com/app.bsky.feed.post/a" {
+		t.Errorf("sent uris mismatch: have %v, want %v", uris, []string{"at://bob.example.com/app.bsky.feed.post/a"})
+	}
+}
+
+// testRepoServer is a minimal fake of the record APIs of a PDS, used to test the
+// record write flows offline.
+type testRepoServer struct {
+	lock    sync.Mutex
+	records map[string]*testRepoRecord // Records in the repo, indexed by collection/rkey
+	commits int                        // Number of batch write commits applied
+	creates int                        // Number of record creation calls
+	fails   int                        // Number of creation calls to fail with a server error
+}
+
+// testRepoRecord is a single record stored in the fake repo server.
+type testRepoRecord struct {
+	value   json.RawMessage
+	cid     string
+	version int
+}
+
+// newTestRepoServer creates an empty fake repo server.
+func newTestRepoServer() *testRepoServer {
+	return &testRepoServer{records: make(map[string]*testRepoRecord)}
+}
+
+func (s *testRepoServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fail := func(code int, kind string) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": kind})
+	}
+	var input struct {
+		Repo       string          `json:"repo"`
+		Collection string          `json:"collection"`
+		Rkey       string          `json:"rkey"`
+		Record     json.RawMessage `json:"record"`
+		SwapRecord *string         `json:"swapRecord"`
+		SwapCommit *string         `json:"swapCommit"`
+		Writes     []struct {
+			Type       string          `json:"$type"`
+			Collection string          `json:"collection"`
+			Rkey       string          `json:"rkey"`
+			Value      json.RawMessage `json:"value"`
+		} `json:"writes"`
+	}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			fail(http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+	}
+	switch r.URL.Path {
+	case "/xrpc/com.atproto.repo.createRecord":
+		s.creates++
+		if s.fails > 0 {
+			s.fails--
+			fail(http.StatusBadGateway, "UpstreamFailure")
+			return
+		}
+		if input.Rkey == "" {
+			input.Rkey = syntax.NextTID().String()
+		}
+		key := input.Collection + "/" + input.Rkey
+		if _, ok := s.records[key]; ok {
+			fail(http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		s.records[key] = &testRepoRecord{value: input.Record, cid: "cid-" + input.Rkey}
+		json.NewEncoder(w).Encode(map[string]string{
+			"uri": "at://" + input.Repo + "/" + key,
+			"cid": s.records[key].cid,
+		})
+
+	case "/xrpc/com.atproto.repo.putRecord":
+		key := input.Collection + "/" + input.Rkey
+		record, ok := s.records[key]
+		if input.SwapRecord != nil && (!ok || record.cid != *input.SwapRecord) {
+			fail(http.StatusBadRequest, "InvalidSwap")
+			return
+		}
+		if !ok {
+			record = new(testRepoRecord)
+			s.records[key] = record
+		}
+		record.version++
+		record.value = input.Record
+		record.cid = fmt.Sprintf("cid-%s-%d", input.Rkey, record.version)
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"uri": "at://" + input.Repo + "/" + key,
+			"cid": record.cid,
+		})
+
+	case "/xrpc/com.atproto.repo.deleteRecord":
+		delete(s.records, input.Collection+"/"+input.Rkey)
+		json.NewEncoder(w).Encode(map[string]string{})
+
+	case "/xrpc/com.atproto.repo.getRecord":
+		var (
+			query = r.URL.Query()
+			key   = query.Get("collection") + "/" + query.Get("rkey")
+		)
+		record, ok := s.records[key]
+		if !ok {
+			fail(http.StatusBadRequest, "RecordNotFound")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"uri":   "at://" + query.Get("repo") + "/" + key,
+			"cid":   record.cid,
+			"value": record.value,
+		})
+
+	case "/xrpc/com.atproto.repo.applyWrites":
+		if input.SwapCommit != nil && *input.SwapCommit != fmt.Sprintf("commit-%d", s.commits) {
+			fail(http.StatusBadRequest, "InvalidSwap")
+			return
+		}
+		for _, write := range input.Writes {
+			if _, ok := s.records[write.Collection+"/"+write.Rkey]; ok && write.Type == "com.atproto.repo.applyWrites#create" {
+				fail(http.StatusBadRequest, "InvalidRequest")
+				return
+			}
+		}
+		results := make([]any, 0, len(input.Writes))
+		for _, write := range input.Writes {
+			key := write.Collection + "/" + write.Rkey
+			switch write.Type {
+			case "com.atproto.repo.applyWrites#delete":
+				delete(s.records, key)
+				results = append(results, map[string]string{})
+			default:
+				record, ok := s.records[key]
+				if !ok {
+					record = new(testRepoRecord)
+					s.records[key] = record
+				}
+				record.version++
+				record.value = write.Value
+				record.cid = fmt.Sprintf("cid-%s-%d", write.Rkey, record.version)
+				results = append(results, map[string]string{"uri": "at://" + input.Repo + "/" + key, "cid": record.cid})
+			}
+		}
+		s.commits++
+		json.NewEncoder(w).Encode(map[string]any{
+			"commit":  map[string]string{"cid": fmt.Sprintf("commit-%d", s.commits), "rev": "rev"},
+			"results": results,
+		})
+
+	case "/xrpc/com.atproto.repo.listRecords":
+		var (
+			query  = r.URL.Query()
+			prefix = query.Get("collection") + "/"
+			keys   []string
+		)
+		for key := range s.records {
+			if strings.HasPrefix(key, prefix) && key > prefix+query.Get("cursor") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		res := map[string]any{"records": []any{}}
+		if len(keys) > limit {
+			keys = keys[:limit]
+			res["cursor"] = strings.TrimPrefix(keys[limit-1], prefix)
+		}
+		records := make([]any, 0, len(keys))
+		for _, key := range keys {
+			records = append(records, map[string]any{
+				"uri":   "at://" + query.Get("repo") + "/" + key,
+				"cid":   s.records[key].cid,
+				"value": s.records[key].value,
+			})
+		}
+		res["records"] = records
+		json.NewEncoder(w).Encode(res)
+
+	default:
+		fail(http.StatusNotImplemented, "MethodNotImplemented")
+	}
+}
+
+// testCustomRecord is a record of a custom lexicon, unknown to the server.
+type testCustomRecord struct {
+	Text  string `json:"text"`
+	Score int    `json:"score"`
+}
+
+// Tests that records of arbitrary types can be created, retrieved, listed,
+// replaced and deleted.
+func TestTypedRecords(t *testing.T) {
+	var (
+		ctx        = context.Background()
+		server     = newTestRepoServer()
+		client     = makeTestServerClient(t, server)
+		collection = "com.example.score"
+	)
+	// Create a batch of records and ensure they are typed and keyed by TIDs
+	var refs []*RecordRef
+	for i := 0; i < 5; i++ {
+		ref, err := CreateRecord(ctx, client, collection, &testCustomRecord{Text: fmt.Sprint(i), Score: i})
+		if err != nil {
+			t.Fatalf("failed to create record %d: %v", i, err)
+		}
+		refs = append(refs, ref)
+	}
+	_, _, rkey, _ := parseATURI(refs[0].URI)
+	if len(rkey) != 13 {
+		t.Errorf("record key mismatch: have %s, want TID", rkey)
+	}
+	var stored map[string]any
+	json.Unmarshal(server.records[collection+"/"+rkey].value, &stored)
+	if stored["$type"] != collection {
+		t.Errorf("record type mismatch: have %v, want %s", stored["$type"], collection)
+	}
+	// Retrieve a record and list all of them across multiple pages, passing the
+	// identifiers as parsed syntax types instead of plain strings
+	uri, err := syntax.ParseATURI(refs[2].URI)
+	if err != nil {
+		t.Fatalf("failed to parse record uri: %v", err)
+	}
+	record, err := GetRecord[testCustomRecord](ctx, client, uri)
+	if err != nil {
+		t.Fatalf("failed to get record: %v", err)
+	}
+	if record.CID != refs[2].CID || record.Value.Score != 2 {
+		t.Errorf("record mismatch: have %s/%+v, want %s/score 2", record.CID, record.Value, refs[2].CID)
+	}
+	var listed []*Record[testCustomRecord]
+	for record, err := range ListRecords[testCustomRecord](ctx, client, syntax.DID("did:plc:tester"), syntax.NSID(collection), WithPageSize(2)) {
+		if err != nil {
+			t.Fatalf("failed to list records: %v", err)
+		}
+		listed = append(listed, record)
+	}
+	if len(listed) != len(refs) {
+		t.Fatalf("listed records mismatch: have %d, want %d", len(listed), len(refs))
+	}
+	for i, record := range listed {
+		if record.URI != refs[i].URI || record.Value.Score != i {
+			t.Errorf("record %d mismatch: have %s/%+v, want %s", i, record.URI, record.Value, refs[i].URI)
+		}
+	}
+	// Replace a record conditionally, ensuring stale versions are rejected
+	ref, err := PutRecord(ctx, client, refs[2].URI, &testCustomRecord{Text: "updated", Score: 42}, WithSwapRecord(refs[2].CID))
+	if err != nil {
+		t.Fatalf("failed to put record: %v", err)
+	}
+	var conflict *ConflictError
+	if _, err := PutRecord(ctx, client, refs[2].URI, &testCustomRecord{Text: "stale"}, WithSwapRecord(refs[2].CID)); !errors.As(err, &conflict) {
+		t.Fatalf("stale put error mismatch: have %v, want conflict", err)
+	}
+	if record, err := GetRecord[testCustomRecord](ctx, client, refs[2].URI); err != nil || record.CID != ref.CID || record.Value.Score != 42 {
+		t.Errorf("updated record mismatch: have %+v/%v, want %s/score 42", record, err, ref.CID)
+	}
+	if _, err := PutRecord(ctx, client, "at://did:plc:other/"+collection+"/abc", &testCustomRecord{}); !errors.Is(err, ErrRecordNotOwned) {
+		t.Errorf("foreign put error mismatch: have %v, want %v", err, ErrRecordNotOwned)
+	}
+	// Delete the record and ensure it is gone
+	if err := client.DeleteRecord(ctx, refs[2].URI); err != nil {
+		t.Fatalf("failed to delete record: %v", err)
+	}
+	if _, err := GetRecord[testCustomRecord](ctx, client, refs[2].URI); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("deleted record error mismatch: have %v, want %v", err, ErrRecordNotFound)
+	}
+}
+
+// Tests that records are typed with their collection unless they declare their
+// own type, and that non-object records are rejected.
+func TestEncodeRecord(t *testing.T) {
+	tests := []struct {
+		record any
+		want   string
+		fail   bool
+	}{
+		{record: &testCustomRecord{Text: "a"}, want: "com.example.score"},
+		{record: map[string]any{"$type": "com.example.other"}, want: "com.example.other"},
+		{record: map[string]any{"$type": ""}, want: "com.example.score"},
+		{record: []int{1, 2, 3}, fail: true},
+		{record: "text", fail: true},
+	}
+	for i, tt := range tests {
+		blob, err := encodeRecord("com.example.score", tt.record)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: invalid record accepted", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: failed to encode record: %v", i, err)
+			continue
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(blob, &fields); err != nil {
+			t.Errorf("test %d: failed to decode record: %v", i, err)
+			continue
+		}
+		if fields["$type"] != tt.want {
+			t.Errorf("test %d: type mismatch: have %v, want %s", i, fields["$type"], tt.want)
+		}
+	}
+}
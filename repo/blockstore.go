@@ -0,0 +1,38 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"context"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// blockstore is a minimal in-memory block store, holding all the blocks of a
+// repository export for the tree and record lookups.
+type blockstore struct {
+	blocks map[string]blocks.Block // Blocks indexed by their binary content hash
+}
+
+// newBlockstore creates an empty in-memory block store.
+func newBlockstore() *blockstore {
+	return &blockstore{blocks: make(map[string]blocks.Block)}
+}
+
+// put inserts a block into the store. The content hash is assumed verified.
+func (bs *blockstore) put(block blocks.Block) {
+	bs.blocks[block.Cid().KeyString()] = block
+}
+
+// Get implements mst.MSTBlockSource, retrieving a block by its content hash.
+func (bs *blockstore) Get(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	block, ok := bs.blocks[c.KeyString()]
+	if !ok {
+		return nil, &ipld.ErrNotFound{Cid: c}
+	}
+	return block, nil
+}
@@ -0,0 +1,304 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package repo is an offline reader for Bluesky repositories exported as CAR
+// files (e.g. via bluesky.Client.ExportRepo), verifying their integrity and
+// authenticity and decoding the records within.
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sort"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	atrepo "github.com/bluesky-social/indigo/atproto/repo"
+	"github.com/bluesky-social/indigo/atproto/repo/mst"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+var (
+	// ErrBlockCorrupted is returned when reading a repository if the content of
+	// a block does not match its content hash.
+	ErrBlockCorrupted = errors.New("block content hash mismatch")
+
+	// ErrInvalidSignature is returned when verifying a repository if its commit
+	// was not signed by the given key.
+	ErrInvalidSignature = errors.New("invalid commit signature")
+
+	// ErrRecordNotFound is returned if a record is requested that the repository
+	// does not contain.
+	ErrRecordNotFound = errors.New("record not found")
+
+	// errStopped is an internal signal to abort walking the record tree when
+	// the iteration is stopped by the consumer.
+	errStopped = errors.New("iteration stopped")
+)
+
+// Repo is a fully loaded and structurally verified repository of a user.
+type Repo struct {
+	DID    string // DID of the user owning the repository
+	Rev    string // Revision of the repository at the exported commit
+	Commit string // Content hash of the exported commit
+
+	commit *atrepo.Commit // Signed commit at the root of the export
+	tree   *mst.Tree      // Merkle search tree indexing the records
+	blocks *blockstore    // All the blocks contained in the export
+}
+
+// Record is a single record from a repository, decoded into a specific type.
+type Record[T any] struct {
+	URI        string // AT-URI of the record (at://did/collection/rkey)
+	CID        string // Content hash of the record
+	Collection string // Collection the record is stored in
+	RecordKey  string // Key of the record within the collection
+
+	Value T // Decoded content of the record
+}
+
+// Read parses a repository from a CAR file, verifying the content hash of every
+// block and the structure of the commit and the Merkle search tree. The commit
+// signature is not checked, see Verify for that.
+//
+// Note, only full exports can be read, not the diffs of incremental backups, as
+// those lack the unchanged parts of the tree.
+func Read(r io.Reader) (*Repo, error) {
+	br := bufio.NewReader(r)
+
+	header, err := car.ReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if header.Version != 1 {
+		return nil, fmt.Errorf("unsupported CAR version: %d", header.Version)
+	}
+	if len(header.Roots) == 0 {
+		return nil, errors.New("CAR file missing root")
+	}
+	// Load all the blocks into memory, verifying each against its hash. The CAR
+	// reader would also verify them, but without a typed error to report.
+	store := newBlockstore()
+	for {
+		want, data, err := carutil.ReadNode(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		have, err := want.Prefix().Sum(data)
+		if err != nil {
+			return nil, err
+		}
+		if !have.Equals(want) {
+			return nil, fmt.Errorf("%w: have %s, want %s", ErrBlockCorrupted, have, want)
+		}
+		block, err := blocks.NewBlockWithCid(data, want)
+		if err != nil {
+			return nil, err
+		}
+		store.put(block)
+	}
+	// Decode the commit and load the tree of records from it
+	root, err := store.Get(context.Background(), header.Roots[0])
+	if err != nil {
+		return nil, fmt.Errorf("missing commit block: %w", err)
+	}
+	commit := new(atrepo.Commit)
+	if err := commit.UnmarshalCBOR(bytes.NewReader(root.RawData())); err != nil {
+		return nil, fmt.Errorf("invalid commit block: %w", err)
+	}
+	if err := commit.VerifyStructure(); err != nil {
+		return nil, fmt.Errorf("invalid commit block: %w", err)
+	}
+	tree, err := mst.LoadTreeFromStore(context.Background(), store, commit.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record tree: %w", err)
+	}
+	if err := tree.Verify(); err != nil {
+		return nil, fmt.Errorf("invalid record tree: %w", err)
+	}
+	return &Repo{
+		DID:    commit.DID,
+		Rev:    commit.Rev,
+		Commit: root.Cid().String(),
+		commit: commit,
+		tree:   tree,
+		blocks: store,
+	}, nil
+}
+
+// Verify checks that the repository's commit was signed by the given key, which
+// is the signing key from the user's DID document, either in multibase encoding
+// (publicKeyMultibase) or as a did:key.
+func (r *Repo) Verify(key string) error {
+	var (
+		pubkey crypto.PublicKey
+		err    error
+	)
+	if strings.HasPrefix(key, "did:key:") {
+		pubkey, err = crypto.ParsePublicDIDKey(key)
+	} else {
+		pubkey, err = crypto.ParsePublicMultibase(key)
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.commit.VerifySignature(pubkey); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// Collections returns the names of all the collections that have records in the
+// repository, sorted alphabetically.
+func (r *Repo) Collections() ([]string, error) {
+	seen := make(map[string]struct{})
+	err := r.tree.Walk(func(key []byte, _ cid.Cid) error {
+		if collection, _, ok := strings.Cut(string(key), "/"); ok {
+			seen[collection] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	collections := make([]string, 0, len(seen))
+	for collection := range seen {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	return collections, nil
+}
+
+// Records returns an iterator over all the records in a collection (or in the
+// entire repository if empty), decoded into their lexicon types if known to the
+// library (e.g. *bsky.FeedPost), or into a *Unknown record otherwise.
+func (r *Repo) Records(collection string) iter.Seq2[*Record[lexutil.CBOR], error] {
+	return records(r, collection, func(blob []byte) (lexutil.CBOR, error) {
+		record, err := lexutil.CborDecodeValue(blob)
+		if err != nil {
+			return &Unknown{Data: blob}, nil
+		}
+		return record, nil
+	})
+}
+
+// Unknown is a record of a lexicon type not known to the library, left in its
+// raw DAG-CBOR encoding.
+type Unknown struct {
+	Data []byte // DAG-CBOR encoding of the record
+}
+
+// MarshalCBOR implements the lexutil.CBOR interface.
+func (u *Unknown) MarshalCBOR(w io.Writer) error {
+	_, err := w.Write(u.Data)
+	return err
+}
+
+// UnmarshalCBOR implements the lexutil.CBOR interface.
+func (u *Unknown) UnmarshalCBOR(r io.Reader) error {
+	blob, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	u.Data = blob
+	return nil
+}
+
+// Posts returns an iterator over all the posts in the repository.
+func (r *Repo) Posts() iter.Seq2[*Record[*bsky.FeedPost], error] {
+	return typedRecords[bsky.FeedPost](r, "app.bsky.feed.post")
+}
+
+// Likes returns an iterator over all the likes in the repository.
+func (r *Repo) Likes() iter.Seq2[*Record[*bsky.FeedLike], error] {
+	return typedRecords[bsky.FeedLike](r, "app.bsky.feed.like")
+}
+
+// Reposts returns an iterator over all the reposts in the repository.
+func (r *Repo) Reposts() iter.Seq2[*Record[*bsky.FeedRepost], error] {
+	return typedRecords[bsky.FeedRepost](r, "app.bsky.feed.repost")
+}
+
+// Follows returns an iterator over all the follows in the repository.
+func (r *Repo) Follows() iter.Seq2[*Record[*bsky.GraphFollow], error] {
+	return typedRecords[bsky.GraphFollow](r, "app.bsky.graph.follow")
+}
+
+// Profile returns the profile record of the repository.
+func (r *Repo) Profile() (*Record[*bsky.ActorProfile], error) {
+	for record, err := range typedRecords[bsky.ActorProfile](r, "app.bsky.actor.profile") {
+		if err != nil {
+			return nil, err
+		}
+		if record.RecordKey == "self" {
+			return record, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: app.bsky.actor.profile/self", ErrRecordNotFound)
+}
+
+// typedRecords returns an iterator over all the records in a collection, decoded
+// into a specific lexicon type.
+func typedRecords[T any, P interface {
+	*T
+	cbg.CBORUnmarshaler
+}](r *Repo, collection string) iter.Seq2[*Record[P], error] {
+	return records(r, collection, func(blob []byte) (P, error) {
+		record := P(new(T))
+		if err := record.UnmarshalCBOR(bytes.NewReader(blob)); err != nil {
+			return nil, err
+		}
+		return record, nil
+	})
+}
+
+// records returns an iterator over all the records in a collection (or in the
+// entire repository if empty), decoded by the given function.
+func records[T any](r *Repo, collection string, decode func(blob []byte) (T, error)) iter.Seq2[*Record[T], error] {
+	return func(yield func(*Record[T], error) bool) {
+		err := r.tree.Walk(func(key []byte, val cid.Cid) error {
+			path := string(key)
+			if collection != "" && !strings.HasPrefix(path, collection+"/") {
+				return nil
+			}
+			block, err := r.blocks.Get(context.Background(), val)
+			if err != nil {
+				return fmt.Errorf("missing record %s: %w", path, err)
+			}
+			value, err := decode(block.RawData())
+			if err != nil {
+				return fmt.Errorf("invalid record %s: %w", path, err)
+			}
+			collection, rkey, _ := strings.Cut(path, "/")
+			record := &Record[T]{
+				URI:        "at://" + r.DID + "/" + path,
+				CID:        val.String(),
+				Collection: collection,
+				RecordKey:  rkey,
+				Value:      value,
+			}
+			if !yield(record, nil) {
+				return errStopped
+			}
+			return nil
+		})
+		if err != nil && err != errStopped {
+			yield(nil, err)
+		}
+	}
+}
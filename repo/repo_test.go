@@ -0,0 +1,211 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	atrepo "github.com/bluesky-social/indigo/atproto/repo"
+	"github.com/bluesky-social/indigo/atproto/repo/mst"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipfsbs "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/multiformats/go-multihash"
+)
+
+// testRepoDID is the owner of the repositories assembled by the tests.
+const testRepoDID = "did:plc:ewvi7nxzyoun6zhxrhs64oiz"
+
+// makeTestRepo assembles a signed repository export from a set of records,
+// returning the CAR file and the signing key. If corrupt is set, the content
+// of the given record is tampered with in the export.
+func makeTestRepo(t *testing.T, records map[string]lexutil.CBOR, corrupt string) ([]byte, crypto.PrivateKey) {
+	t.Helper()
+
+	var (
+		tree   = mst.NewEmptyTree()
+		blocks = make(map[cid.Cid][]byte)
+		order  []cid.Cid
+		prefix = cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256)
+	)
+	store := func(data []byte) cid.Cid {
+		c, err := prefix.Sum(data)
+		if err != nil {
+			t.Fatalf("failed to hash block: %v", err)
+		}
+		if _, ok := blocks[c]; !ok {
+			order = append(order, c)
+		}
+		blocks[c] = data
+		return c
+	}
+	// Store the records and index them in the tree
+	tampered := cid.Undef
+	for path, record := range records {
+		var buf bytes.Buffer
+		if err := record.MarshalCBOR(&buf); err != nil {
+			t.Fatalf("failed to encode record %s: %v", path, err)
+		}
+		c := store(buf.Bytes())
+		if path == corrupt {
+			tampered = c
+		}
+		if _, err := tree.Insert([]byte(path), c); err != nil {
+			t.Fatalf("failed to index record %s: %v", path, err)
+		}
+	}
+	nodes := ipfsbs.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	root, err := tree.WriteDiffBlocks(context.Background(), nodes)
+	if err != nil {
+		t.Fatalf("failed to encode tree: %v", err)
+	}
+	keys, err := nodes.AllKeysChan(context.Background())
+	if err != nil {
+		t.Fatalf("failed to iterate tree blocks: %v", err)
+	}
+	for c := range keys {
+		block, err := nodes.Get(context.Background(), c)
+		if err != nil {
+			t.Fatalf("failed to retrieve tree block: %v", err)
+		}
+		store(block.RawData())
+	}
+	// Sign a commit over the tree and export everything
+	key, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	commit := &atrepo.Commit{
+		DID:     testRepoDID,
+		Version: atrepo.ATPROTO_REPO_VERSION,
+		Data:    *root,
+		Rev:     syntax.NewTIDNow(0).String(),
+	}
+	if err := commit.Sign(key); err != nil {
+		t.Fatalf("failed to sign commit: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := commit.MarshalCBOR(&buf); err != nil {
+		t.Fatalf("failed to encode commit: %v", err)
+	}
+	head := store(buf.Bytes())
+
+	var out bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{head}, Version: 1}, &out); err != nil {
+		t.Fatalf("failed to write CAR header: %v", err)
+	}
+	for _, c := range order {
+		data := blocks[c]
+		if c == tampered {
+			data = append(bytes.Clone(data[:len(data)-1]), data[len(data)-1]^0xff)
+		}
+		if err := carutil.LdWrite(&out, c.Bytes(), data); err != nil {
+			t.Fatalf("failed to write CAR block: %v", err)
+		}
+	}
+	return out.Bytes(), key
+}
+
+// testRecords is the content of the repository assembled by the tests.
+var testRecords = map[string]lexutil.CBOR{
+	"app.bsky.actor.profile/self":         &bsky.ActorProfile{LexiconTypeID: "app.bsky.actor.profile", DisplayName: ptr("Tester")},
+	"app.bsky.feed.post/3kabcdefghij2":    &bsky.FeedPost{LexiconTypeID: "app.bsky.feed.post", Text: "first", CreatedAt: "2024-01-01T00:00:00Z"},
+	"app.bsky.feed.post/3kabcdefghij3":    &bsky.FeedPost{LexiconTypeID: "app.bsky.feed.post", Text: "second", CreatedAt: "2024-01-02T00:00:00Z"},
+	"app.bsky.feed.like/3kabcdefghij4":    &bsky.FeedLike{LexiconTypeID: "app.bsky.feed.like", CreatedAt: "2024-01-03T00:00:00Z"},
+	"app.bsky.graph.follow/3kabcdefghij5": &bsky.GraphFollow{LexiconTypeID: "app.bsky.graph.follow", Subject: "did:plc:other", CreatedAt: "2024-01-04T00:00:00Z"},
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// Tests that a repository export can be read, verified and its records decoded.
+func TestRead(t *testing.T) {
+	export, key := makeTestRepo(t, testRecords, "")
+
+	repo, err := Read(bytes.NewReader(export))
+	if err != nil {
+		t.Fatalf("failed to read repo: %v", err)
+	}
+	if repo.DID != testRepoDID {
+		t.Errorf("owner mismatch: have %s, want %s", repo.DID, testRepoDID)
+	}
+	// Verify the commit signature against the right and a wrong key
+	pub, _ := key.PublicKey()
+	if err := repo.Verify(pub.Multibase()); err != nil {
+		t.Errorf("failed to verify multibase key: %v", err)
+	}
+	if err := repo.Verify(pub.DIDKey()); err != nil {
+		t.Errorf("failed to verify did:key: %v", err)
+	}
+	other, _ := crypto.GeneratePrivateKeyK256()
+	otherPub, _ := other.PublicKey()
+	if err := repo.Verify(otherPub.DIDKey()); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("foreign key error mismatch: have %v, want %v", err, ErrInvalidSignature)
+	}
+	// Iterate the records, both typed and untyped
+	collections, err := repo.Collections()
+	if err != nil {
+		t.Fatalf("failed to list collections: %v", err)
+	}
+	if len(collections) != 4 || collections[0] != "app.bsky.actor.profile" {
+		t.Errorf("collections mismatch: have %v", collections)
+	}
+	var texts []string
+	for post, err := range repo.Posts() {
+		if err != nil {
+			t.Fatalf("failed to iterate posts: %v", err)
+		}
+		texts = append(texts, post.Value.Text)
+	}
+	if len(texts) != 2 || texts[0] != "first" || texts[1] != "second" {
+		t.Errorf("posts mismatch: have %v", texts)
+	}
+	for follow, err := range repo.Follows() {
+		if err != nil || follow.Value.Subject != "did:plc:other" || follow.URI != "at://"+testRepoDID+"/app.bsky.graph.follow/3kabcdefghij5" {
+			t.Errorf("follow mismatch: have %+v/%v", follow, err)
+		}
+	}
+	profile, err := repo.Profile()
+	if err != nil || *profile.Value.DisplayName != "Tester" {
+		t.Errorf("profile mismatch: have %+v/%v", profile, err)
+	}
+	var count int
+	for record, err := range repo.Records("") {
+		if err != nil {
+			t.Fatalf("failed to iterate records: %v", err)
+		}
+		if _, ok := record.Value.(*Unknown); ok {
+			t.Errorf("record %s not decoded", record.URI)
+		}
+		count++
+	}
+	if count != len(testRecords) {
+		t.Errorf("record count mismatch: have %d, want %d", count, len(testRecords))
+	}
+	for range repo.Records("") {
+		break // ensure early termination does not panic
+	}
+}
+
+// Tests that tampered repository exports are rejected.
+func TestReadCorrupted(t *testing.T) {
+	export, _ := makeTestRepo(t, testRecords, "app.bsky.feed.post/3kabcdefghij3")
+	if _, err := Read(bytes.NewReader(export)); !errors.Is(err, ErrBlockCorrupted) {
+		t.Errorf("corrupted export error mismatch: have %v, want %v", err, ErrBlockCorrupted)
+	}
+	export, _ = makeTestRepo(t, testRecords, "")
+	if _, err := Read(bytes.NewReader(export[:len(export)-10])); err == nil {
+		t.Errorf("truncated export accepted")
+	}
+}
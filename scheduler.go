@@ -0,0 +1,340 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+const (
+	// defaultScheduleMaxAttempts is the number of times to try publishing a post
+	// if the scheduler config does not specify it.
+	defaultScheduleMaxAttempts = 5
+
+	// defaultScheduleRetryBackoff is the delay before the first retry of a failed
+	// post if the scheduler config does not specify it. Subsequent retries double
+	// the delay, up to scheduleMaxRetryBackoff.
+	defaultScheduleRetryBackoff = 30 * time.Second
+
+	// scheduleMaxRetryBackoff is the maximum delay between two retries of a post.
+	scheduleMaxRetryBackoff = time.Hour
+)
+
+// ErrOutboxItemNotFound is returned if an operation targets a queued post that
+// the scheduler does not know about (or is no longer pending).
+var ErrOutboxItemNotFound = errors.New("outbox item not found")
+
+// SchedulerConfig is the set of options to configure a post scheduler with.
+type SchedulerConfig struct {
+	Store        OutboxStore   // Durable storage for the queued posts (required)
+	MaxAttempts  int           // Number of publishing attempts before giving up (0 = default)
+	RetryBackoff time.Duration // Delay before the first retry, doubled for each further one (0 = default)
+
+	OnPublished func(item *OutboxItem) // Hook invoked when a post is published, nil to ignore
+	OnFailed    func(item *OutboxItem) // Hook invoked when a post permanently fails, nil to ignore
+}
+
+// Scheduler is a durable outbox of posts to be published at specific times.
+// Posts are persisted before being accepted and their progress is tracked, so a
+// restart will neither lose nor double-publish them.
+type Scheduler struct {
+	client *Client          // API client to publish the posts through
+	config *SchedulerConfig // Scheduler options with the defaults filled in
+
+	lock   sync.Mutex             // Lock protecting the items and serializing store access
+	items  map[string]*OutboxItem // Items in the outbox, indexed by ID
+	active string                 // ID of the item being published right now
+	wake   chan struct{}          // Notification channel for newly scheduled posts
+}
+
+// NewScheduler creates a post scheduler on top of an API client, loading any
+// previously queued posts from the store.
+func NewScheduler(client *Client, config SchedulerConfig) (*Scheduler, error) {
+	if config.Store == nil {
+		return nil, errors.New("scheduler store not configured")
+	}
+	// Fill in any defaults the user did not specify
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultScheduleMaxAttempts
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultScheduleRetryBackoff
+	}
+	items, err := config.Store.Load()
+	if err != nil {
+		return nil, err
+	}
+	scheduler := &Scheduler{
+		client: client,
+		config: &config,
+		items:  make(map[string]*OutboxItem),
+		wake:   make(chan struct{}, 1),
+	}
+	for _, item := range items {
+		scheduler.items[item.ID] = item
+	}
+	return scheduler, nil
+}
+
+// Schedule queues a post to be published at a specific time (or as soon as
+// possible if zero). The post is durably stored by the time the method returns.
+func (s *Scheduler) Schedule(draft *PostDraft, at time.Time) (*OutboxItem, error) {
+	if len(draft.Images) > maxImagesPerPost {
+		return nil, fmt.Errorf("too many images: have %d, max %d", len(draft.Images), maxImagesPerPost)
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	item := &OutboxItem{
+		ID:        syntax.NextTID().String(),
+		Draft:     draft,
+		PublishAt: at,
+		Status:    OutboxPending,
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.config.Store.Save(item); err != nil {
+		return nil, err
+	}
+	s.items[item.ID] = item
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	dup := *item
+	return &dup, nil
+}
+
+// Cancel removes a pending post from the outbox. Posts already published or
+// being published right now cannot be cancelled.
+func (s *Scheduler) Cancel(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	item, ok := s.items[id]
+	if !ok || item.Status != OutboxPending || s.active == id {
+		return fmt.Errorf("%w: %s", ErrOutboxItemNotFound, id)
+	}
+	if err := s.config.Store.Delete(id); err != nil {
+		return err
+	}
+	delete(s.items, id)
+	return nil
+}
+
+// Items returns a snapshot of all the posts in the outbox, in any order.
+func (s *Scheduler) Items() []*OutboxItem {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	items := make([]*OutboxItem, 0, len(s.items))
+	for _, item := range s.items {
+		dup := *item
+		items = append(items, &dup)
+	}
+	return items
+}
+
+// Run publishes the queued posts as they become due, until the context is
+// cancelled. Failures to persist the outbox abort the run, publishing failures
+// are retried or recorded on the items.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		next, err := s.dispatch(ctx)
+		if err != nil {
+			return err
+		}
+		// Wait until the next post is due or a new one is scheduled
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch publishes all the posts that are due, returning the time when the
+// next one becomes due (zero if nothing is pending).
+func (s *Scheduler) dispatch(ctx context.Context) (time.Time, error) {
+	for {
+		// Find the first due post, or the time of the next one if none is due
+		var (
+			now  = time.Now()
+			item *OutboxItem
+			next time.Time
+		)
+		s.lock.Lock()
+		for _, candidate := range s.items {
+			if candidate.Status != OutboxPending {
+				continue
+			}
+			due := candidate.PublishAt
+			if candidate.NextAttempt.After(due) {
+				due = candidate.NextAttempt
+			}
+			if !due.After(now) && (item == nil || candidate.ID < item.ID) {
+				item = candidate
+			}
+			if next.IsZero() || due.Before(next) {
+				next = due
+			}
+		}
+		if item != nil {
+			s.active = item.ID
+		}
+		s.lock.Unlock()
+
+		if item == nil {
+			return next, nil
+		}
+		err := s.publish(ctx, item)
+
+		s.lock.Lock()
+		s.active = ""
+		s.lock.Unlock()
+
+		if err != nil {
+			return time.Time{}, err
+		}
+		if err := ctx.Err(); err != nil {
+			return time.Time{}, err
+		}
+	}
+}
+
+// publish makes a publishing attempt for a queued post. The returned error is
+// only set if the outbox could not be persisted, publishing failures are tracked
+// on the item itself.
+func (s *Scheduler) publish(ctx context.Context, item *OutboxItem) error {
+	// Reserve a record key and record the attempt before touching the network,
+	// so that a crash mid-flight can be detected and resolved on restart
+	err := s.update(item, func(item *OutboxItem) {
+		if item.RecordKey == "" {
+			item.RecordKey = syntax.NextTID().String()
+		}
+		item.Attempts++
+	})
+	if err != nil {
+		return err
+	}
+	// If a previous attempt was made, it might have succeeded without us knowing,
+	// so check whether the post already exists before publishing it again
+	var ref *RecordRef
+	if item.Attempts > 1 {
+		did, err := s.client.userDID()
+		if err != nil {
+			return s.fail(item, err)
+		}
+		ref, err = s.client.fetchRecordRef(ctx, "at://"+did+"/app.bsky.feed.post/"+item.RecordKey)
+		if err != nil && !isRecordNotFound(err) {
+			return s.fail(item, err)
+		}
+	}
+	if ref == nil {
+		if ref, err = s.client.publish(ctx, item.Draft, item.RecordKey); err != nil {
+			if ctx.Err() != nil {
+				return nil // shutting down, retry on the next run
+			}
+			return s.fail(item, err)
+		}
+	}
+	err = s.update(item, func(item *OutboxItem) {
+		item.Status = OutboxPublished
+		item.Published = ref
+		item.PublishedAt = time.Now()
+		item.NextAttempt = time.Time{}
+		item.LastError = ""
+	})
+	if err != nil {
+		return err
+	}
+	if s.config.OnPublished != nil {
+		s.config.OnPublished(item)
+	}
+	return nil
+}
+
+// fail records a failed publishing attempt, scheduling a retry if the failure is
+// transient and attempts remain, or marking the post failed otherwise.
+func (s *Scheduler) fail(item *OutboxItem, failure error) error {
+	var (
+		transient = isTransient(failure)
+		failed    bool
+	)
+	err := s.update(item, func(item *OutboxItem) {
+		item.LastError = failure.Error()
+		if !transient || item.Attempts >= s.config.MaxAttempts {
+			item.Status = OutboxFailed
+			failed = true
+			return
+		}
+		item.NextAttempt = time.Now().Add(retryBackoff(failure, s.config.RetryBackoff, item.Attempts))
+	})
+	if err != nil {
+		return err
+	}
+	if failed && s.config.OnFailed != nil {
+		s.config.OnFailed(item)
+	}
+	return nil
+}
+
+// update modifies an item under the scheduler lock and persists it.
+func (s *Scheduler) update(item *OutboxItem, modify func(item *OutboxItem)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	modify(item)
+	return s.config.Store.Save(item)
+}
+
+// isTransient returns whether a publishing failure might succeed if retried.
+// Network errors, rate limits and server errors are transient, everything else
+// (e.g. invalid posts) is permanent.
+func isTransient(err error) bool {
+	var xerr *xrpc.Error
+	if !errors.As(err, &xerr) {
+		return true
+	}
+	return xerr.IsThrottled() || xerr.StatusCode >= 500
+}
+
+// retryBackoff calculates the delay before retrying a failed attempt. If the
+// server reported when its rate limit resets, that is used, otherwise the base
+// delay is doubled for every attempt made.
+func retryBackoff(err error, base time.Duration, attempts int) time.Duration {
+	var xerr *xrpc.Error
+	if errors.As(err, &xerr) && xerr.IsThrottled() && xerr.Ratelimit != nil && !xerr.Ratelimit.Reset.IsZero() {
+		return max(time.Until(xerr.Ratelimit.Reset), time.Second)
+	}
+	delay := base
+	for i := 1; i < attempts && delay < scheduleMaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, scheduleMaxRetryBackoff)
+}
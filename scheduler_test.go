@@ -0,0 +1,194 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// Tests that the file outbox persists items across reloads.
+func TestFileOutbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+
+	store := NewFileOutbox(path)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Save(&OutboxItem{ID: id, Draft: &PostDraft{Text: id}, Status: OutboxPending}); err != nil {
+			t.Fatalf("failed to save item %s: %v", id, err)
+		}
+	}
+	if err := store.Save(&OutboxItem{ID: "b", Draft: &PostDraft{Text: "b"}, Status: OutboxPublished}); err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+	if err := store.Delete("c"); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	items, err := NewFileOutbox(path).Load()
+	if err != nil {
+		t.Fatalf("failed to reload outbox: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("item count mismatch: have %d, want %d", len(items), 2)
+	}
+	for _, item := range items {
+		switch item.ID {
+		case "a":
+			if item.Status != OutboxPending || item.Draft.Text != "a" {
+				t.Errorf("item a mismatch: have %+v", item)
+			}
+		case "b":
+			if item.Status != OutboxPublished {
+				t.Errorf("item b status mismatch: have %s, want %s", item.Status, OutboxPublished)
+			}
+		default:
+			t.Errorf("unexpected item: %s", item.ID)
+		}
+	}
+}
+
+// Tests that scheduled posts are published when due, transient failures retried
+// and that the outbox survives restarts.
+func TestSchedulerPublish(t *testing.T) {
+	var (
+		server = newTestRepoServer()
+		client = makeTestServerClient(t, server)
+		path   = filepath.Join(t.TempDir(), "outbox.json")
+	)
+	server.fails = 1
+
+	published := make(chan *OutboxItem, 2)
+	scheduler, err := NewScheduler(client, SchedulerConfig{
+		Store:        NewFileOutbox(path),
+		RetryBackoff: 10 * time.Millisecond,
+		OnPublished:  func(item *OutboxItem) { published <- item },
+	})
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+	first, err := scheduler.Schedule(&PostDraft{Text: "first"}, time.Time{})
+	if err != nil {
+		t.Fatalf("failed to schedule post: %v", err)
+	}
+	second, err := scheduler.Schedule(&PostDraft{Text: "second"}, time.Now().Add(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to schedule post: %v", err)
+	}
+	later, err := scheduler.Schedule(&PostDraft{Text: "later"}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to schedule post: %v", err)
+	}
+	if err := scheduler.Cancel(later.ID); err != nil {
+		t.Fatalf("failed to cancel post: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- scheduler.Run(ctx) }()
+
+	for _, want := range []*OutboxItem{first, second} {
+		select {
+		case item := <-published:
+			if item.ID != want.ID {
+				t.Errorf("publish order mismatch: have %s, want %s", item.ID, want.ID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("post %s not published", want.ID)
+		}
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("scheduler run failed: %v", err)
+	}
+	// Ensure the outcomes are persisted, including the retry of the first post
+	scheduler, err = NewScheduler(client, SchedulerConfig{Store: NewFileOutbox(path)})
+	if err != nil {
+		t.Fatalf("failed to reload scheduler: %v", err)
+	}
+	items := scheduler.Items()
+	if len(items) != 2 {
+		t.Fatalf("item count mismatch: have %d, want %d", len(items), 2)
+	}
+	for _, item := range items {
+		if item.Status != OutboxPublished || item.Published == nil {
+			t.Errorf("item %s not published: %+v", item.ID, item)
+		}
+		if want := "at://did:plc:tester/app.bsky.feed.post/" + item.RecordKey; item.Published.URI != want {
+			t.Errorf("item %s URI mismatch: have %s, want %s", item.ID, item.Published.URI, want)
+		}
+		if item.ID == first.ID && item.Attempts != 2 {
+			t.Errorf("retried item attempts mismatch: have %d, want %d", item.Attempts, 2)
+		}
+	}
+	if server.creates != 3 {
+		t.Errorf("record creation count mismatch: have %d, want %d", server.creates, 3)
+	}
+}
+
+// Tests that a post whose publishing was interrupted after the record was made
+// is not published a second time on restart.
+func TestSchedulerNoDoublePublish(t *testing.T) {
+	var (
+		server = newTestRepoServer()
+		client = makeTestServerClient(t, server)
+		store  = NewFileOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+	)
+	// Simulate a crash right after the record was created on the server
+	server.records["app.bsky.feed.post/3jzfcijpj2z2a"] = &testRepoRecord{value: json.RawMessage(`{}`), cid: "cid"}
+	store.Save(&OutboxItem{
+		ID:        "3jzfcijpj2z2a",
+		Draft:     &PostDraft{Text: "crashed"},
+		PublishAt: time.Now().Add(-time.Minute),
+		Status:    OutboxPending,
+		RecordKey: "3jzfcijpj2z2a",
+		Attempts:  1,
+	})
+	scheduler, err := NewScheduler(client, SchedulerConfig{Store: store})
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+	if _, err := scheduler.dispatch(context.Background()); err != nil {
+		t.Fatalf("failed to dispatch posts: %v", err)
+	}
+	items := scheduler.Items()
+	if len(items) != 1 || items[0].Status != OutboxPublished {
+		t.Fatalf("interrupted post not resolved: %+v", items[0])
+	}
+	if server.creates != 0 {
+		t.Errorf("interrupted post published again")
+	}
+}
+
+// Tests that publishing failures are classified and backed off correctly.
+func TestSchedulerRetryPolicy(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{errors.New("connection reset"), true},
+		{&xrpc.Error{StatusCode: http.StatusBadGateway}, true},
+		{&xrpc.Error{StatusCode: http.StatusTooManyRequests}, true},
+		{&xrpc.Error{StatusCode: http.StatusBadRequest}, false},
+	}
+	for i, tt := range tests {
+		if transient := isTransient(tt.err); transient != tt.transient {
+			t.Errorf("test %d: transience mismatch: have %v, want %v", i, transient, tt.transient)
+		}
+	}
+	failure := errors.New("connection reset")
+	for attempts, want := range []time.Duration{time.Minute, time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		if delay := retryBackoff(failure, time.Minute, attempts); delay != want {
+			t.Errorf("attempt %d: backoff mismatch: have %v, want %v", attempts, delay, want)
+		}
+	}
+	if delay := retryBackoff(failure, time.Minute, 100); delay != scheduleMaxRetryBackoff {
+		t.Errorf("backoff cap mismatch: have %v, want %v", delay, scheduleMaxRetryBackoff)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/karalabe/go-bluesky/syntax"
+)
+
+// SearchSort defines the ranking order of search results.
+type SearchSort string
+
+const (
+	SearchSortTop    SearchSort = "top"    // Rank the results by relevance and engagement
+	SearchSortLatest SearchSort = "latest" // Rank the results by recency
+)
+
+// PostSearch is the set of filters to search posts by. Only the query is mandatory,
+// all the other fields narrow down the results if set.
+type PostSearch struct {
+	Query    string     // Search query, supporting Lucene syntax
+	Author   string     // Restrict to posts by a specific user (handle or DID)
+	Mentions string     // Restrict to posts mentioning a specific user (handle or DID)
+	Lang     string     // Restrict to posts in a specific language
+	Domain   string     // Restrict to posts linking to a specific domain
+	URL      string     // Restrict to posts linking to a specific URL
+	Tags     []string   // Restrict to posts with all the given hashtags (without #)
+	Since    time.Time  // Restrict to posts created after this time (inclusive)
+	Until    time.Time  // Restrict to posts created before this time (exclusive)
+	Sort     SearchSort // Ranking order of the results, server default if empty
+}
+
+// SearchPosts returns an iterator over the posts matching a search, retrieving
+// them page by page as the iteration progresses.
+//
+// Note, the server might not allow paginating through all the hits of a broad
+// query, so consider narrowing it down or capping the results via WithMaxItems.
+func (c *Client) SearchPosts(ctx context.Context, search *PostSearch, opts ...PageOption) iter.Seq2[*Post, error] {
+	for _, user := range []string{search.Author, search.Mentions} {
+		if user == "" {
+			continue
+		}
+		if _, err := syntax.ParseAtIdentifier(user); err != nil {
+			return iterate(ctx, failedFetcher[*Post](err), opts)
+		}
+	}
+	return iterate(ctx, func(ctx context.Context, cursor string, limit int) ([]*Post, string, error) {
+		return c.searchPosts(ctx, search, cursor, limit)
+	}, opts)
+}
+
+// searchPosts retrieves a single page of posts matching a search.
+func (c *Client) searchPosts(ctx context.Context, search *PostSearch, cursor string, limit int) ([]*Post, string, error) {
+	// Assemble only the filters actually set, the server rejects empty ones
+	params := map[string]interface{}{
+		"q":     search.Query,
+		"limit": min(limit, 100),
+	}
+	for name, value := range map[string]string{
+		"cursor":   cursor,
+		"author":   search.Author,
+		"mentions": search.Mentions,
+		"lang":     search.Lang,
+		"domain":   search.Domain,
+		"url":      search.URL,
+		"sort":     string(search.Sort),
+	} {
+		if value != "" {
+			params[name] = value
+		}
+	}
+	if len(search.Tags) > 0 {
+		params["tag"] = search.Tags
+	}
+	if !search.Since.IsZero() {
+		params["since"] = search.Since.UTC().Format(time.RFC3339Nano)
+	}
+	if !search.Until.IsZero() {
+		params["until"] = search.Until.UTC().Format(time.RFC3339Nano)
+	}
+	var res bsky.FeedSearchPosts_Output
+	if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.feed.searchPosts", params, nil, &res); err != nil {
+		return nil, "", err
+	}
+	// Parse the posts and drop pointless pointers
+	posts := make([]*Post, 0, len(res.Posts))
+	for _, post := range res.Posts {
+		posts = append(posts, newPostFromView(c, post))
+	}
+	if res.Cursor == nil {
+		return posts, "", nil
+	}
+	return posts, *res.Cursor, nil
+}
+
+// SearchActors returns an iterator over the users matching a search query (e.g.
+// handle, display name or bio), retrieving them page by page as the iteration
+// progresses.
+func (c *Client) SearchActors(ctx context.Context, query string, opts ...PageOption) iter.Seq2[*User, error] {
+	return iterate(ctx, func(ctx context.Context, cursor string, limit int) ([]*User, string, error) {
+		res, err := bsky.ActorSearchActors(ctx, c.client, cursor, int64(min(limit, 100)), query, "")
+		if err != nil {
+			return nil, "", err
+		}
+		// Parse the users and drop pointless pointers
+		users := make([]*User, 0, len(res.Actors))
+		for _, actor := range res.Actors {
+			users = append(users, newUserFromView(c, actor))
+		}
+		if res.Cursor == nil {
+			return users, "", nil
+		}
+		return users, *res.Cursor, nil
+	}, opts)
+}
+
+// SearchActorsTypeahead retrieves the users best matching a search prefix, meant
+// for auto-completion as the user types. The limit caps the number of results
+// (0 = default of 10), up to a maximum of 100.
+func (c *Client) SearchActorsTypeahead(ctx context.Context, prefix string, limit int) ([]*User, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	res, err := bsky.ActorSearchActorsTypeahead(ctx, c.client, int64(min(limit, 100)), prefix, "")
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*User, 0, len(res.Actors))
+	for _, actor := range res.Actors {
+		users = append(users, newUserFromBasicView(c, actor))
+	}
+	return users, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Tests that posts can be searched for with filters.
+func TestSearchPosts(t *testing.T) {
+	client := makeTestClientWithLogin(t)
+
+	var found int
+	search := &PostSearch{
+		Query: "bluesky",
+		Lang:  "en",
+		Since: time.Now().Add(-30 * 24 * time.Hour),
+		Sort:  SearchSortLatest,
+	}
+	for post, err := range client.SearchPosts(context.Background(), search, WithPageSize(25), WithMaxItems(50)) {
+		if err != nil {
+			t.Fatalf("failed to search posts: %v", err)
+		}
+		if post.CreatedAt.Before(search.Since.Add(-time.Hour)) {
+			t.Errorf("post %s older than filter: %v", post.URI, post.CreatedAt)
+		}
+		found++
+	}
+	if found == 0 || found > 50 {
+		t.Errorf("search result count mismatch: have %d, want (0, 50]", found)
+	}
+}
+
+// Tests that users can be searched for, both fully and via typeahead.
+func TestSearchActors(t *testing.T) {
+	client := makeTestClientWithLogin(t)
+
+	var found bool
+	for user, err := range client.SearchActors(context.Background(), testHandleTester, WithMaxItems(25)) {
+		if err != nil {
+			t.Fatalf("failed to search actors: %v", err)
+		}
+		if user.DID == testDIDTester {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("tester not found in search results")
+	}
+	users, err := client.SearchActorsTypeahead(context.Background(), testHandleTester, 5)
+	if err != nil {
+		t.Fatalf("failed to search actors typeahead: %v", err)
+	}
+	if len(users) == 0 || len(users) > 5 {
+		t.Errorf("typeahead result count mismatch: have %d, want (0, 5]", len(users))
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// maxProfilesPerCall is the maximum number of actors the server will accept in
+// a single batch profile query.
+const maxProfilesPerCall = 25
+
+// SnapshotKind defines which social graph edges a snapshot captured.
+type SnapshotKind string
+
+const (
+	SnapshotFollowers SnapshotKind = "followers" // Snapshot of the users following someone
+	SnapshotFollowees SnapshotKind = "followees" // Snapshot of the users followed by someone
+)
+
+// FollowerSnapshot is a point-in-time capture of the followers or followees of
+// a user, used to track the changes in the social graph over time.
+type FollowerSnapshot struct {
+	client *Client          // Embedded API client to lazy-load user metadata
+	users  map[string]*User // User metadata if the snapshot was crawled (not loaded)
+
+	DID   string       `json:"did"`   // User whose social graph edges were captured
+	Kind  SnapshotKind `json:"kind"`  // Social graph edges that were captured
+	Taken time.Time    `json:"taken"` // Time when the snapshot was taken
+	Users []string     `json:"users"` // Sorted DIDs of the users in the snapshot
+}
+
+// FollowerDiff is the set of changes between two social graph snapshots.
+type FollowerDiff struct {
+	Gained []*User // Users present in the newer snapshot but not the older one
+	Lost   []*User // Users present in the older snapshot but not the newer one
+}
+
+// SnapshotFollowers crawls the full list of followers of a profile and captures
+// them into a snapshot.
+func (p *Profile) SnapshotFollowers(ctx context.Context) (*FollowerSnapshot, error) {
+	userc, errc := p.StreamFollowers(ctx)
+	return newFollowerSnapshot(p, SnapshotFollowers, userc, errc)
+}
+
+// SnapshotFollowees crawls the full list of followees of a profile and captures
+// them into a snapshot.
+func (p *Profile) SnapshotFollowees(ctx context.Context) (*FollowerSnapshot, error) {
+	userc, errc := p.StreamFollowees(ctx)
+	return newFollowerSnapshot(p, SnapshotFollowees, userc, errc)
+}
+
+// newFollowerSnapshot consumes a user stream and assembles a snapshot from it.
+func newFollowerSnapshot(p *Profile, kind SnapshotKind, userc <-chan *User, errc <-chan error) (*FollowerSnapshot, error) {
+	snap := &FollowerSnapshot{
+		client: p.client,
+		users:  make(map[string]*User),
+		DID:    p.DID,
+		Kind:   kind,
+		Taken:  time.Now(),
+	}
+	for user := range userc {
+		if _, ok := snap.users[user.DID]; ok {
+			continue // pagination might yield duplicates if the list changes
+		}
+		snap.users[user.DID] = user
+		snap.Users = append(snap.Users, user.DID)
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	slices.Sort(snap.Users)
+	return snap, nil
+}
+
+// LoadFollowerSnapshot reads a previously saved social graph snapshot from disk.
+// The client is used to lazy-load user metadata when diffing.
+func (c *Client) LoadFollowerSnapshot(path string) (*FollowerSnapshot, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snap := &FollowerSnapshot{client: c}
+	if err := json.Unmarshal(blob, snap); err != nil {
+		return nil, err
+	}
+	if !slices.IsSorted(snap.Users) {
+		return nil, fmt.Errorf("corrupt snapshot: users not sorted")
+	}
+	return snap, nil
+}
+
+// Save writes the social graph snapshot to disk. The file is replaced atomically
+// so a crash will not corrupt a previous snapshot.
+func (s *FollowerSnapshot) Save(path string) error {
+	blob, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, blob)
+}
+
+// Diff calculates the changes between an older snapshot and this one, returning
+// the users gained and lost. Users whose metadata is not available locally are
+// retrieved from the server; deleted accounts will only have their DID set.
+func (s *FollowerSnapshot) Diff(ctx context.Context, prev *FollowerSnapshot) (*FollowerDiff, error) {
+	if s.DID != prev.DID || s.Kind != prev.Kind {
+		return nil, fmt.Errorf("snapshot mismatch: have %s of %s, want %s of %s", prev.Kind, prev.DID, s.Kind, s.DID)
+	}
+	// Both user lists are sorted, merge them to find the differences
+	var gained, lost []string
+	for i, j := 0, 0; i < len(s.Users) || j < len(prev.Users); {
+		switch {
+		case j == len(prev.Users) || (i < len(s.Users) && s.Users[i] < prev.Users[j]):
+			gained = append(gained, s.Users[i])
+			i++
+		case i == len(s.Users) || prev.Users[j] < s.Users[i]:
+			lost = append(lost, prev.Users[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	// Resolve the metadata of all the changed users
+	var (
+		diff = new(FollowerDiff)
+		err  error
+	)
+	if diff.Gained, err = s.resolveUsers(ctx, gained); err != nil {
+		return nil, err
+	}
+	if diff.Lost, err = prev.resolveUsers(ctx, lost); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// resolveUsers converts a list of DIDs into users, using locally cached metadata
+// if available, or retrieving it from the server otherwise.
+func (s *FollowerSnapshot) resolveUsers(ctx context.Context, dids []string) ([]*User, error) {
+	var (
+		users   = make([]*User, len(dids))
+		missing []int
+	)
+	for i, did := range dids {
+		if user, ok := s.users[did]; ok {
+			users[i] = user
+			continue
+		}
+		users[i] = &User{client: s.client, DID: did}
+		missing = append(missing, i)
+	}
+	if s.client == nil {
+		return users, nil
+	}
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > maxProfilesPerCall {
+			batch = batch[:maxProfilesPerCall]
+		}
+		missing = missing[len(batch):]
+
+		actors := make([]string, len(batch))
+		for i, idx := range batch {
+			actors[i] = dids[idx]
+		}
+		res, err := bsky.ActorGetProfiles(ctx, s.client.client, actors)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]*bsky.ActorDefs_ProfileViewDetailed)
+		for _, profile := range res.Profiles {
+			found[profile.Did] = profile
+		}
+		for _, idx := range batch {
+			profile, ok := found[dids[idx]]
+			if !ok {
+				continue // deleted or suspended account
+			}
+			user := users[idx]
+			user.Handle = profile.Handle
+			if profile.DisplayName != nil {
+				user.Name = *profile.DisplayName
+			}
+			if profile.Description != nil {
+				user.Bio = *profile.Description
+			}
+			if profile.Avatar != nil {
+				user.AvatarURL = *profile.Avatar
+			}
+		}
+	}
+	return users, nil
+}
+
+// TrackFollowers takes a snapshot of the profile's followers, diffs it against
+// the one previously saved at path and replaces it with the new one. On the first
+// run (no previous snapshot), an empty diff is returned.
+func (p *Profile) TrackFollowers(ctx context.Context, path string) (*FollowerDiff, error) {
+	return p.track(ctx, path, p.SnapshotFollowers)
+}
+
+// TrackFollowees takes a snapshot of the profile's followees, diffs it against
+// the one previously saved at path and replaces it with the new one. On the first
+// run (no previous snapshot), an empty diff is returned.
+func (p *Profile) TrackFollowees(ctx context.Context, path string) (*FollowerDiff, error) {
+	return p.track(ctx, path, p.SnapshotFollowees)
+}
+
+// track is the shared implementation of TrackFollowers and TrackFollowees.
+func (p *Profile) track(ctx context.Context, path string, snapshot func(context.Context) (*FollowerSnapshot, error)) (*FollowerDiff, error) {
+	prev, err := p.client.LoadFollowerSnapshot(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	snap, err := snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	diff := new(FollowerDiff)
+	if prev != nil {
+		if diff, err = snap.Diff(ctx, prev); err != nil {
+			return nil, err
+		}
+	}
+	if err := snap.Save(path); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
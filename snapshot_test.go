@@ -0,0 +1,103 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests that diffing two snapshots finds the gained and lost users.
+func TestFollowerSnapshotDiff(t *testing.T) {
+	var (
+		prev = &FollowerSnapshot{DID: testDIDTester, Kind: SnapshotFollowers, Users: []string{"did:plc:a", "did:plc:b", "did:plc:d"}}
+		next = &FollowerSnapshot{DID: testDIDTester, Kind: SnapshotFollowers, Users: []string{"did:plc:b", "did:plc:c", "did:plc:d", "did:plc:e"}}
+	)
+	diff, err := next.Diff(context.Background(), prev)
+	if err != nil {
+		t.Fatalf("failed to diff snapshots: %v", err)
+	}
+	var gained, lost []string
+	for _, user := range diff.Gained {
+		gained = append(gained, user.DID)
+	}
+	for _, user := range diff.Lost {
+		lost = append(lost, user.DID)
+	}
+	if want := []string{"did:plc:c", "did:plc:e"}; !reflect.DeepEqual(gained, want) {
+		t.Errorf("gained users mismatch: have %v, want %v", gained, want)
+	}
+	if want := []string{"did:plc:a"}; !reflect.DeepEqual(lost, want) {
+		t.Errorf("lost users mismatch: have %v, want %v", lost, want)
+	}
+	// Diffing snapshots of different kinds should be rejected
+	other := &FollowerSnapshot{DID: testDIDTester, Kind: SnapshotFollowees}
+	if _, err := next.Diff(context.Background(), other); err == nil {
+		t.Errorf("mismatching snapshot diff succeeded")
+	}
+}
+
+// Tests that snapshots can be saved and loaded back.
+func TestFollowerSnapshotPersistence(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "snapshot.json")
+		snap = &FollowerSnapshot{DID: testDIDTester, Kind: SnapshotFollowees, Users: []string{"did:plc:a", "did:plc:b"}}
+	)
+	if err := snap.Save(path); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+	loaded, err := new(Client).LoadFollowerSnapshot(path)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	if loaded.DID != snap.DID || loaded.Kind != snap.Kind || !reflect.DeepEqual(loaded.Users, snap.Users) {
+		t.Errorf("loaded snapshot mismatch: have %+v, want %+v", loaded, snap)
+	}
+}
+
+// Tests that a live snapshot of a user's followers can be tracked.
+func TestTrackFollowers(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		ctx    = context.Background()
+		path   = filepath.Join(t.TempDir(), "followers.json")
+	)
+	profile, err := client.FetchProfile(ctx, testDIDTester)
+	if err != nil {
+		t.Fatalf("failed to fetch user profile: %v", err)
+	}
+	// The first tracking run should be a baseline and report no changes
+	diff, err := profile.TrackFollowers(ctx, path)
+	if err != nil {
+		t.Fatalf("failed to track followers: %v", err)
+	}
+	if len(diff.Gained) != 0 || len(diff.Lost) != 0 {
+		t.Errorf("baseline diff not empty: gained %d, lost %d", len(diff.Gained), len(diff.Lost))
+	}
+	// Forge a follower loss and a gain into the stored snapshot and track again
+	snap, err := client.LoadFollowerSnapshot(path)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	if len(snap.Users) == 0 {
+		t.Fatalf("no followers captured")
+	}
+	gained := snap.Users[0]
+	snap.Users = append(snap.Users[1:], "did:plc:zzzzzzzzzzzzzzzzzzzzzzzz")
+	if err := snap.Save(path); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+	if diff, err = profile.TrackFollowers(ctx, path); err != nil {
+		t.Fatalf("failed to track followers: %v", err)
+	}
+	if len(diff.Gained) != 1 || diff.Gained[0].DID != gained || diff.Gained[0].Handle == "" {
+		t.Errorf("gained users mismatch: have %v, want [%s]", diff.Gained, gained)
+	}
+	if len(diff.Lost) != 1 || diff.Lost[0].DID != "did:plc:zzzzzzzzzzzzzzzzzzzzzzzz" {
+		t.Errorf("lost users mismatch: have %v", diff.Lost)
+	}
+}
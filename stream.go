@@ -0,0 +1,106 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"sync"
+)
+
+// Stream is a handle to a paginated list being crawled in the background. The
+// items are fed one by one into a result channel, which is closed when there
+// are no more items left. An error channel will also receive (optionally, only
+// ever one) error in case of a failure.
+//
+// The stream tracks the cursor of the last fully delivered page, which can be
+// used to resume an interrupted crawl (e.g. after an error or a restart) without
+// retrieving everything from scratch.
+type Stream[T any] struct {
+	items chan T     // Result channel to feed the items into
+	errc  chan error // Error channel to report a failure through
+
+	lock   sync.Mutex // Lock protecting the cursor
+	cursor string     // Cursor after the last fully delivered page
+}
+
+// newStream starts crawling a paginated list, feeding the results into a stream.
+// Unless configured otherwise, one page is prefetched in the background to avoid
+// waiting on the network between pages.
+func newStream[T any](ctx context.Context, fetch pageFetcher[T], opts []PageOption) *Stream[T] {
+	config := newPageConfig(1, opts)
+
+	s := &Stream[T]{
+		items:  make(chan T),        // Unbuffered to know exactly what got delivered
+		errc:   make(chan error, 1), // Ensure the failure fits to unblock termination
+		cursor: config.cursor,
+	}
+	go func() {
+		pull, stop := newPaginator(fetch, config).puller(ctx)
+
+		// No matter what happens, close both channels and stop the prefetcher
+		defer func() {
+			stop()
+			close(s.items)
+			close(s.errc)
+		}()
+		// Deliver the items one by one, updating the cursor after each fully
+		// consumed page
+		var delivered int
+		for index := 0; ; index++ {
+			page, err := pull()
+			if err != nil {
+				s.errc <- err
+				return
+			}
+			if page == nil {
+				return
+			}
+			for _, item := range page.items {
+				select {
+				case <-ctx.Done():
+					// Request is being torn down, abort
+					s.errc <- ctx.Err()
+					return
+				case s.items <- item:
+					// Item read, get the next one
+				}
+				delivered++
+			}
+			s.lock.Lock()
+			s.cursor = page.next
+			s.lock.Unlock()
+
+			if config.onPage != nil {
+				config.onPage(&PageInfo{
+					Index:     index,
+					Items:     len(page.items),
+					Delivered: delivered,
+					Cursor:    page.next,
+				})
+			}
+		}
+	}()
+	return s
+}
+
+// Items returns the channel through which the stream delivers the results.
+func (s *Stream[T]) Items() <-chan T {
+	return s.items
+}
+
+// Err returns the channel through which the stream reports a failure.
+func (s *Stream[T]) Err() <-chan error {
+	return s.errc
+}
+
+// Cursor returns the pagination cursor after the last fully delivered page. It
+// can be used to resume the crawl from the first page not fully consumed. The
+// cursor is empty if the list was fully consumed.
+func (s *Stream[T]) Cursor() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.cursor
+}
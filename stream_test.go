@@ -0,0 +1,97 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// makeTestFetcher creates a page fetcher over a list of numbers, using the index
+// of the next item as the cursor. The fetcher fails on the given page offset.
+func makeTestFetcher(items int, pageSize int, failAt int) pageFetcher[int] {
+	return func(ctx context.Context, cursor string, limit int) ([]int, string, error) {
+		start := 0
+		if cursor != "" {
+			start, _ = strconv.Atoi(cursor)
+		}
+		if start == failAt {
+			return nil, "", errors.New("injected failure")
+		}
+		end := min(start+min(pageSize, limit), items)
+
+		page := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			page = append(page, i)
+		}
+		if end == items {
+			return page, "", nil
+		}
+		return page, strconv.Itoa(end), nil
+	}
+}
+
+// Tests that a failed stream can be resumed from its cursor without losing or
+// duplicating items.
+func TestStreamResume(t *testing.T) {
+	ctx := context.Background()
+
+	// Crawl until the injected failure and check the cursor is at the page boundary
+	stream := newStream(ctx, makeTestFetcher(100, 10, 50), nil)
+
+	var items []int
+	for item := range stream.Items() {
+		items = append(items, item)
+	}
+	if err := <-stream.Err(); err == nil {
+		t.Fatalf("injected failure not reported")
+	}
+	if len(items) != 50 {
+		t.Fatalf("delivered item count mismatch: have %d, want %d", len(items), 50)
+	}
+	if cursor := stream.Cursor(); cursor != "50" {
+		t.Fatalf("cursor mismatch: have %q, want %q", cursor, "50")
+	}
+	// Resume the crawl and ensure everything is delivered exactly once
+	stream = newStream(ctx, makeTestFetcher(100, 10, -1), []PageOption{WithCursor(stream.Cursor())})
+	for item := range stream.Items() {
+		items = append(items, item)
+	}
+	if err := <-stream.Err(); err != nil {
+		t.Fatalf("resumed stream failed: %v", err)
+	}
+	for i, item := range items {
+		if item != i {
+			t.Fatalf("item %d mismatch: have %d, want %d", i, item, i)
+		}
+	}
+	if len(items) != 100 {
+		t.Fatalf("delivered item count mismatch: have %d, want %d", len(items), 100)
+	}
+	if cursor := stream.Cursor(); cursor != "" {
+		t.Fatalf("exhausted cursor mismatch: have %q, want empty", cursor)
+	}
+}
+
+// Tests that the cursor is not advanced until a page is fully delivered.
+func TestStreamCursorPartialPage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newStream(ctx, makeTestFetcher(100, 10, -1), nil)
+
+	for i := 0; i < 15; i++ {
+		<-stream.Items()
+	}
+	cancel()
+	for range stream.Items() {
+	}
+	if err := <-stream.Err(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupt error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if cursor := stream.Cursor(); cursor != "10" {
+		t.Fatalf("cursor mismatch: have %q, want %q", cursor, "10")
+	}
+}
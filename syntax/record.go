@@ -0,0 +1,178 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NSID is a namespaced identifier of a lexicon schema or record collection
+// (e.g. app.bsky.feed.post). The domain authority is case insensitive and is
+// normalized to lowercase, the trailing name is case sensitive.
+type NSID string
+
+// maxNSIDLength is the maximum length of an NSID accepted by atproto.
+const maxNSIDLength = 317
+
+// ParseNSID validates the syntax of an NSID, normalizing its authority.
+func ParseNSID(s string) (NSID, error) {
+	if len(s) > maxNSIDLength {
+		return "", invalid("nsid", s, "too long")
+	}
+	segments := strings.Split(s, ".")
+	if len(segments) < 3 {
+		return "", invalid("nsid", s, "want at least three segments")
+	}
+	authority, name := segments[:len(segments)-1], segments[len(segments)-1]
+	for _, segment := range authority {
+		if err := checkDomainLabel(segment); err != "" {
+			return "", invalid("nsid", s, err)
+		}
+	}
+	if !isAlpha(authority[0][0]) {
+		return "", invalid("nsid", s, "top level domain starts with digit")
+	}
+	if name == "" || len(name) > 63 {
+		return "", invalid("nsid", s, "name empty or too long")
+	}
+	if !isAlpha(name[0]) {
+		return "", invalid("nsid", s, "name starts with digit")
+	}
+	for i := 0; i < len(name); i++ {
+		if !isAlphaNum(name[i]) {
+			return "", invalid("nsid", s, fmt.Sprintf("disallowed name character %q", name[i]))
+		}
+	}
+	return NSID(strings.ToLower(strings.Join(authority, ".")) + "." + name), nil
+}
+
+// Authority returns the domain authority of the NSID, in reverse order as it
+// appears in the identifier (e.g. app.bsky.feed).
+func (n NSID) Authority() string {
+	return string(n[:strings.LastIndexByte(string(n), '.')])
+}
+
+// Name returns the trailing name of the NSID (e.g. post).
+func (n NSID) Name() string {
+	return string(n[strings.LastIndexByte(string(n), '.')+1:])
+}
+
+// String implements fmt.Stringer.
+func (n NSID) String() string {
+	return string(n)
+}
+
+// RecordKey is the key of a record within a collection (e.g. a TID or self).
+// Record keys are case sensitive and not normalized.
+type RecordKey string
+
+// maxRecordKeyLength is the maximum length of a record key accepted by atproto.
+const maxRecordKeyLength = 512
+
+// ParseRecordKey validates the syntax of a record key.
+func ParseRecordKey(s string) (RecordKey, error) {
+	if s == "" || len(s) > maxRecordKeyLength {
+		return "", invalid("record key", s, "empty or too long")
+	}
+	if s == "." || s == ".." {
+		return "", invalid("record key", s, "reserved path component")
+	}
+	for i := 0; i < len(s); i++ {
+		if !isAlphaNum(s[i]) && !strings.ContainsRune("._:~-", rune(s[i])) {
+			return "", invalid("record key", s, fmt.Sprintf("disallowed character %q", s[i]))
+		}
+	}
+	return RecordKey(s), nil
+}
+
+// String implements fmt.Stringer.
+func (k RecordKey) String() string {
+	return string(k)
+}
+
+// ATURI is a reference to an account, a collection or a record in the form of
+// at://authority[/collection[/rkey]]. The components are normalized as per
+// their own types.
+type ATURI string
+
+// maxATURILength is the maximum length of an AT-URI accepted by atproto.
+const maxATURILength = 8192
+
+// ParseATURI validates the syntax of an AT-URI, normalizing its components.
+// Query and fragment parts are not supported.
+func ParseATURI(s string) (ATURI, error) {
+	if len(s) > maxATURILength {
+		return "", invalid("at-uri", s, "too long")
+	}
+	rest, ok := strings.CutPrefix(s, "at://")
+	if !ok {
+		return "", invalid("at-uri", s, "missing at:// prefix")
+	}
+	if strings.ContainsAny(rest, "?#") {
+		return "", invalid("at-uri", s, "query or fragment not supported")
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) > 3 {
+		return "", invalid("at-uri", s, "want at://authority/collection/rkey")
+	}
+	authority, err := ParseAtIdentifier(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid at-uri %q: %w", s, err)
+	}
+	uri := "at://" + authority.String()
+	if len(parts) > 1 {
+		collection, err := ParseNSID(parts[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid at-uri %q: %w", s, err)
+		}
+		uri += "/" + collection.String()
+	}
+	if len(parts) > 2 {
+		rkey, err := ParseRecordKey(parts[2])
+		if err != nil {
+			return "", fmt.Errorf("invalid at-uri %q: %w", s, err)
+		}
+		uri += "/" + rkey.String()
+	}
+	return ATURI(uri), nil
+}
+
+// NewATURI assembles the AT-URI of a record from its components.
+func NewATURI(authority AtIdentifier, collection NSID, rkey RecordKey) ATURI {
+	return ATURI("at://" + authority.String() + "/" + collection.String() + "/" + rkey.String())
+}
+
+// Authority returns the account the AT-URI references.
+func (u ATURI) Authority() AtIdentifier {
+	return AtIdentifier(u.part(0))
+}
+
+// Collection returns the collection the AT-URI references, or an empty string
+// if it references an entire account.
+func (u ATURI) Collection() NSID {
+	return NSID(u.part(1))
+}
+
+// RecordKey returns the key of the record the AT-URI references, or an empty
+// string if it references an entire account or collection.
+func (u ATURI) RecordKey() RecordKey {
+	return RecordKey(u.part(2))
+}
+
+// part returns the n-th path component of the AT-URI, or an empty string if the
+// URI does not have that many components.
+func (u ATURI) part(n int) string {
+	parts := strings.SplitN(strings.TrimPrefix(string(u), "at://"), "/", 3)
+	if n >= len(parts) {
+		return ""
+	}
+	return parts[n]
+}
+
+// String implements fmt.Stringer.
+func (u ATURI) String() string {
+	return string(u)
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package syntax contains strict parsers and validators for the identifier
+// formats used throughout atproto: DIDs, handles, NSIDs, record keys, TIDs and
+// AT-URIs. All the types are plain strings once parsed, so they can be passed
+// to any API expecting the string form via a conversion or String.
+package syntax
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSyntax is returned if an identifier does not conform to the format
+// mandated by the atproto specs.
+var ErrInvalidSyntax = errors.New("invalid syntax")
+
+// invalid creates a syntax error for a specific kind of identifier.
+func invalid(kind string, s string, reason string) error {
+	return fmt.Errorf("%w: %s %q: %s", ErrInvalidSyntax, kind, s, reason)
+}
+
+// DID is a decentralized identifier (e.g. did:plc:ewvi7nxzyoun6zhxrhs64oiz).
+// DIDs are case sensitive and not normalized.
+type DID string
+
+// maxDIDLength is the maximum length of a DID accepted by atproto.
+const maxDIDLength = 2048
+
+// ParseDID validates the syntax of a DID.
+func ParseDID(s string) (DID, error) {
+	if len(s) > maxDIDLength {
+		return "", invalid("did", s, "too long")
+	}
+	rest, ok := strings.CutPrefix(s, "did:")
+	if !ok {
+		return "", invalid("did", s, "missing did: prefix")
+	}
+	method, id, ok := strings.Cut(rest, ":")
+	if !ok || method == "" || id == "" {
+		return "", invalid("did", s, "want did:method:identifier")
+	}
+	for i := 0; i < len(method); i++ {
+		if method[i] < 'a' || method[i] > 'z' {
+			return "", invalid("did", s, "method not lowercase letters")
+		}
+	}
+	for i := 0; i < len(id); i++ {
+		if !isAlphaNum(id[i]) && !strings.ContainsRune("._:%-", rune(id[i])) {
+			return "", invalid("did", s, fmt.Sprintf("disallowed character %q", id[i]))
+		}
+	}
+	if strings.HasSuffix(id, ":") || strings.HasSuffix(id, "%") {
+		return "", invalid("did", s, "trailing colon or percent")
+	}
+	return DID(s), nil
+}
+
+// Method returns the DID method (e.g. plc or web).
+func (d DID) Method() string {
+	method, _, _ := strings.Cut(strings.TrimPrefix(string(d), "did:"), ":")
+	return method
+}
+
+// Identifier returns the method specific part of the DID.
+func (d DID) Identifier() string {
+	_, id, _ := strings.Cut(strings.TrimPrefix(string(d), "did:"), ":")
+	return id
+}
+
+// String implements fmt.Stringer.
+func (d DID) String() string {
+	return string(d)
+}
+
+// Handle is a domain name based account alias (e.g. karalabe.bsky.social).
+// Handles are case insensitive and normalized to lowercase.
+type Handle string
+
+// maxHandleLength is the maximum length of a handle, as for any domain name.
+const maxHandleLength = 253
+
+// ParseHandle validates the syntax of a handle and normalizes it to lowercase.
+func ParseHandle(s string) (Handle, error) {
+	if len(s) > maxHandleLength {
+		return "", invalid("handle", s, "too long")
+	}
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return "", invalid("handle", s, "want at least two domain labels")
+	}
+	for _, label := range labels {
+		if err := checkDomainLabel(label); err != "" {
+			return "", invalid("handle", s, err)
+		}
+	}
+	if tld := labels[len(labels)-1]; !isAlpha(tld[0]) {
+		return "", invalid("handle", s, "top level domain starts with digit")
+	}
+	return Handle(strings.ToLower(s)), nil
+}
+
+// String implements fmt.Stringer.
+func (h Handle) String() string {
+	return string(h)
+}
+
+// checkDomainLabel validates a single label of a domain name, returning the
+// reason of failure or an empty string if valid.
+func checkDomainLabel(label string) string {
+	if label == "" {
+		return "empty domain label"
+	}
+	if len(label) > 63 {
+		return "domain label too long"
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return "domain label starts or ends with hyphen"
+	}
+	for i := 0; i < len(label); i++ {
+		if !isAlphaNum(label[i]) && label[i] != '-' {
+			return fmt.Sprintf("disallowed character %q", label[i])
+		}
+	}
+	return ""
+}
+
+// AtIdentifier is either a DID or a handle, the two ways to reference an account
+// in atproto APIs.
+type AtIdentifier string
+
+// ParseAtIdentifier validates the syntax of a DID or a handle, normalizing the
+// latter to lowercase.
+func ParseAtIdentifier(s string) (AtIdentifier, error) {
+	if strings.HasPrefix(s, "did:") {
+		did, err := ParseDID(s)
+		return AtIdentifier(did), err
+	}
+	handle, err := ParseHandle(s)
+	return AtIdentifier(handle), err
+}
+
+// IsDID returns whether the identifier is a DID.
+func (id AtIdentifier) IsDID() bool {
+	return strings.HasPrefix(string(id), "did:")
+}
+
+// DID returns the identifier as a DID, or an empty string if it's a handle.
+func (id AtIdentifier) DID() DID {
+	if !id.IsDID() {
+		return ""
+	}
+	return DID(id)
+}
+
+// Handle returns the identifier as a handle, or an empty string if it's a DID.
+func (id AtIdentifier) Handle() Handle {
+	if id.IsDID() {
+		return ""
+	}
+	return Handle(id)
+}
+
+// String implements fmt.Stringer.
+func (id AtIdentifier) String() string {
+	return string(id)
+}
+
+// isAlpha returns whether a character is an ASCII letter.
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isAlphaNum returns whether a character is an ASCII letter or digit.
+func isAlphaNum(c byte) bool {
+	return isAlpha(c) || (c >= '0' && c <= '9')
+}
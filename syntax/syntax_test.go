@@ -0,0 +1,135 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Tests that identifiers are validated and normalized as per the atproto specs.
+func TestParse(t *testing.T) {
+	tests := []struct {
+		parse func(string) (string, error)
+		input string
+		want  string // Normalized form, empty if invalid
+	}{
+		// DIDs are validated but never normalized
+		{parseDID, "did:plc:ewvi7nxzyoun6zhxrhs64oiz", "did:plc:ewvi7nxzyoun6zhxrhs64oiz"},
+		{parseDID, "did:web:example.com%3A8080", "did:web:example.com%3A8080"},
+		{parseDID, "did:PLC:ewvi7nxzyoun6zhxrhs64oiz", ""},
+		{parseDID, "did:plc:", ""},
+		{parseDID, "did:web:example.com:", ""},
+		{parseDID, "did:plc:ewvi/7nxzy", ""},
+		{parseDID, "plc:ewvi7nxzyoun6zhxrhs64oiz", ""},
+
+		// Handles are lowercased
+		{parseHandle, "Karalabe.Bsky.Social", "karalabe.bsky.social"},
+		{parseHandle, "x.y", "x.y"},
+		{parseHandle, "localhost", ""},
+		{parseHandle, "john..test", ""},
+		{parseHandle, "-john.test", ""},
+		{parseHandle, "john.123", ""},
+		{parseHandle, "john_doe.test", ""},
+		{parseHandle, strings.Repeat("a", 64) + ".test", ""},
+
+		// Identifiers dispatch on the did: prefix
+		{parseAtIdentifier, "did:plc:ewvi7nxzyoun6zhxrhs64oiz", "did:plc:ewvi7nxzyoun6zhxrhs64oiz"},
+		{parseAtIdentifier, "Alice.Test", "alice.test"},
+		{parseAtIdentifier, "@alice.test", ""},
+
+		// NSIDs lowercase the authority only
+		{parseNSID, "App.Bsky.Feed.getPostThread", "app.bsky.feed.getPostThread"},
+		{parseNSID, "com.example.fooBar2", "com.example.fooBar2"},
+		{parseNSID, "com.example", ""},
+		{parseNSID, "com.example.2foo", ""},
+		{parseNSID, "com.example.foo-bar", ""},
+		{parseNSID, "1com.example.foo", ""},
+
+		// Record keys are mostly free form
+		{parseRecordKey, "3jzfcijpj2z2a", "3jzfcijpj2z2a"},
+		{parseRecordKey, "self", "self"},
+		{parseRecordKey, "a:b.c~d_e-f", "a:b.c~d_e-f"},
+		{parseRecordKey, "..", ""},
+		{parseRecordKey, "a/b", ""},
+		{parseRecordKey, "", ""},
+
+		// TIDs are strict base32 with the high bit unset
+		{parseTID, "3jzfcijpj2z2a", "3jzfcijpj2z2a"},
+		{parseTID, "3jzfcijpj2z2", ""},
+		{parseTID, "zjzfcijpj2z2a", ""},
+		{parseTID, "3jzfcijpj2z21", ""},
+
+		// AT-URIs normalize each component
+		{parseATURI, "at://Alice.Test", "at://alice.test"},
+		{parseATURI, "at://did:plc:abc/App.Bsky.Feed.post", "at://did:plc:abc/app.bsky.feed.post"},
+		{parseATURI, "at://Alice.Test/app.bsky.feed.post/3jzfcijpj2z2a", "at://alice.test/app.bsky.feed.post/3jzfcijpj2z2a"},
+		{parseATURI, "https://alice.test", ""},
+		{parseATURI, "at://alice.test/app.bsky.feed.post/", ""},
+		{parseATURI, "at://alice.test/app.bsky.feed.post/a/b", ""},
+		{parseATURI, "at://alice.test/post/3jzfcijpj2z2a", ""},
+		{parseATURI, "at://alice.test/app.bsky.feed.post/3jzfcijpj2z2a#frag", ""},
+	}
+	for _, tt := range tests {
+		have, err := tt.parse(tt.input)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%q: expected failure, got %q", tt.input, have)
+		case tt.want == "" && !errors.Is(err, ErrInvalidSyntax):
+			t.Errorf("%q: error mismatch: have %v, want %v", tt.input, err, ErrInvalidSyntax)
+		case tt.want != "" && err != nil:
+			t.Errorf("%q: failed to parse: %v", tt.input, err)
+		case tt.want != "" && have != tt.want:
+			t.Errorf("%q: normalization mismatch: have %q, want %q", tt.input, have, tt.want)
+		}
+	}
+}
+
+// Tests that the components of parsed identifiers can be accessed.
+func TestAccessors(t *testing.T) {
+	uri, err := ParseATURI("at://did:plc:abc/app.bsky.feed.post/3jzfcijpj2z2a")
+	if err != nil {
+		t.Fatalf("failed to parse at-uri: %v", err)
+	}
+	if have := uri.Authority(); !have.IsDID() || have.DID() != "did:plc:abc" || have.Handle() != "" {
+		t.Errorf("authority mismatch: have %q", have)
+	}
+	if have := uri.Authority().DID(); have.Method() != "plc" || have.Identifier() != "abc" {
+		t.Errorf("did components mismatch: have %q/%q", have.Method(), have.Identifier())
+	}
+	if have := uri.Collection(); have.Authority() != "app.bsky.feed" || have.Name() != "post" {
+		t.Errorf("collection mismatch: have %q/%q", have.Authority(), have.Name())
+	}
+	if have := uri.RecordKey(); have != "3jzfcijpj2z2a" {
+		t.Errorf("record key mismatch: have %q", have)
+	}
+	if have := NewATURI(uri.Authority(), uri.Collection(), uri.RecordKey()); have != uri {
+		t.Errorf("assembled uri mismatch: have %q, want %q", have, uri)
+	}
+	short := ATURI("at://alice.test")
+	if short.Authority().Handle() != "alice.test" || short.Collection() != "" || short.RecordKey() != "" {
+		t.Errorf("account uri components mismatch: %q/%q/%q", short.Authority(), short.Collection(), short.RecordKey())
+	}
+}
+
+// adapt converts a typed parser into a string one to run them through the same
+// test table.
+func adapt[T ~string](parse func(string) (T, error)) func(string) (string, error) {
+	return func(s string) (string, error) {
+		v, err := parse(s)
+		return string(v), err
+	}
+}
+
+var (
+	parseDID          = adapt(ParseDID)
+	parseHandle       = adapt(ParseHandle)
+	parseAtIdentifier = adapt(ParseAtIdentifier)
+	parseNSID         = adapt(ParseNSID)
+	parseRecordKey    = adapt(ParseRecordKey)
+	parseTID          = adapt(ParseTID)
+	parseATURI        = adapt(ParseATURI)
+)
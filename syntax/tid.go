@@ -0,0 +1,110 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tidAlphabet is the sortable base32 alphabet used to encode timestamp ids.
+const tidAlphabet = "234567abcdefghijklmnopqrstuvwxyz"
+
+// TID is a timestamp id, the record key format used by atproto for most records.
+// TIDs encode a microsecond timestamp and a clock id, and sort by creation time.
+type TID string
+
+// ParseTID validates the syntax of a TID.
+func ParseTID(s string) (TID, error) {
+	if len(s) != 13 {
+		return "", invalid("tid", s, "want 13 characters")
+	}
+	// The top bit of the 64 bit integer is always zero, limiting the first char
+	if !strings.ContainsRune(tidAlphabet[:16], rune(s[0])) {
+		return "", invalid("tid", s, "high bit set")
+	}
+	for i := 1; i < len(s); i++ {
+		if !strings.ContainsRune(tidAlphabet, rune(s[i])) {
+			return "", invalid("tid", s, fmt.Sprintf("disallowed character %q", s[i]))
+		}
+	}
+	return TID(s), nil
+}
+
+// NewTID encodes a timestamp and a clock id into a TID. The timestamp is kept
+// at microsecond precision and the clock id is truncated to 10 bits.
+func NewTID(t time.Time, clock uint) TID {
+	v := (uint64(t.UnixMicro())&(1<<53-1))<<10 | uint64(clock)&(1<<10-1)
+
+	var buf [13]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = tidAlphabet[v&31]
+		v >>= 5
+	}
+	return TID(buf[:])
+}
+
+// Time returns the timestamp encoded in the TID.
+func (t TID) Time() time.Time {
+	return time.UnixMicro(int64(t.integer() >> 10))
+}
+
+// Clock returns the clock id encoded in the TID.
+func (t TID) Clock() uint {
+	return uint(t.integer() & (1<<10 - 1))
+}
+
+// integer decodes the TID into its 64 bit integer form.
+func (t TID) integer() uint64 {
+	var v uint64
+	for i := 0; i < len(t); i++ {
+		v = v<<5 | uint64(strings.IndexByte(tidAlphabet, t[i]))
+	}
+	return v
+}
+
+// String implements fmt.Stringer.
+func (t TID) String() string {
+	return string(t)
+}
+
+// TIDClock generates TIDs that are unique and monotonically increasing, even if
+// requested faster than the clock ticks or if the system clock goes backwards.
+type TIDClock struct {
+	id   uint       // Clock id to avoid collisions across generators
+	lock sync.Mutex // Lock protecting the last issued timestamp
+	last int64      // Last issued timestamp, to keep ids unique
+}
+
+// NewTIDClock creates a TID generator with the given clock id, of which only the
+// low 10 bits are used.
+func NewTIDClock(id uint) *TIDClock {
+	return &TIDClock{id: id & (1<<10 - 1)}
+}
+
+// Next generates a new TID, strictly greater than any previous one.
+func (c *TIDClock) Next() TID {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now().UnixMicro()
+	if now <= c.last {
+		now = c.last + 1
+	}
+	c.last = now
+	return NewTID(time.UnixMicro(now), c.id)
+}
+
+// defaultClock is the process wide TID generator with a random clock id.
+var defaultClock = NewTIDClock(uint(rand.IntN(1024)))
+
+// NextTID generates a new TID from the process wide generator, unique within the
+// process and sortable by creation time.
+func NextTID() TID {
+	return defaultClock.Next()
+}
@@ -0,0 +1,42 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that timestamp ids are correctly encoded and sortable.
+func TestTID(t *testing.T) {
+	// Ensure the boundaries are encoded correctly
+	if tid := NewTID(time.UnixMicro(0), 0); tid != "2222222222222" {
+		t.Errorf("zero TID mismatch: have %s, want %s", tid, "2222222222222")
+	}
+	if tid := NewTID(time.UnixMicro(1<<53-1), 1<<10-1); tid != "bzzzzzzzzzzzz" {
+		t.Errorf("max TID mismatch: have %s, want %s", tid, "bzzzzzzzzzzzz")
+	}
+	// Ensure the components can be decoded back
+	now := time.UnixMicro(time.Now().UnixMicro())
+	if tid := NewTID(now, 777); !tid.Time().Equal(now) || tid.Clock() != 777 {
+		t.Errorf("TID components mismatch: have %v/%d, want %v/%d", tid.Time(), tid.Clock(), now, 777)
+	}
+	// Ensure generated ids are valid, unique and increasing
+	clock := NewTIDClock(1)
+	prev := clock.Next()
+	for i := 0; i < 1000; i++ {
+		next := clock.Next()
+		if _, err := ParseTID(next.String()); err != nil {
+			t.Fatalf("generated TID invalid: %v", err)
+		}
+		if next <= prev {
+			t.Fatalf("TID not increasing: %s after %s", next, prev)
+		}
+		if next.Clock() != 1 {
+			t.Fatalf("TID clock mismatch: have %d, want %d", next.Clock(), 1)
+		}
+		prev = next
+	}
+}
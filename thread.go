@@ -0,0 +1,171 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// ThreadNodeKind defines what a node in a post thread represents.
+type ThreadNodeKind int
+
+const (
+	ThreadNodePost     ThreadNodeKind = iota // Node is a post visible to the viewer
+	ThreadNodeNotFound                       // Node is a placeholder for a deleted or missing post
+	ThreadNodeBlocked                        // Node is a placeholder for a post hidden due to a block
+)
+
+// ThreadNode is a single entry in a post thread, linked to its parent and replies.
+type ThreadNode struct {
+	Kind ThreadNodeKind // Type of the node, placeholders have no post content
+	URI  string         // AT-URI of the post record, set for placeholders too
+	Post *Post          // Post content, nil for placeholder nodes
+
+	BlockedAuthor string // DID of the author of a blocked post, empty otherwise
+
+	Parent  *ThreadNode   // Post this one replies to, nil if the top of the retrieved thread
+	Replies []*ThreadNode // Replies to this post, as retrieved up to the requested depth
+}
+
+// Thread is a conversation around a post, as a tree of nodes rooted at the top
+// most retrieved ancestor.
+type Thread struct {
+	Root   *ThreadNode // Top most retrieved ancestor of the requested post (or itself)
+	Anchor *ThreadNode // Node of the post the thread was requested for
+}
+
+// FetchThread retrieves the conversation around a post, including the replies
+// up to depth levels below it and the ancestors up to parentHeight levels above.
+// Posts the server refuses to return are present as placeholder nodes.
+func (c *Client) FetchThread(ctx context.Context, uri string, depth int, parentHeight int) (*Thread, error) {
+	if _, _, _, err := parseATURI(uri); err != nil {
+		return nil, err
+	}
+	res, err := bsky.FeedGetPostThread(ctx, c.client, int64(depth), int64(parentHeight), uri)
+	if err != nil {
+		return nil, err
+	}
+	return newThread(c, res)
+}
+
+// newThread converts an API thread view into the library's thread tree.
+func newThread(c *Client, res *bsky.FeedGetPostThread_Output) (*Thread, error) {
+	if res.Thread == nil {
+		return nil, ErrPostNotFound
+	}
+	anchor := newThreadNode(c, res.Thread.FeedDefs_ThreadViewPost, res.Thread.FeedDefs_NotFoundPost, res.Thread.FeedDefs_BlockedPost)
+	if anchor == nil {
+		return nil, ErrPostNotFound
+	}
+	// Link up all the ancestors, returned as a reverse chain from the anchor
+	root := anchor
+	if view := res.Thread.FeedDefs_ThreadViewPost; view != nil {
+		for parent := view.Parent; parent != nil; {
+			node := newThreadNode(c, parent.FeedDefs_ThreadViewPost, parent.FeedDefs_NotFoundPost, parent.FeedDefs_BlockedPost)
+			if node == nil {
+				break
+			}
+			node.Replies = []*ThreadNode{root}
+			root.Parent = node
+			root = node
+
+			if parent.FeedDefs_ThreadViewPost == nil {
+				break
+			}
+			parent = parent.FeedDefs_ThreadViewPost.Parent
+		}
+	}
+	return &Thread{Root: root, Anchor: anchor}, nil
+}
+
+// newThreadNode converts one of the API thread union variants into a thread node,
+// recursively converting all the replies below it. Ancestors are not linked.
+func newThreadNode(client *Client, view *bsky.FeedDefs_ThreadViewPost, missing *bsky.FeedDefs_NotFoundPost, blocked *bsky.FeedDefs_BlockedPost) *ThreadNode {
+	switch {
+	case view != nil && view.Post != nil:
+		node := &ThreadNode{
+			Kind: ThreadNodePost,
+			URI:  view.Post.Uri,
+			Post: newPostFromView(client, view.Post),
+		}
+		for _, reply := range view.Replies {
+			if reply == nil {
+				continue
+			}
+			if child := newThreadNode(client, reply.FeedDefs_ThreadViewPost, reply.FeedDefs_NotFoundPost, reply.FeedDefs_BlockedPost); child != nil {
+				child.Parent = node
+				node.Replies = append(node.Replies, child)
+			}
+		}
+		return node
+
+	case missing != nil:
+		return &ThreadNode{Kind: ThreadNodeNotFound, URI: missing.Uri}
+
+	case blocked != nil:
+		node := &ThreadNode{Kind: ThreadNodeBlocked, URI: blocked.Uri}
+		if blocked.Author != nil {
+			node.BlockedAuthor = blocked.Author.Did
+		}
+		return node
+
+	default:
+		return nil // unknown union variant, skip
+	}
+}
+
+// Walk traverses the thread depth first starting at the root, invoking visit on
+// every node along with its depth below the root. If visit returns false, the
+// replies of that node are skipped.
+func (t *Thread) Walk(visit func(node *ThreadNode, depth int) bool) {
+	t.Root.walk(visit, 0)
+}
+
+// walk is the recursive implementation of Thread.Walk.
+func (n *ThreadNode) walk(visit func(node *ThreadNode, depth int) bool, depth int) {
+	if !visit(n, depth) {
+		return
+	}
+	for _, reply := range n.Replies {
+		reply.walk(visit, depth+1)
+	}
+}
+
+// Flatten returns all the visible posts of the thread, ordered chronologically
+// by their creation time. Placeholder nodes are omitted.
+func (t *Thread) Flatten() []*Post {
+	return t.Filter(func(*Post) bool { return true })
+}
+
+// FilterByAuthor returns all the visible posts of the thread made by a specific
+// user, ordered chronologically. The author may be given by handle or DID.
+func (t *Thread) FilterByAuthor(id string) []*Post {
+	return t.Filter(func(post *Post) bool {
+		return post.Author != nil && (post.Author.DID == id || post.Author.Handle == id)
+	})
+}
+
+// Filter returns all the visible posts of the thread accepted by the given
+// predicate, ordered chronologically.
+func (t *Thread) Filter(accept func(post *Post) bool) []*Post {
+	var posts []*Post
+	t.Walk(func(node *ThreadNode, depth int) bool {
+		if node.Post != nil && accept(node.Post) {
+			posts = append(posts, node.Post)
+		}
+		return true
+	})
+	slices.SortStableFunc(posts, func(a, b *Post) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.URI, b.URI)
+	})
+	return posts
+}
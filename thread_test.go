@@ -0,0 +1,148 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// testThread is a hand crafted thread response with a missing grandparent, a
+// blocked reply and a nested conversation between two users.
+const testThread = `{"thread": {
+	"$type": "app.bsky.feed.defs#threadViewPost",
+	"post": {"uri": "at://did:plc:alice/app.bsky.feed.post/2", "cid": "c2", "indexedAt": "2023-05-01T10:02:00Z",
+		"author": {"did": "did:plc:alice", "handle": "alice.test"},
+		"record": {"$type": "app.bsky.feed.post", "text": "second", "createdAt": "2023-05-01T10:02:00Z"}},
+	"parent": {
+		"$type": "app.bsky.feed.defs#threadViewPost",
+		"post": {"uri": "at://did:plc:bob/app.bsky.feed.post/1", "cid": "c1", "indexedAt": "2023-05-01T10:01:00Z",
+			"author": {"did": "did:plc:bob", "handle": "bob.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "first", "createdAt": "2023-05-01T10:01:00Z"}},
+		"parent": {"$type": "app.bsky.feed.defs#notFoundPost", "uri": "at://did:plc:carol/app.bsky.feed.post/0", "notFound": true}
+	},
+	"replies": [
+		{"$type": "app.bsky.feed.defs#threadViewPost",
+		 "post": {"uri": "at://did:plc:bob/app.bsky.feed.post/4", "cid": "c4", "indexedAt": "2023-05-01T10:04:00Z",
+			"author": {"did": "did:plc:bob", "handle": "bob.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "fourth", "createdAt": "2023-05-01T10:04:00Z"}},
+		 "replies": [
+			{"$type": "app.bsky.feed.defs#threadViewPost",
+			 "post": {"uri": "at://did:plc:alice/app.bsky.feed.post/5", "cid": "c5", "indexedAt": "2023-05-01T10:05:00Z",
+				"author": {"did": "did:plc:alice", "handle": "alice.test"},
+				"record": {"$type": "app.bsky.feed.post", "text": "fifth", "createdAt": "2023-05-01T10:05:00Z"}}}
+		 ]},
+		{"$type": "app.bsky.feed.defs#blockedPost", "uri": "at://did:plc:dave/app.bsky.feed.post/3", "blocked": true,
+		 "author": {"did": "did:plc:dave"}},
+		{"$type": "app.bsky.feed.defs#threadViewPost",
+		 "post": {"uri": "at://did:plc:alice/app.bsky.feed.post/3", "cid": "c3", "indexedAt": "2023-05-01T10:03:00Z",
+			"author": {"did": "did:plc:alice", "handle": "alice.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "third", "createdAt": "2023-05-01T10:03:00Z"}}}
+	]
+}}`
+
+// Tests that thread responses are converted into a correctly linked tree and
+// that the traversal helpers work as expected.
+func TestThreadTree(t *testing.T) {
+	res := new(bsky.FeedGetPostThread_Output)
+	if err := json.Unmarshal([]byte(testThread), res); err != nil {
+		t.Fatalf("failed to parse test thread: %v", err)
+	}
+	thread, err := newThread(nil, res)
+	if err != nil {
+		t.Fatalf("failed to convert thread: %v", err)
+	}
+	// Ensure the ancestors are linked up correctly
+	if thread.Root.Kind != ThreadNodeNotFound || thread.Root.Parent != nil {
+		t.Fatalf("root node mismatch: have kind %v, parent %v", thread.Root.Kind, thread.Root.Parent)
+	}
+	if thread.Anchor.Post == nil || thread.Anchor.Post.Text != "second" {
+		t.Fatalf("anchor node mismatch: have %v", thread.Anchor.Post)
+	}
+	if parent := thread.Anchor.Parent; parent == nil || parent.Post.Text != "first" || parent.Parent != thread.Root {
+		t.Fatalf("anchor parent mismatch")
+	}
+	// Ensure the replies are linked up correctly, with placeholders typed
+	if len(thread.Anchor.Replies) != 3 {
+		t.Fatalf("reply count mismatch: have %d, want %d", len(thread.Anchor.Replies), 3)
+	}
+	if blocked := thread.Anchor.Replies[1]; blocked.Kind != ThreadNodeBlocked || blocked.BlockedAuthor != "did:plc:dave" || blocked.Post != nil {
+		t.Errorf("blocked placeholder mismatch: have %+v", blocked)
+	}
+	for _, reply := range thread.Anchor.Replies {
+		if reply.Parent != thread.Anchor {
+			t.Errorf("reply %s parent link mismatch", reply.URI)
+		}
+	}
+	// Ensure walking visits everything in depth first order and can be pruned
+	var (
+		uris   []string
+		depths []int
+	)
+	thread.Walk(func(node *ThreadNode, depth int) bool {
+		uris = append(uris, node.URI)
+		depths = append(depths, depth)
+		return node.Post == nil || node.Post.Text != "fourth"
+	})
+	want := []string{
+		"at://did:plc:carol/app.bsky.feed.post/0",
+		"at://did:plc:bob/app.bsky.feed.post/1",
+		"at://did:plc:alice/app.bsky.feed.post/2",
+		"at://did:plc:bob/app.bsky.feed.post/4",
+		"at://did:plc:dave/app.bsky.feed.post/3",
+		"at://did:plc:alice/app.bsky.feed.post/3",
+	}
+	if len(uris) != len(want) {
+		t.Fatalf("walked node count mismatch: have %d, want %d", len(uris), len(want))
+	}
+	for i := range want {
+		if uris[i] != want[i] {
+			t.Errorf("walked node %d mismatch: have %s, want %s", i, uris[i], want[i])
+		}
+	}
+	if depths[0] != 0 || depths[3] != 3 || depths[5] != 3 {
+		t.Errorf("walked depths mismatch: have %v", depths)
+	}
+	// Ensure flattening and filtering orders the posts chronologically
+	var texts []string
+	for _, post := range thread.Flatten() {
+		texts = append(texts, post.Text)
+	}
+	if have, want := len(texts), 5; have != want {
+		t.Fatalf("flattened post count mismatch: have %d, want %d", have, want)
+	}
+	for i, text := range []string{"first", "second", "third", "fourth", "fifth"} {
+		if texts[i] != text {
+			t.Errorf("flattened post %d mismatch: have %s, want %s", i, texts[i], text)
+		}
+	}
+	if posts := thread.FilterByAuthor("alice.test"); len(posts) != 3 || posts[0].Text != "second" || posts[2].Text != "fifth" {
+		t.Errorf("author filtered posts mismatch: have %v", posts)
+	}
+	if posts := thread.FilterByAuthor("did:plc:bob"); len(posts) != 2 {
+		t.Errorf("author filtered post count mismatch: have %d, want %d", len(posts), 2)
+	}
+}
+
+// Tests that live threads can be retrieved.
+func TestFetchThread(t *testing.T) {
+	var (
+		client = makeTestClientWithLogin(t)
+		uri    = fetchTestPostURI(t, client)
+	)
+	thread, err := client.FetchThread(context.Background(), uri, 6, 80)
+	if err != nil {
+		t.Fatalf("failed to fetch thread: %v", err)
+	}
+	if thread.Anchor.Post == nil || thread.Anchor.Post.URI != uri {
+		t.Fatalf("anchor post mismatch: have %v, want %s", thread.Anchor.Post, uri)
+	}
+	if len(thread.Flatten()) == 0 {
+		t.Errorf("no posts in thread")
+	}
+}
@@ -4,7 +4,20 @@
 
 package bluesky
 
-import "strconv"
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// throttleFallbackDelay is the time to wait before retrying a throttled request
+// if the server did not specify when the rate limit resets.
+const throttleFallbackDelay = time.Minute
 
 // maybeEscape checks if the provided string needs escaping/quoting, and calls
 // strconv.Quote if needed. The goal is to prevent malicious user input from
@@ -23,3 +36,65 @@ func maybeEscape(s string) string {
 	}
 	return strconv.Quote(s)
 }
+
+// parseTime converts an optional atproto timestamp into a Go time, returning the
+// zero time if the timestamp is unset or malformed.
+func parseTime(s *string) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, *s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// waitThrottled checks whether an error is a rate limit rejection from the server
+// and if so, blocks until the limit resets (or the context is cancelled). The
+// returned flag is whether the request should be retried.
+func waitThrottled(ctx context.Context, err error) bool {
+	var xerr *xrpc.Error
+	if !errors.As(err, &xerr) || !xerr.IsThrottled() {
+		return false
+	}
+	delay := throttleFallbackDelay
+	if xerr.Ratelimit != nil && !xerr.Ratelimit.Reset.IsZero() {
+		delay = max(time.Until(xerr.Ratelimit.Reset), time.Second)
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+// writeFileAtomic writes a blob of data into a file by first writing it into a
+// temporary one and then moving it in place, to avoid partial writes on crashes.
+func writeFileAtomic(path string, blob []byte) error {
+	if err := os.WriteFile(path+".tmp", blob, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// writeStreamAtomic streams some content into a file by first writing it into a
+// temporary file and then moving it into place, so that the target file is never
+// left partially written.
+func writeStreamAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(path + ".tmp")
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,283 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultWatchMinInterval is the polling interval of the notification watcher
+	// while there is activity, if the watcher config does not specify it.
+	defaultWatchMinInterval = 5 * time.Second
+
+	// defaultWatchMaxInterval is the polling interval the notification watcher
+	// backs off to while idle, if the watcher config does not specify it.
+	defaultWatchMaxInterval = time.Minute
+
+	// watchResyncInterval is the time after which the notification watcher lists
+	// the notifications even if the unread count says there is nothing new, in
+	// case some other client marked them seen.
+	watchResyncInterval = 10 * time.Minute
+)
+
+// NotificationHandler is a callback to process a notification with. If it fails,
+// the watcher stops and the notification will be redelivered to it (but not to
+// the handlers that already succeeded) on the next run.
+type NotificationHandler func(ctx context.Context, notif *Notification) error
+
+// WatcherConfig is the set of options to configure a notification watcher with.
+type WatcherConfig struct {
+	MinInterval time.Duration // Polling interval while there is activity (0 = default)
+	MaxInterval time.Duration // Polling interval to back off to while idle (0 = default)
+
+	State string // File to persist the delivery progress into, empty to disable
+}
+
+// watchMark is the high-water mark of the notifications already delivered. As
+// multiple notifications may share the same timestamp, the URIs of the ones at
+// the mark are tracked too. The notification being delivered is tracked along
+// with the number of handlers already invoked, so a restart can continue with
+// the remaining ones.
+type watchMark struct {
+	IndexedAt time.Time `json:"indexedAt"`         // Index time of the newest delivered notification
+	URIs      []string  `json:"uris"`              // Delivered notifications at exactly the mark
+	Pending   string    `json:"pending,omitempty"` // Notification being delivered, empty if none
+	Handled   int       `json:"handled,omitempty"` // Handlers of the pending notification already invoked
+}
+
+// NotificationWatcher is a long-running poller of the logged in user's
+// notifications, delivering every new notification exactly once to each of its
+// handlers, even across restarts if the delivery progress is persisted.
+//
+// The progress is saved before each handler is invoked, so a handler returning
+// an error is retried on the next run, but one interrupted by a crash is not.
+//
+// The watcher marks the delivered notifications as seen, which allows it to use
+// the cheap unread count to check for new activity. As such, it is meant to be
+// used by bots, not accounts which are also used interactively.
+type NotificationWatcher struct {
+	client *Client        // API client to poll the notifications through
+	config *WatcherConfig // Watcher options with the defaults filled in
+
+	lock     sync.Mutex                                   // Lock protecting the handlers
+	handlers map[NotificationReason][]NotificationHandler // Callbacks to invoke per notification reason
+
+	mark   *watchMark // High-water mark of delivered notifications, nil if never ran
+	listed time.Time  // Time of the last full notification listing
+}
+
+// NewNotificationWatcher creates a notification watcher on top of an API client.
+// If the config specifies a state file which exists, the delivery progress will
+// be loaded from it and only notifications newer than the ones already handled
+// will be delivered. Otherwise, the unseen notifications are delivered first.
+func NewNotificationWatcher(client *Client, config WatcherConfig) (*NotificationWatcher, error) {
+	// Fill in any defaults the user did not specify
+	if config.MinInterval <= 0 {
+		config.MinInterval = defaultWatchMinInterval
+	}
+	if config.MaxInterval <= 0 {
+		config.MaxInterval = defaultWatchMaxInterval
+	}
+	if config.MaxInterval < config.MinInterval {
+		config.MaxInterval = config.MinInterval
+	}
+	watcher := &NotificationWatcher{
+		client:   client,
+		config:   &config,
+		handlers: make(map[NotificationReason][]NotificationHandler),
+	}
+	// If a previous run persisted its progress, resume it
+	if config.State != "" {
+		blob, err := os.ReadFile(config.State)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// No previous run, start from the unseen notifications
+		case err != nil:
+			return nil, err
+		default:
+			watcher.mark = new(watchMark)
+			if err := json.Unmarshal(blob, watcher.mark); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return watcher, nil
+}
+
+// Handle registers a callback to invoke for notifications raised for a specific
+// reason. Multiple handlers may be registered for the same reason, in which case
+// they are invoked in registration order. Notifications without any handlers are
+// skipped over.
+func (w *NotificationWatcher) Handle(reason NotificationReason, handler NotificationHandler) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.handlers[reason] = append(w.handlers[reason], handler)
+}
+
+// Run polls the notifications until the context is cancelled or a handler fails,
+// delivering the new ones to the registered handlers, oldest first. The polling
+// interval is kept short while there is activity and backs off while idle.
+func (w *NotificationWatcher) Run(ctx context.Context) error {
+	interval := w.config.MinInterval
+	for {
+		active, err := w.poll(ctx)
+		if err != nil {
+			if waitThrottled(ctx, err) {
+				continue
+			}
+			return err
+		}
+		if active {
+			interval = w.config.MinInterval
+		} else {
+			interval = min(2*interval, w.config.MaxInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// poll checks for new notifications and delivers them if any. The returned flag
+// is whether anything new was found.
+func (w *NotificationWatcher) poll(ctx context.Context) (bool, error) {
+	// Use the cheap unread count to avoid listing the notifications needlessly,
+	// but list them every now and again in case another client marked them seen
+	if w.mark != nil && time.Since(w.listed) < watchResyncInterval {
+		count, err := w.client.UnreadNotificationCount(ctx)
+		if err != nil {
+			return false, err
+		}
+		if count == 0 {
+			return false, nil
+		}
+	}
+	// Something might be new, gather everything above the high-water mark
+	var fresh []*Notification
+	for notif, err := range w.client.IterNotifications(ctx, nil) {
+		if err != nil {
+			return false, err
+		}
+		if w.mark == nil {
+			// First ever run, initialize the mark to the newest notification and
+			// deliver only the unseen ones
+			if notif.Read {
+				if len(fresh) == 0 {
+					w.mark = &watchMark{IndexedAt: notif.IndexedAt, URIs: []string{notif.URI}}
+				}
+				break
+			}
+		} else if !w.mark.fresh(notif) {
+			if notif.IndexedAt.Before(w.mark.IndexedAt) {
+				break
+			}
+			continue
+		}
+		fresh = append(fresh, notif)
+	}
+	w.listed = time.Now()
+
+	if w.mark == nil {
+		w.mark = new(watchMark) // No notifications at all yet
+	}
+	if len(fresh) == 0 {
+		if err := w.save(); err != nil {
+			return false, err
+		}
+		// If the unread count was stale (e.g. old notifications never marked), reset
+		// it to avoid needlessly listing again on the next poll
+		if w.mark.IndexedAt.IsZero() {
+			return false, nil
+		}
+		return false, w.client.MarkNotificationsSeen(ctx, w.mark.IndexedAt)
+	}
+	// Deliver the new notifications oldest first
+	slices.Reverse(fresh)
+	if err := w.deliver(ctx, fresh); err != nil {
+		return true, err
+	}
+	return true, w.client.MarkNotificationsSeen(ctx, w.mark.IndexedAt)
+}
+
+// deliver passes a batch of new notifications to the registered handlers, in
+// order. The progress is persisted before every handler invocation, so nothing
+// gets duplicated across restarts. If a handler fails, its invocation is rolled
+// back, so it is retried on the next run.
+func (w *NotificationWatcher) deliver(ctx context.Context, notifs []*Notification) error {
+	for _, notif := range notifs {
+		w.lock.Lock()
+		handlers := w.handlers[notif.Reason]
+		w.lock.Unlock()
+
+		// If the notification was partially delivered, continue where it was left
+		start := 0
+		if w.mark.Pending == notif.URI {
+			start = w.mark.Handled
+		}
+		w.mark.Pending = notif.URI
+		for i := start; i < len(handlers); i++ {
+			w.mark.Handled = i + 1
+			if err := w.save(); err != nil {
+				w.mark.Handled = i
+				return err
+			}
+			if err := handlers[i](ctx, notif); err != nil {
+				w.mark.Handled = i
+				if serr := w.save(); serr != nil {
+					return errors.Join(err, serr)
+				}
+				return err
+			}
+		}
+		w.mark.Pending, w.mark.Handled = "", 0
+		w.mark.advance(notif)
+		if err := w.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save persists the high-water mark of the delivered notifications, if so
+// configured.
+func (w *NotificationWatcher) save() error {
+	if w.config.State == "" {
+		return nil
+	}
+	blob, err := json.Marshal(w.mark)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(w.config.State, blob)
+}
+
+// fresh returns whether a notification is above the high-water mark.
+func (m *watchMark) fresh(notif *Notification) bool {
+	if notif.IndexedAt.After(m.IndexedAt) {
+		return true
+	}
+	return notif.IndexedAt.Equal(m.IndexedAt) && !slices.Contains(m.URIs, notif.URI)
+}
+
+// advance moves the high-water mark to include a delivered notification.
+func (m *watchMark) advance(notif *Notification) {
+	switch {
+	case notif.IndexedAt.After(m.IndexedAt):
+		m.IndexedAt = notif.IndexedAt
+		m.URIs = []string{notif.URI}
+	case notif.IndexedAt.Equal(m.IndexedAt):
+		m.URIs = append(m.URIs, notif.URI)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 go-bluesky authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bluesky
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Tests that the notification high-water mark correctly tracks notifications
+// sharing the same timestamp.
+func TestWatchMark(t *testing.T) {
+	var (
+		base = time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+		mark = &watchMark{IndexedAt: base, URIs: []string{"a"}}
+	)
+	tests := []struct {
+		notif *Notification
+		fresh bool
+	}{
+		{&Notification{URI: "a", IndexedAt: base}, false},
+		{&Notification{URI: "b", IndexedAt: base}, true},
+		{&Notification{URI: "c", IndexedAt: base.Add(-time.Second)}, false},
+		{&Notification{URI: "d", IndexedAt: base.Add(time.Second)}, true},
+	}
+	for _, tt := range tests {
+		if fresh := mark.fresh(tt.notif); fresh != tt.fresh {
+			t.Errorf("%s: freshness mismatch: have %v, want %v", tt.notif.URI, fresh, tt.fresh)
+		}
+	}
+	// Advance the mark at the same timestamp, then past it
+	mark.advance(&Notification{URI: "b", IndexedAt: base})
+	if mark.fresh(&Notification{URI: "b", IndexedAt: base}) {
+		t.Errorf("delivered notification still fresh")
+	}
+	mark.advance(&Notification{URI: "d", IndexedAt: base.Add(time.Second)})
+	if !mark.IndexedAt.Equal(base.Add(time.Second)) || len(mark.URIs) != 1 || mark.URIs[0] != "d" {
+		t.Errorf("advanced mark mismatch: have %v %v", mark.IndexedAt, mark.URIs)
+	}
+}
+
+// Tests that the notification watcher persists and reloads its progress.
+func TestWatcherPersistence(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "watcher.json")
+
+	watcher, err := NewNotificationWatcher(nil, WatcherConfig{State: state})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	if watcher.mark != nil {
+		t.Fatalf("fresh watcher has a mark: %v", watcher.mark)
+	}
+	at := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	watcher.mark = new(watchMark)
+	watcher.mark.advance(&Notification{URI: "a", IndexedAt: at})
+	watcher.mark.advance(&Notification{URI: "b", IndexedAt: at})
+	if err := watcher.save(); err != nil {
+		t.Fatalf("failed to save watcher state: %v", err)
+	}
+	resumed, err := NewNotificationWatcher(nil, WatcherConfig{State: state})
+	if err != nil {
+		t.Fatalf("failed to resume watcher: %v", err)
+	}
+	if resumed.mark == nil || !resumed.mark.IndexedAt.Equal(at) || len(resumed.mark.URIs) != 2 {
+		t.Errorf("resumed mark mismatch: have %+v", resumed.mark)
+	}
+}
+
+// Tests that the notification watcher can poll the live notifications.
+func TestWatchNotifications(t *testing.T) {
+	client := makeTestClientWithLogin(t)
+
+	watcher, err := NewNotificationWatcher(client, WatcherConfig{
+		MinInterval: time.Second,
+		State:       filepath.Join(t.TempDir(), "watcher.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	watcher.Handle(NotificationMention, func(ctx context.Context, notif *Notification) error {
+		if notif.Post == nil {
+			t.Errorf("mention post not hydrated: %s", notif.URI)
+		}
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := watcher.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("watcher failed: %v", err)
+	}
+}
+
+// Tests that each handler receives a notification exactly once across restarts,
+// with failed handlers retried without invoking the successful ones again.
+func TestWatcherDeliverOnce(t *testing.T) {
+	var (
+		state   = filepath.Join(t.TempDir(), "watcher.json")
+		at      = time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+		first   = &Notification{URI: "a", Reason: NotificationMention, IndexedAt: at}
+		second  = &Notification{URI: "b", Reason: NotificationMention, IndexedAt: at.Add(time.Second)}
+		calls   = make(map[string][]string)
+		failure = errors.New("handler failed")
+		fails   = 1
+	)
+	// newWatcher simulates a (re)start of the watcher, loading the persisted state
+	newWatcher := func() *NotificationWatcher {
+		watcher, err := NewNotificationWatcher(nil, WatcherConfig{State: state})
+		if err != nil {
+			t.Fatalf("failed to create watcher: %v", err)
+		}
+		if watcher.mark == nil {
+			watcher.mark = new(watchMark)
+		}
+		watcher.Handle(NotificationMention, func(ctx context.Context, notif *Notification) error {
+			calls["log"] = append(calls["log"], notif.URI)
+			return nil
+		})
+		watcher.Handle(NotificationMention, func(ctx context.Context, notif *Notification) error {
+			calls["reply"] = append(calls["reply"], notif.URI)
+			if fails > 0 {
+				fails--
+				return failure
+			}
+			return nil
+		})
+		return watcher
+	}
+	// Fail the second handler, restart and ensure only it is retried
+	if err := newWatcher().deliver(context.Background(), []*Notification{first}); !errors.Is(err, failure) {
+		t.Fatalf("delivery error mismatch: have %v, want %v", err, failure)
+	}
+	watcher := newWatcher()
+	if err := watcher.deliver(context.Background(), []*Notification{first}); err != nil {
+		t.Fatalf("failed to redeliver notification: %v", err)
+	}
+	if !slices.Equal(calls["log"], []string{"a"}) || !slices.Equal(calls["reply"], []string{"a", "a"}) {
+		t.Errorf("retried invocations mismatch: have %v", calls)
+	}
+	if watcher.mark.fresh(first) || watcher.mark.Pending != "" {
+		t.Errorf("delivered notification still pending: %+v", watcher.mark)
+	}
+	// Simulate a crash within the first handler and ensure it is not invoked again
+	watcher.mark.Pending, watcher.mark.Handled = second.URI, 1
+	if err := watcher.save(); err != nil {
+		t.Fatalf("failed to save watcher state: %v", err)
+	}
+	if err := newWatcher().deliver(context.Background(), []*Notification{second}); err != nil {
+		t.Fatalf("failed to deliver notification: %v", err)
+	}
+	if !slices.Equal(calls["log"], []string{"a"}) || !slices.Equal(calls["reply"], []string{"a", "a", "b"}) {
+		t.Errorf("resumed invocations mismatch: have %v", calls)
+	}
+}